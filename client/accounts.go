@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Account is a user account. Permissions is 1 for administrators and 0 for other users.
+type Account struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	Permissions int    `json:"permissions"`
+}
+
+func (c *Client) ListAccounts(ctx context.Context) ([]Account, error) {
+	var response []Account
+	err := c.do(ctx, http.MethodGet, "/api/v1/accounts", nil, &response)
+	return response, err
+}
+
+func (c *Client) GetAccount(ctx context.Context, id int) (Account, error) {
+	var response Account
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/accounts/%d", id), nil, &response)
+	return response, err
+}
+
+// CreateAccount creates a user account. The first account is an administrator, and can be created without logging in.
+func (c *Client) CreateAccount(ctx context.Context, username string, password string) (int, error) {
+	params := map[string]string{"username": username, "password": password}
+	return c.doID(ctx, http.MethodPost, "/api/v1/accounts", params)
+}
+
+func (c *Client) DeleteAccount(ctx context.Context, id int) error {
+	_, err := c.doID(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/accounts/%d", id), nil)
+	return err
+}
+
+func (c *Client) ChangeAccountPassword(ctx context.Context, id int, password string) error {
+	params := map[string]string{"password": password}
+	_, err := c.doID(ctx, http.MethodPost, fmt.Sprintf("/api/v1/accounts/%d/change_password", id), params)
+	return err
+}
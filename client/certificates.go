@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// CertificateRequest is a certificate request and the certificate issued for it, followed by its issuers.
+// Certificate is empty while the request is outstanding, and "rejected" once it has been rejected.
+// Imported certificates have no CSR.
+type CertificateRequest struct {
+	ID            int    `json:"id"`
+	CSR           string `json:"csr"`
+	Certificate   string `json:"certificate"`
+	Fingerprint   string `json:"fingerprint,omitempty"`
+	ProfileID     int    `json:"profile_id,omitempty"`
+	PredecessorID int    `json:"predecessor_id,omitempty"`
+	SuccessorID   int    `json:"successor_id,omitempty"`
+}
+
+// ImportResult is the outcome of the import of a certificate: "imported", "duplicate" or "invalid".
+// ID is the id of the certificate request that holds the certificate, unless it is invalid, in which case
+// Error and Code tell why, Code being CodeInvalidCertificate or CodeInvalidChain.
+type ImportResult struct {
+	ID     int    `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+func (c *Client) ListCertificateRequests(ctx context.Context) ([]CertificateRequest, error) {
+	var response []CertificateRequest
+	err := c.do(ctx, http.MethodGet, "/api/v1/certificate_requests", nil, &response)
+	return response, err
+}
+
+func (c *Client) GetCertificateRequest(ctx context.Context, id int) (CertificateRequest, error) {
+	var response CertificateRequest
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/certificate_requests/%d", id), nil, &response)
+	return response, err
+}
+
+// GetCurrentCertificateRequest returns the latest issued certificate request of the renewal lineage of a request.
+func (c *Client) GetCurrentCertificateRequest(ctx context.Context, id int) (CertificateRequest, error) {
+	var response CertificateRequest
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/certificate_requests/%d/current", id), nil, &response)
+	return response, err
+}
+
+// CreateCertificateRequest submits a PEM encoded CSR, to be signed with the given certificate profile if it isn't 0.
+func (c *Client) CreateCertificateRequest(ctx context.Context, csr string, profileID int) (int, error) {
+	params := struct {
+		CSR       string `json:"csr"`
+		ProfileID int    `json:"profile_id,omitempty"`
+	}{CSR: csr, ProfileID: profileID}
+	return c.doID(ctx, http.MethodPost, "/api/v1/certificate_requests", params)
+}
+
+// RenewCertificateRequest submits a renewal of an issued certificate request and returns the id of the new request.
+// The CSR of the renewed request is submitted again when csr is empty, if the CSR policy of the server allows key reuse.
+func (c *Client) RenewCertificateRequest(ctx context.Context, id int, csr string) (int, error) {
+	params := map[string]string{"csr": csr}
+	return c.doID(ctx, http.MethodPost, fmt.Sprintf("/api/v1/certificate_requests/%d/renew", id), params)
+}
+
+func (c *Client) DeleteCertificateRequest(ctx context.Context, id int) error {
+	_, err := c.doID(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/certificate_requests/%d", id), nil)
+	return err
+}
+
+// SignCertificateRequest signs a certificate request with the CA of the server, with the given certificate profile if
+// it isn't 0, or with the profile the request was submitted with otherwise.
+func (c *Client) SignCertificateRequest(ctx context.Context, id int, profileID int) error {
+	params := struct {
+		ProfileID int `json:"profile_id,omitempty"`
+	}{ProfileID: profileID}
+	_, err := c.doID(ctx, http.MethodPost, fmt.Sprintf("/api/v1/certificate_requests/%d/certificate/sign", id), params)
+	return err
+}
+
+// CreateCertificate uploads the PEM encoded certificate, followed by its issuers, issued for a certificate request.
+func (c *Client) CreateCertificate(ctx context.Context, id int, certificate string) error {
+	params := map[string]string{"certificate": certificate}
+	_, err := c.doID(ctx, http.MethodPost, fmt.Sprintf("/api/v1/certificate_requests/%d/certificate", id), params)
+	return err
+}
+
+func (c *Client) RejectCertificate(ctx context.Context, id int) error {
+	_, err := c.doID(ctx, http.MethodPost, fmt.Sprintf("/api/v1/certificate_requests/%d/certificate/reject", id), nil)
+	return err
+}
+
+// DeleteCertificate deletes the certificate issued for a certificate request, which becomes outstanding again.
+func (c *Client) DeleteCertificate(ctx context.Context, id int) error {
+	_, err := c.doID(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/certificate_requests/%d/certificate", id), nil)
+	return err
+}
+
+// DownloadCertificate returns the certificate issued for a certificate request in the given format and chain selection.
+// Empty values select the defaults of the server.
+func (c *Client) DownloadCertificate(ctx context.Context, id int, format string, chain string) ([]byte, error) {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	if chain != "" {
+		query.Set("chain", chain)
+	}
+	return c.download(ctx, fmt.Sprintf("/api/v1/certificate_requests/%d/certificate/download", id), query, nil)
+}
+
+// trustStorePasswordHeader is the header the password of a truststore is sent in, so that it isn't logged with the URL.
+const trustStorePasswordHeader = "X-Truststore-Password"
+
+// DownloadTrustStore returns a truststore of the CA certificates that issued the certificate of a certificate request,
+// in the p12 or jks format, protected by the given password. Empty values select the defaults of the server.
+func (c *Client) DownloadTrustStore(ctx context.Context, id int, format string, password string) ([]byte, error) {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	header := http.Header{}
+	if password != "" {
+		header.Set(trustStorePasswordHeader, password)
+	}
+	return c.download(ctx, fmt.Sprintf("/api/v1/certificate_requests/%d/certificate/truststore", id), query, header)
+}
+
+// ImportCertificates records PEM encoded certificates issued outside of Notary, each optionally followed by its
+// issuers, and returns the outcome for every certificate, in order.
+func (c *Client) ImportCertificates(ctx context.Context, certificates string) ([]ImportResult, error) {
+	var response []ImportResult
+	params := map[string]string{"certificates": certificates}
+	err := c.do(ctx, http.MethodPost, "/api/v1/certificates/import", params, &response)
+	return response, err
+}
@@ -0,0 +1,311 @@
+// Package client is a Go client for the REST API of Notary.
+//
+// A client is created for the address of a server with New, and logs in with Login:
+//
+//	c, err := client.New("https://notary.example.com:3000", "", fingerprint)
+//	if err != nil {
+//		return err
+//	}
+//	if _, err := c.Login(ctx, "admin", password); err != nil {
+//		return err
+//	}
+//	id, err := c.CreateCertificateRequest(ctx, csr, 0)
+//
+// Once logged in, the client logs in again with the same credentials when its token expires, so that long running
+// services can keep using it. Errors returned by the server are *APIError values, which match the errors of their
+// status code, such as ErrNotFound, with errors.Is, and whose Code identifies their cause, such as CodeInvalidCSR.
+// A Client can be used by several goroutines at once.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin is how long before its token expires the client logs in again, so that the token doesn't expire
+// while a request is on its way to the server.
+const tokenRefreshMargin = time.Minute
+
+// Client sends requests to a Notary server, authenticated with the token of an account once logged in.
+type Client struct {
+	address    string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	token string
+	// username and password are the credentials of the last login, with which the token is refreshed.
+	username string
+	password string
+}
+
+// New returns a client for the Notary server at the given address, such as https://notary.example.com:3000.
+// The client authenticates with the given token, which can be empty until Login is called.
+// When fingerprint is set, the certificate of the server is only trusted if its hex encoded SHA-256 fingerprint matches,
+// which allows self signed certificates to be used safely. Otherwise the certificate is verified with the system roots.
+func New(address string, token string, fingerprint string) (*Client, error) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server address: %w", err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, errors.New("invalid server address: expected https://<host>:<port>")
+	}
+	tlsConfig := &tls.Config{}
+	if fingerprint != "" {
+		fingerprint = normalizeFingerprint(fingerprint)
+		// The chain is verified by the pinned fingerprint instead of the system roots.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 || CertificateFingerprint(rawCerts[0]) != fingerprint {
+				return ErrFingerprintMismatch
+			}
+			return nil
+		}
+	}
+	return &Client{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// ServerFingerprint connects to the Notary server at the given address and returns the fingerprint of its certificate,
+// without verifying it, so that it can be shown to the user and pinned.
+func ServerFingerprint(address string) (string, error) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid server address: %w", err)
+	}
+	conn, err := tls.Dial("tcp", parsed.Host, &tls.Config{InsecureSkipVerify: true}) // #nosec G402 -- the certificate is only read
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", errors.New("the server didn't present a certificate")
+	}
+	return CertificateFingerprint(certs[0].Raw), nil
+}
+
+// CertificateFingerprint returns the hex encoded SHA-256 fingerprint of a DER encoded certificate.
+func CertificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeFingerprint accepts fingerprints in the colon separated form printed by openssl.
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
+
+// Token returns the token the client authenticates with.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// tokenClaims are the claims of a token the client reads. The token isn't verified, as only the server can do so.
+type tokenClaims struct {
+	ID        int   `json:"id"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+func parseToken(token string) (tokenClaims, error) {
+	var claims tokenClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("not logged in")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, fmt.Errorf("invalid token: %w", err)
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("invalid token: %w", err)
+	}
+	return claims, nil
+}
+
+// AccountID returns the id of the account the token of the client belongs to.
+// The token isn't verified, as only the server can do so.
+func (c *Client) AccountID() (int, error) {
+	claims, err := parseToken(c.Token())
+	return claims.ID, err
+}
+
+// Login authenticates with the given credentials. The token it returns is used by the client for the following requests,
+// and the client logs in again with the same credentials when the token expires.
+func (c *Client) Login(ctx context.Context, username string, password string) (string, error) {
+	token, err := c.login(ctx, username, password)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token, c.username, c.password = token, username, password
+	return token, nil
+}
+
+func (c *Client) login(ctx context.Context, username string, password string) (string, error) {
+	var response struct {
+		Token string `json:"token"`
+	}
+	params := map[string]string{"username": username, "password": password}
+	resp, err := c.sendWithToken(ctx, http.MethodPost, "/login", params, nil, "")
+	if err != nil {
+		return "", err
+	}
+	if err := decodeResult(resp, &response); err != nil {
+		return "", err
+	}
+	return response.Token, nil
+}
+
+// currentToken returns the token to send a request with, after logging in again if it is about to expire.
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+	if claims, err := parseToken(token); err == nil && claims.ExpiresAt != 0 &&
+		time.Until(time.Unix(claims.ExpiresAt, 0)) < tokenRefreshMargin {
+		return c.refreshToken(ctx, token)
+	}
+	return token, nil
+}
+
+// refreshToken logs in again with the credentials of the last login to replace the given token, unless another
+// request has already replaced it. It returns the given token when the client has no credentials to log in with.
+func (c *Client) refreshToken(ctx context.Context, stale string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != stale || c.username == "" {
+		return c.token, nil
+	}
+	token, err := c.login(ctx, c.username, c.password)
+	if err != nil {
+		return "", fmt.Errorf("couldn't refresh token: %w", err)
+	}
+	c.token = token
+	return token, nil
+}
+
+// do sends a request with params as its JSON body, and decodes the result of the response into result.
+func (c *Client) do(ctx context.Context, method string, path string, params any, result any) error {
+	resp, err := c.send(ctx, method, path, params, nil)
+	if err != nil {
+		return err
+	}
+	return decodeResult(resp, result)
+}
+
+// doID sends a request whose response holds the id of the affected resource, and returns it.
+func (c *Client) doID(ctx context.Context, method string, path string, params any) (int, error) {
+	var response struct {
+		ID int `json:"id"`
+	}
+	err := c.do(ctx, method, path, params, &response)
+	return response.ID, err
+}
+
+// download sends a request with the given query and headers whose response is a file, and returns its content.
+func (c *Client) download(ctx context.Context, path string, query url.Values, header http.Header) ([]byte, error) {
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	resp, err := c.send(ctx, http.MethodGet, path, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// send sends a request authenticated with the token of the client. When the token is refused by the server, which
+// happens when it has expired or the server has been restarted with another secret, the client logs in again and
+// sends the request once more.
+func (c *Client) send(ctx context.Context, method string, path string, params any, header http.Header) (*http.Response, error) {
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.sendWithToken(ctx, method, path, params, header, token)
+	if token == "" || !errors.Is(err, ErrUnauthorized) {
+		return resp, err
+	}
+	refreshed, refreshErr := c.refreshToken(ctx, token)
+	if refreshErr != nil {
+		return nil, refreshErr
+	}
+	if refreshed == token {
+		return nil, err
+	}
+	return c.sendWithToken(ctx, method, path, params, header, refreshed)
+}
+
+// sendWithToken sends a request with params as its JSON body and the given additional headers, and returns its response
+// if it succeeded, or the error it holds otherwise.
+func (c *Client) sendWithToken(ctx context.Context, method string, path string, params any, header http.Header, token string) (*http.Response, error) {
+	var body io.Reader
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.address+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if params != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var problem problemResponse
+	json.NewDecoder(resp.Body).Decode(&problem) //nolint:errcheck
+	return nil, newAPIError(resp, problem)
+}
+
+// decodeResult decodes the result of a successful response into result, and closes it.
+func decodeResult(resp *http.Response, result any) error {
+	defer resp.Body.Close()
+	response := struct {
+		Result any `json:"result"`
+	}{Result: result}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("couldn't decode response: %w", err)
+	}
+	return nil
+}
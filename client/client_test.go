@@ -0,0 +1,245 @@
+package client_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/canonical/notary/client"
+	"github.com/canonical/notary/internal/db"
+	"github.com/canonical/notary/internal/server"
+)
+
+// setupServer serves the API with the given JWT secret, which can be replaced by storing another handler in the
+// returned pointer, as if the server had been restarted.
+func setupServer(t *testing.T) (*httptest.Server, *db.Database, *atomic.Pointer[http.Handler]) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("couldn't create database: %s", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	var handler atomic.Pointer[http.Handler]
+	h := server.NewHandler(&server.HandlerConfig{DB: database, JWTSecret: []byte("secret")})
+	handler.Store(&h)
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(*handler.Load()).ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, database, &handler
+}
+
+func newClient(t *testing.T, ts *httptest.Server) *client.Client {
+	c, err := client.New(ts.URL, "", client.CertificateFingerprint(ts.Certificate().Raw))
+	if err != nil {
+		t.Fatalf("couldn't create client: %s", err)
+	}
+	return c
+}
+
+func newCSR(t *testing.T, commonName string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate key: %s", err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}, key)
+	if err != nil {
+		t.Fatalf("couldn't create CSR: %s", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+func TestClientEndToEnd(t *testing.T) {
+	ts, _, _ := setupServer(t)
+	ctx := context.Background()
+	fingerprint := client.CertificateFingerprint(ts.Certificate().Raw)
+
+	serverFingerprint, err := client.ServerFingerprint(ts.URL)
+	if err != nil {
+		t.Fatalf("couldn't get server fingerprint: %s", err)
+	}
+	if serverFingerprint != fingerprint {
+		t.Fatalf("expected fingerprint %s, got %s", fingerprint, serverFingerprint)
+	}
+
+	c := newClient(t, ts)
+	if _, err := c.CreateAccount(ctx, "admin", "Admin123"); err != nil {
+		t.Fatalf("couldn't create account: %s", err)
+	}
+	if _, err := c.Login(ctx, "admin", "Admin123"); err != nil {
+		t.Fatalf("couldn't login: %s", err)
+	}
+	accountID, err := c.AccountID()
+	if err != nil || accountID != 1 {
+		t.Fatalf("expected account id 1, got %d: %v", accountID, err)
+	}
+
+	t.Run("certificate requests", func(t *testing.T) {
+		id, err := c.CreateCertificateRequest(ctx, newCSR(t, "example.com"), 0)
+		if err != nil {
+			t.Fatalf("couldn't create certificate request: %s", err)
+		}
+		requests, err := c.ListCertificateRequests(ctx)
+		if err != nil {
+			t.Fatalf("couldn't list certificate requests: %s", err)
+		}
+		if len(requests) != 1 || requests[0].ID != id {
+			t.Fatalf("expected certificate request %d to be listed, got %+v", id, requests)
+		}
+		if err := c.RejectCertificate(ctx, id); err != nil {
+			t.Fatalf("couldn't reject certificate: %s", err)
+		}
+		request, err := c.GetCertificateRequest(ctx, id)
+		if err != nil {
+			t.Fatalf("couldn't get certificate request: %s", err)
+		}
+		if request.Certificate != "rejected" {
+			t.Fatalf("expected certificate request to be rejected, got %q", request.Certificate)
+		}
+		if _, err := c.DownloadCertificate(ctx, id, "pem", ""); err == nil {
+			t.Fatalf("expected download of a rejected certificate to fail")
+		}
+		if _, err := c.RenewCertificateRequest(ctx, id, newCSR(t, "example.com")); !errors.Is(err, client.ErrBadRequest) {
+			t.Fatalf("expected the renewal of a rejected request to be refused, got %v", err)
+		}
+		if err := c.DeleteCertificateRequest(ctx, id); err != nil {
+			t.Fatalf("couldn't delete certificate request: %s", err)
+		}
+		var apiErr *client.APIError
+		if _, err := c.GetCertificateRequest(ctx, id); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected a not found error, got %v", err)
+		}
+		if !errors.Is(apiErr, client.ErrNotFound) || errors.Is(apiErr, client.ErrBadRequest) {
+			t.Fatalf("expected the error to match ErrNotFound only")
+		}
+	})
+
+	t.Run("certificates", func(t *testing.T) {
+		results, err := c.ImportCertificates(ctx, "not a certificate")
+		if !errors.Is(err, client.ErrBadRequest) {
+			t.Fatalf("expected invalid certificates to be refused, got %v, %+v", err, results)
+		}
+		if err := c.DeleteCertificate(ctx, 100); !errors.Is(err, client.ErrNotFound) {
+			t.Fatalf("expected the certificate of an unknown request not to be deleted, got %v", err)
+		}
+		var apiErr *client.APIError
+		_, err = c.CreateCertificateRequest(ctx, "not a csr", 0)
+		if !errors.As(err, &apiErr) || apiErr.Code != client.CodeInvalidCSR || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "csr" {
+			t.Fatalf("expected an invalid CSR error about the csr field, got %+v", err)
+		}
+	})
+
+	t.Run("accounts", func(t *testing.T) {
+		userID, err := c.CreateAccount(ctx, "user", "userPass!")
+		if err != nil {
+			t.Fatalf("couldn't create account: %s", err)
+		}
+		if _, err := c.CreateAccount(ctx, "user", "userPass!"); !errors.Is(err, client.ErrBadRequest) {
+			t.Fatalf("expected a duplicate account to be refused, got %v", err)
+		}
+		accounts, err := c.ListAccounts(ctx)
+		if err != nil {
+			t.Fatalf("couldn't list accounts: %s", err)
+		}
+		if len(accounts) != 2 || accounts[1].Username != "user" {
+			t.Fatalf("expected 2 accounts, got %+v", accounts)
+		}
+		account, err := c.GetAccount(ctx, userID)
+		if err != nil || account.Username != "user" || account.Permissions != 0 {
+			t.Fatalf("unexpected account %+v, %v", account, err)
+		}
+
+		userClient := newClient(t, ts)
+		if _, err := userClient.Login(ctx, "user", "userPass!"); err != nil {
+			t.Fatalf("couldn't login: %s", err)
+		}
+		if _, err := userClient.ListAccounts(ctx); !errors.Is(err, client.ErrForbidden) {
+			t.Fatalf("expected a forbidden error, got %v", err)
+		}
+		if err := c.DeleteAccount(ctx, userID); err != nil {
+			t.Fatalf("couldn't delete account: %s", err)
+		}
+
+		if err := c.ChangeAccountPassword(ctx, accountID, "NewAdmin123"); err != nil {
+			t.Fatalf("couldn't change password: %s", err)
+		}
+		if _, err := c.Login(ctx, "admin", "Admin123"); !errors.Is(err, client.ErrUnauthorized) {
+			t.Fatalf("expected the old password to be refused, got %v", err)
+		}
+		if _, err := c.Login(ctx, "admin", "NewAdmin123"); err != nil {
+			t.Fatalf("couldn't login with the new password: %s", err)
+		}
+	})
+}
+
+func TestClientTokenRefresh(t *testing.T) {
+	ts, database, handler := setupServer(t)
+	ctx := context.Background()
+	c := newClient(t, ts)
+	if _, err := c.CreateAccount(ctx, "admin", "Admin123"); err != nil {
+		t.Fatalf("couldn't create account: %s", err)
+	}
+	token, err := c.Login(ctx, "admin", "Admin123")
+	if err != nil {
+		t.Fatalf("couldn't login: %s", err)
+	}
+	stale, err := client.New(ts.URL, token, client.CertificateFingerprint(ts.Certificate().Raw))
+	if err != nil {
+		t.Fatalf("couldn't create client: %s", err)
+	}
+
+	h := server.NewHandler(&server.HandlerConfig{DB: database, JWTSecret: []byte("another secret")})
+	handler.Store(&h)
+	if _, err := c.ListCertificateRequests(ctx); err != nil {
+		t.Fatalf("expected the client to log in again once its token is refused, got %v", err)
+	}
+	if c.Token() == token {
+		t.Fatalf("expected the token to be replaced")
+	}
+	if _, err := stale.ListCertificateRequests(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("expected a client without credentials to fail, got %v", err)
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	ts, _, _ := setupServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := newClient(t, ts).ListCertificateRequests(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the request to be canceled, got %v", err)
+	}
+}
+
+func TestClientPinning(t *testing.T) {
+	ts, _, _ := setupServer(t)
+	ctx := context.Background()
+
+	c, err := client.New(ts.URL, "", strings.Repeat("00", 32))
+	if err != nil {
+		t.Fatalf("couldn't create client: %s", err)
+	}
+	if _, err := c.ListCertificateRequests(ctx); !errors.Is(err, client.ErrFingerprintMismatch) {
+		t.Fatalf("expected a fingerprint mismatch, got %v", err)
+	}
+
+	c, err = client.New(ts.URL, "", "")
+	if err != nil {
+		t.Fatalf("couldn't create client: %s", err)
+	}
+	if _, err := c.ListCertificateRequests(ctx); err == nil {
+		t.Fatalf("expected the self signed certificate of the server to be untrusted")
+	}
+
+	if _, err := client.New("http://"+strings.TrimPrefix(ts.URL, "https://"), "", ""); err == nil {
+		t.Fatalf("expected insecure addresses to be refused")
+	}
+}
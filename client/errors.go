@@ -0,0 +1,126 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrFingerprintMismatch is returned when the certificate of the server doesn't match the pinned fingerprint.
+var ErrFingerprintMismatch = errors.New("the certificate of the server doesn't match the pinned fingerprint")
+
+// The errors an APIError matches with errors.Is, depending on its status code.
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrInternal        = errors.New("internal server error")
+	ErrUnavailable     = errors.New("service unavailable")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:          ErrBadRequest,
+	http.StatusUnauthorized:        ErrUnauthorized,
+	http.StatusForbidden:           ErrForbidden,
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusConflict:            ErrConflict,
+	http.StatusTooManyRequests:     ErrTooManyRequests,
+	http.StatusInternalServerError: ErrInternal,
+	http.StatusServiceUnavailable:  ErrUnavailable,
+}
+
+// The codes of APIError, which identify the cause of an error more precisely than its status code.
+// Errors without a more specific cause have the code of their status, such as CodeNotFound.
+const (
+	CodeBadRequest          = "bad_request"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeRateLimited         = "rate_limited"
+	CodeInternalError       = "internal_error"
+	CodeUnavailable         = "unavailable"
+	CodeInvalidJSON         = "invalid_json"
+	CodeMissingField        = "missing_field"
+	CodeWeakPassword        = "weak_password"
+	CodeInvalidCredentials  = "invalid_credentials"
+	CodeAlreadyExists       = "already_exists"
+	CodeAdminAccount        = "admin_account"
+	CodeInvalidCSR          = "invalid_csr"
+	CodeInvalidCertificate  = "invalid_certificate"
+	CodeInvalidChain        = "invalid_chain"
+	CodeCertificateMismatch = "certificate_mismatch"
+	CodeNotIssued           = "not_issued"
+	CodeAlreadyRenewed      = "already_renewed"
+	CodeAlreadyProcessed    = "already_processed"
+	CodeImported            = "imported_certificate"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeInvalidProfile      = "invalid_profile"
+	CodeProfileNotFound     = "profile_not_found"
+	CodeProfileRequired     = "profile_required"
+	CodeProfileInUse        = "profile_in_use"
+	CodeCAProfileNotAllowed = "ca_profile_not_allowed"
+	CodeSigningUnavailable  = "signing_unavailable"
+	CodeInvalidBulkSize     = "invalid_bulk_size"
+	CodeInvalidFormat       = "invalid_format"
+	CodeNoIssuers           = "no_issuers"
+)
+
+// FieldError is a problem with a single field of the body of a request.
+type FieldError struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// APIError is an error response of the API. It matches the error of its status code with errors.Is, so that callers
+// can check for instance for errors.Is(err, client.ErrNotFound) without looking at the status code.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Code identifies the cause of the error, such as CodeInvalidCSR.
+	Code string
+	// Fields are the fields of the request body that caused the error, if any.
+	Fields []FieldError
+	// RetryAfter is how long to wait before sending the request again, when the server tells so with
+	// the Retry-After header of a 429 or 503 response.
+	RetryAfter time.Duration
+}
+
+// problemResponse is the body of an error response, a problem details object as described by RFC 7807.
+type problemResponse struct {
+	Detail string       `json:"detail"`
+	Code   string       `json:"code"`
+	Fields []FieldError `json:"fields"`
+	// Error is the message of the error, which older servers only report.
+	Error string `json:"error"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.StatusCode)
+}
+
+func (e *APIError) Is(target error) bool {
+	err, ok := statusErrors[e.StatusCode]
+	return ok && err == target
+}
+
+// newAPIError returns the error held by a response that didn't succeed, whose body has already been decoded into problem.
+func newAPIError(resp *http.Response, problem problemResponse) *APIError {
+	message := problem.Detail
+	if message == "" {
+		message = problem.Error
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: message, Code: problem.Code, Fields: problem.Fields}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
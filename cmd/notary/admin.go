@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+// adminCommand manages the accounts of a server directly in its database, so that access can be recovered
+// when no admin can log in. Notary should be stopped while it runs.
+//
+//	notary admin create-user|reset-password|list-users|promote
+func adminCommand(args []string) error {
+	return runSubcommand("admin", args, map[string]func(args []string) error{
+		"create-user":    adminCreateUserCommand,
+		"reset-password": adminResetPasswordCommand,
+		"list-users":     adminListUsersCommand,
+		"promote":        adminPromoteCommand,
+	})
+}
+
+// dbCommand maintains the database of a server.
+//
+//	notary db check
+func dbCommand(args []string) error {
+	return runSubcommand("db", args, map[string]func(args []string) error{
+		"check": dbCheckCommand,
+	})
+}
+
+// openDatabase parses the flags of a subcommand and opens the database of the server named by its config file.
+func openDatabase(flags *flag.FlagSet, args []string) (*db.Database, error) {
+	conf, err := loadConfig(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	return db.NewDatabase(conf.DBPath)
+}
+
+func adminCreateUserCommand(args []string) error {
+	flags := flag.NewFlagSet("admin create-user", flag.ExitOnError)
+	username := flags.String("username", "", "The username of the account")
+	password := flags.String("password", "", "The password of the account. It is read from the standard input when not given")
+	admin := flags.Bool("admin", false, "Give the account admin permissions")
+	database, err := openDatabase(flags, args)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	if *username == "" {
+		return errors.New("providing a username with -username is required")
+	}
+	if err := readValidPassword(password); err != nil {
+		return err
+	}
+	permission := db.UserPermission
+	if *admin {
+		permission = db.AdminPermission
+	}
+	id, err := database.CreateUser(*username, *password, permission)
+	if err != nil {
+		if errors.Is(err, db.ErrAlreadyExists) {
+			return fmt.Errorf("account %q already exists", *username)
+		}
+		return err
+	}
+	fmt.Printf("Created account %d for %s\n", id, *username)
+	return nil
+}
+
+func adminResetPasswordCommand(args []string) error {
+	flags := flag.NewFlagSet("admin reset-password", flag.ExitOnError)
+	username := flags.String("username", "", "The username of the account")
+	password := flags.String("password", "", "The new password. It is read from the standard input when not given")
+	database, err := openDatabase(flags, args)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	user, err := retrieveUser(database, *username)
+	if err != nil {
+		return err
+	}
+	if err := readValidPassword(password); err != nil {
+		return err
+	}
+	if _, err := database.UpdateUser(strconv.Itoa(user.ID), *password); err != nil {
+		return err
+	}
+	fmt.Printf("Reset the password of %s\n", user.Username)
+	return nil
+}
+
+func adminListUsersCommand(args []string) error {
+	flags := flag.NewFlagSet("admin list-users", flag.ExitOnError)
+	output := outputFlag(flags)
+	database, err := openDatabase(flags, args)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	users, err := database.RetrieveAllUsers()
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		type user struct {
+			ID          int    `json:"id"`
+			Username    string `json:"username"`
+			Permissions int    `json:"permissions"`
+		}
+		result := make([]user, len(users))
+		for i, u := range users {
+			result[i] = user{ID: u.ID, Username: u.Username, Permissions: u.Permissions}
+		}
+		return printJSON(result)
+	}
+	rows := [][]string{{"ID", "USERNAME", "ROLE"}}
+	for _, user := range users {
+		rows = append(rows, []string{strconv.Itoa(user.ID), user.Username, roleName(user.Permissions)})
+	}
+	return printTable(rows)
+}
+
+func adminPromoteCommand(args []string) error {
+	flags := flag.NewFlagSet("admin promote", flag.ExitOnError)
+	username := flags.String("username", "", "The username of the account to give admin permissions to")
+	database, err := openDatabase(flags, args)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	user, err := retrieveUser(database, *username)
+	if err != nil {
+		return err
+	}
+	if _, err := database.UpdateUserPermissions(strconv.Itoa(user.ID), db.AdminPermission); err != nil {
+		return err
+	}
+	fmt.Printf("Promoted %s to admin\n", user.Username)
+	return nil
+}
+
+func dbCheckCommand(args []string) error {
+	flags := flag.NewFlagSet("db check", flag.ExitOnError)
+	conf, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	// The database is opened read-only and isn't migrated, so that it is checked as it is, and left unchanged.
+	database, err := db.OpenReadOnly(conf.DBPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	problems, err := database.Check()
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+	fmt.Println("The database is healthy")
+	return nil
+}
+
+func retrieveUser(database *db.Database, username string) (db.User, error) {
+	if username == "" {
+		return db.User{}, errors.New("providing a username with -username is required")
+	}
+	user, err := database.RetrieveUserByUsername(username)
+	if errors.Is(err, db.ErrIdNotFound) {
+		return db.User{}, fmt.Errorf("account %q doesn't exist", username)
+	}
+	return user, err
+}
+
+// readValidPassword reads the password from the standard input if it wasn't given,
+// and makes sure it meets the same requirements as passwords set through the API.
+func readValidPassword(password *string) error {
+	if err := readPassword(password); err != nil {
+		return err
+	}
+	if !db.ValidatePassword(*password) {
+		return errors.New(db.PasswordRequirements)
+	}
+	return nil
+}
+
+func roleName(permissions int) string {
+	if permissions == db.AdminPermission {
+		return "admin"
+	}
+	return "user"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+// writeTestConfig writes a config whose database and serving certificate are kept in a temporary directory,
+// and returns its path and the path of the database.
+func writeTestConfig(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "certs.db")
+	configPath := filepath.Join(dir, "config.yaml")
+	conf := "db_path: " + dbPath + "\nport: 8000\ntls_bootstrap:\n  directory: " + filepath.Join(dir, "tls") + "\n"
+	if err := os.WriteFile(configPath, []byte(conf), 0o600); err != nil {
+		t.Fatalf("couldn't write config: %s", err)
+	}
+	return configPath, dbPath
+}
+
+func TestAdminCreateUser(t *testing.T) {
+	configPath, dbPath := writeTestConfig(t)
+	args := []string{"-config", configPath, "-username", "admin", "-password", "Admin123", "-admin"}
+	if err := adminCreateUserCommand(args); err != nil {
+		t.Fatalf("couldn't create user: %s", err)
+	}
+	if err := adminCreateUserCommand(args); err == nil || err.Error() != `account "admin" already exists` {
+		t.Fatalf("expected an existing account to be reported, got %v", err)
+	}
+	if err := adminCreateUserCommand([]string{"-config", configPath, "-username", "weak", "-password", "weak"}); err == nil || err.Error() != db.PasswordRequirements {
+		t.Fatalf("expected a weak password to be refused, got %v", err)
+	}
+
+	database, err := db.NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("couldn't open database: %s", err)
+	}
+	defer database.Close()
+	user, err := database.RetrieveUserByUsername("admin")
+	if err != nil || user.Permissions != db.AdminPermission {
+		t.Fatalf("expected the admin account to be created, got %+v: %v", user, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dbPath), "tls")); !os.IsNotExist(err) {
+		t.Fatalf("expected the admin command not to bootstrap a serving certificate, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+// backupCommand writes a consistent snapshot of the database of the server to a file only readable by its owner.
+// It can run while the server is running.
+//
+//	notary backup -config notary.yaml -to notary-backup.db
+func backupCommand(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	to := flags.String("to", "", "The file to write the backup to")
+	conf, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if *to == "" {
+		return errors.New("providing a backup file with -to is required")
+	}
+	// The database is opened read-only so that a running server's database isn't migrated by a backup.
+	database, err := db.OpenReadOnly(conf.DBPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	if err := database.Backup(*to); err != nil {
+		return err
+	}
+	fmt.Printf("Database backed up to %s\n", *to)
+	return nil
+}
+
+// restoreCommand replaces the database of the server with a backup, once the backup is validated.
+// The server should be stopped while the backup is restored.
+//
+//	notary restore -config notary.yaml -from notary-backup.db
+func restoreCommand(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	from := flags.String("from", "", "The backup file to restore")
+	conf, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if *from == "" {
+		return errors.New("providing a backup file with -from is required")
+	}
+	if err := db.Restore(*from, conf.DBPath); err != nil {
+		return err
+	}
+	fmt.Printf("Database restored from %s\n", *from)
+	return nil
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/canonical/notary/client"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// clientConfigEnv overrides the location of the file in which the client stores its login.
+const clientConfigEnv = "NOTARY_CLIENT_CONFIG"
+
+// clientConfig is the login of the client, stored between commands.
+type clientConfig struct {
+	Server      string `yaml:"server"`
+	Fingerprint string `yaml:"fingerprint"`
+	Token       string `yaml:"token"`
+}
+
+func clientConfigPath() (string, error) {
+	if path := os.Getenv(clientConfigEnv); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "notary", "client.yaml"), nil
+}
+
+func readClientConfig() (clientConfig, error) {
+	var conf clientConfig
+	path, err := clientConfigPath()
+	if err != nil {
+		return conf, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return conf, errors.New("not logged in: run notary login first")
+		}
+		return conf, err
+	}
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return conf, fmt.Errorf("couldn't read %s: %w", path, err)
+	}
+	return conf, nil
+}
+
+// writeClientConfig stores the login of the client in a file only readable by the current user, as it holds a token.
+func writeClientConfig(conf clientConfig) error {
+	path, err := clientConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// newClient returns a client for the server the user logged in to.
+func newClient() (*client.Client, error) {
+	conf, err := readClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(conf.Server, conf.Token, conf.Fingerprint)
+}
+
+// loginCommand logs in to a Notary server and stores the token in the client config file.
+// The certificate of the server is pinned: unless its fingerprint is given, it is shown to the user for confirmation.
+//
+//	notary login -server https://notary.example.com:3000 -username admin
+func loginCommand(args []string) error {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	server := flags.String("server", "", "The address of the Notary server, such as https://notary.example.com:3000")
+	username := flags.String("username", "", "The username of the account")
+	password := flags.String("password", "", "The password of the account. It is read from the standard input when not given")
+	fingerprint := flags.String("fingerprint", "", "The SHA-256 fingerprint of the server certificate to pin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	conf, err := readClientConfig()
+	if err != nil {
+		conf = clientConfig{}
+	}
+	if *server != "" && *server != conf.Server {
+		conf = clientConfig{Server: *server}
+	}
+	if conf.Server == "" {
+		return errors.New("providing the address of the server with -server is required")
+	}
+	if *fingerprint != "" {
+		conf.Fingerprint = *fingerprint
+	}
+	input := bufio.NewReader(os.Stdin)
+	if conf.Fingerprint == "" {
+		serverFingerprint, err := client.ServerFingerprint(conf.Server)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("The certificate of %s has the SHA-256 fingerprint:\n%s\n", conf.Server, serverFingerprint)
+		answer, err := prompt(input, "Trust this certificate? [y/N] ")
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			return errors.New("the certificate of the server wasn't trusted")
+		}
+		conf.Fingerprint = serverFingerprint
+	}
+	if *username == "" {
+		if *username, err = prompt(input, "Username: "); err != nil {
+			return err
+		}
+	}
+	if *password == "" {
+		if *password, err = promptPassword(input, "Password: "); err != nil {
+			return err
+		}
+	}
+	c, err := client.New(conf.Server, "", conf.Fingerprint)
+	if err != nil {
+		return err
+	}
+	if conf.Token, err = c.Login(context.Background(), *username, *password); err != nil {
+		return err
+	}
+	if err := writeClientConfig(conf); err != nil {
+		return err
+	}
+	fmt.Printf("Logged in to %s as %s\n", conf.Server, *username)
+	return nil
+}
+
+func prompt(input *bufio.Reader, message string) (string, error) {
+	fmt.Print(message)
+	line, err := input.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// promptPassword prints a message and reads a password without echoing it when standard input is a terminal,
+// and reads it as a line of the given input otherwise, so that it can be piped.
+func promptPassword(input *bufio.Reader, message string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return prompt(input, message)
+	}
+	fmt.Print(message)
+	password, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(password)), nil
+}
+
+// csrCommand manages certificate requests.
+//
+//	notary csr submit|list|get|delete
+func csrCommand(args []string) error {
+	return runSubcommand("csr", args, map[string]func(args []string) error{
+		"submit": csrSubmitCommand,
+		"list":   csrListCommand,
+		"get":    csrGetCommand,
+		"delete": csrDeleteCommand,
+	})
+}
+
+// certCommand manages the certificates of certificate requests.
+//
+//	notary cert upload|reject|download
+func certCommand(args []string) error {
+	return runSubcommand("cert", args, map[string]func(args []string) error{
+		"upload":   certUploadCommand,
+		"reject":   certRejectCommand,
+		"download": certDownloadCommand,
+	})
+}
+
+// accountCommand manages user accounts.
+//
+//	notary account create|list|passwd
+func accountCommand(args []string) error {
+	return runSubcommand("account", args, map[string]func(args []string) error{
+		"create": accountCreateCommand,
+		"list":   accountListCommand,
+		"passwd": accountPasswdCommand,
+	})
+}
+
+func runSubcommand(name string, args []string, subcommands map[string]func(args []string) error) error {
+	names := make([]string, 0, len(subcommands))
+	for subcommand := range subcommands {
+		names = append(names, subcommand)
+	}
+	sort.Strings(names)
+	if len(args) == 0 {
+		return fmt.Errorf("notary %s requires a subcommand: %s", name, strings.Join(names, ", "))
+	}
+	subcommand, ok := subcommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown subcommand %q: expected one of %s", args[0], strings.Join(names, ", "))
+	}
+	return subcommand(args[1:])
+}
+
+func csrSubmitCommand(args []string) error {
+	flags := flag.NewFlagSet("csr submit", flag.ExitOnError)
+	file := flags.String("f", "", "The PEM encoded CSR file to submit")
+	profileID := flags.Int("profile", 0, "The id of the certificate profile to sign the request with")
+	output := outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("providing a CSR file with -f is required")
+	}
+	csr, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	id, err := c.CreateCertificateRequest(context.Background(), string(csr), *profileID)
+	if err != nil {
+		return err
+	}
+	return printID(*output, id, "Created certificate request %d\n")
+}
+
+func csrListCommand(args []string) error {
+	flags := flag.NewFlagSet("csr list", flag.ExitOnError)
+	output := outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	requests, err := c.ListCertificateRequests(context.Background())
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return printJSON(requests)
+	}
+	rows := [][]string{{"ID", "STATUS", "COMMON NAME", "NOT AFTER"}}
+	for _, request := range requests {
+		rows = append(rows, []string{
+			strconv.Itoa(request.ID),
+			requestStatus(request),
+			requestCommonName(request),
+			certificateNotAfter(request.Certificate),
+		})
+	}
+	return printTable(rows)
+}
+
+func csrGetCommand(args []string) error {
+	flags := flag.NewFlagSet("csr get", flag.ExitOnError)
+	output := outputFlag(flags)
+	id, err := parseWithID(flags, args)
+	if err != nil {
+		return err
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	request, err := c.GetCertificateRequest(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return printJSON(request)
+	}
+	rows := [][]string{
+		{"ID:", strconv.Itoa(request.ID)},
+		{"Status:", requestStatus(request)},
+		{"Common name:", requestCommonName(request)},
+		{"Not after:", certificateNotAfter(request.Certificate)},
+		{"Profile:", optionalID(request.ProfileID)},
+		{"Predecessor:", optionalID(request.PredecessorID)},
+		{"Successor:", optionalID(request.SuccessorID)},
+	}
+	if request.Fingerprint != "" {
+		rows = append(rows, []string{"Fingerprint:", request.Fingerprint})
+	}
+	return printTable(rows)
+}
+
+func csrDeleteCommand(args []string) error {
+	flags := flag.NewFlagSet("csr delete", flag.ExitOnError)
+	id, err := parseWithID(flags, args)
+	if err != nil {
+		return err
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	if err := c.DeleteCertificateRequest(context.Background(), id); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted certificate request %d\n", id)
+	return nil
+}
+
+func certUploadCommand(args []string) error {
+	flags := flag.NewFlagSet("cert upload", flag.ExitOnError)
+	file := flags.String("f", "", "The PEM encoded certificate file to upload, followed by its issuers")
+	id, err := parseWithID(flags, args)
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("providing a certificate file with -f is required")
+	}
+	certificate, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	if err := c.CreateCertificate(context.Background(), id, string(certificate)); err != nil {
+		return err
+	}
+	fmt.Printf("Uploaded the certificate of certificate request %d\n", id)
+	return nil
+}
+
+func certRejectCommand(args []string) error {
+	flags := flag.NewFlagSet("cert reject", flag.ExitOnError)
+	id, err := parseWithID(flags, args)
+	if err != nil {
+		return err
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	if err := c.RejectCertificate(context.Background(), id); err != nil {
+		return err
+	}
+	fmt.Printf("Rejected certificate request %d\n", id)
+	return nil
+}
+
+func certDownloadCommand(args []string) error {
+	flags := flag.NewFlagSet("cert download", flag.ExitOnError)
+	format := flags.String("format", "", "The format of the certificate: pem, der or p7b")
+	chain := flags.String("chain", "", "The certificates to download: leaf, chain, fullchain or root")
+	out := flags.String("out", "", "The file to write the certificate to. It is written to the standard output when not given")
+	id, err := parseWithID(flags, args)
+	if err != nil {
+		return err
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	data, err := c.DownloadCertificate(context.Background(), id, *format, *chain)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*out, data, 0o644)
+}
+
+func accountCreateCommand(args []string) error {
+	flags := flag.NewFlagSet("account create", flag.ExitOnError)
+	username := flags.String("username", "", "The username of the account")
+	password := flags.String("password", "", "The password of the account. It is read from the standard input when not given")
+	output := outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("providing a username with -username is required")
+	}
+	if err := readPassword(password); err != nil {
+		return err
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	id, err := c.CreateAccount(context.Background(), *username, *password)
+	if err != nil {
+		return err
+	}
+	return printID(*output, id, "Created account %d\n")
+}
+
+func accountListCommand(args []string) error {
+	flags := flag.NewFlagSet("account list", flag.ExitOnError)
+	output := outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	accounts, err := c.ListAccounts(context.Background())
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return printJSON(accounts)
+	}
+	rows := [][]string{{"ID", "USERNAME", "ROLE"}}
+	for _, account := range accounts {
+		rows = append(rows, []string{strconv.Itoa(account.ID), account.Username, roleName(account.Permissions)})
+	}
+	return printTable(rows)
+}
+
+func accountPasswdCommand(args []string) error {
+	flags := flag.NewFlagSet("account passwd", flag.ExitOnError)
+	id := flags.Int("id", 0, "The id of the account. Defaults to the account that is logged in")
+	password := flags.String("password", "", "The new password. It is read from the standard input when not given")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	if *id == 0 {
+		if *id, err = c.AccountID(); err != nil {
+			return err
+		}
+	}
+	if err := readPassword(password); err != nil {
+		return err
+	}
+	if err := c.ChangeAccountPassword(context.Background(), *id, *password); err != nil {
+		return err
+	}
+	fmt.Printf("Changed the password of account %d\n", *id)
+	return nil
+}
+
+func readPassword(password *string) error {
+	if *password != "" {
+		return nil
+	}
+	var err error
+	*password, err = promptPassword(bufio.NewReader(os.Stdin), "Password: ")
+	return err
+}
+
+// parseWithID parses the flags of a command that takes the id of a resource, which can come before or after the flags.
+func parseWithID(flags *flag.FlagSet, args []string) (int, error) {
+	var idArg string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		idArg, args = args[0], args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return 0, err
+	}
+	if idArg == "" {
+		idArg = flags.Arg(0)
+	}
+	if idArg == "" {
+		return 0, errors.New("an id is required")
+	}
+	id, err := strconv.Atoi(idArg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %q", idArg)
+	}
+	return id, nil
+}
+
+// outputFlag registers the -o flag of a command, whose value is refused while parsing unless it is table or json,
+// so that a typo doesn't print a table to a script that expects JSON.
+func outputFlag(flags *flag.FlagSet) *string {
+	output := "table"
+	flags.Var((*outputFormat)(&output), "o", "The output `format`: table or json")
+	return &output
+}
+
+type outputFormat string
+
+func (o *outputFormat) String() string {
+	return string(*o)
+}
+
+func (o *outputFormat) Set(value string) error {
+	if value != "table" && value != "json" {
+		return fmt.Errorf("unknown output format %q, expected table or json", value)
+	}
+	*o = outputFormat(value)
+	return nil
+}
+
+func printID(output string, id int, message string) error {
+	if output == "json" {
+		return printJSON(map[string]int{"id": id})
+	}
+	fmt.Printf(message, id)
+	return nil
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func printTable(rows [][]string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func requestStatus(request client.CertificateRequest) string {
+	switch {
+	case request.Certificate == "":
+		return "outstanding"
+	case request.Certificate == "rejected":
+		return "rejected"
+	case request.CSR == "":
+		return "imported"
+	default:
+		return "issued"
+	}
+}
+
+// requestCommonName returns the common name of the CSR of a request, or of its certificate for imported certificates.
+func requestCommonName(request client.CertificateRequest) string {
+	if block, _ := pem.Decode([]byte(request.CSR)); block != nil {
+		if csr, err := x509.ParseCertificateRequest(block.Bytes); err == nil {
+			return csr.Subject.CommonName
+		}
+	}
+	if cert := parseLeaf(request.Certificate); cert != nil {
+		return cert.Subject.CommonName
+	}
+	return ""
+}
+
+func certificateNotAfter(bundle string) string {
+	if cert := parseLeaf(bundle); cert != nil {
+		return cert.NotAfter.UTC().Format("2006-01-02 15:04:05")
+	}
+	return "-"
+}
+
+func parseLeaf(bundle string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(bundle))
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return cert
+}
+
+func optionalID(id int) string {
+	if id == 0 {
+		return "-"
+	}
+	return strconv.Itoa(id)
+}
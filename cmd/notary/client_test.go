@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestOutputFlag(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *string) {
+		flags := flag.NewFlagSet("csr list", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		return flags, outputFlag(flags)
+	}
+	flags, output := newFlags()
+	if err := flags.Parse(nil); err != nil || *output != "table" {
+		t.Fatalf("expected the table format by default, got %q: %v", *output, err)
+	}
+	flags, output = newFlags()
+	if err := flags.Parse([]string{"-o", "json"}); err != nil || *output != "json" {
+		t.Fatalf("expected the json format, got %q: %v", *output, err)
+	}
+	flags, _ = newFlags()
+	if err := flags.Parse([]string{"-o", "jsno"}); err == nil {
+		t.Fatalf("expected an unknown output format to be refused")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configCommand inspects the config of the server.
+//
+//	notary config print
+func configCommand(args []string) error {
+	return runSubcommand("config", args, map[string]func(args []string) error{
+		"print": configPrintCommand,
+	})
+}
+
+// configPrintCommand prints the effective config of the server, merged from the config file, the environment and
+// flags, with its secrets redacted. The config isn't validated, so that a config the server refuses can be inspected.
+//
+//	notary config print -config notary.yaml -port 4000
+func configPrintCommand(args []string) error {
+	flags := flag.NewFlagSet("config print", flag.ExitOnError)
+	c, err := loadConfigYAML(flags, args)
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+// importCommand imports the certificates found in the given PEM files, or in every file under the given directories,
+// into the database of the server. It fails if any certificate couldn't be imported.
+//
+//	notary import -config notary.yaml certs/ extra.pem
+func importCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: notary import -config <config file> <file or directory>...")
+		flags.PrintDefaults()
+	}
+	conf, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no files to import were given")
+	}
+	database, err := db.NewDatabase(conf.DBPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	var imported, duplicates, failures int
+	for _, root := range flags.Args() {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			bundles := db.SplitCertificateBundles(string(data))
+			if len(bundles) == 0 {
+				fmt.Printf("%s: no certificates found\n", path)
+				return nil
+			}
+			for i, bundle := range bundles {
+				id, created, err := database.ImportCertificate(bundle)
+				switch {
+				case errors.Is(err, db.ErrInvalidCertificate):
+					fmt.Printf("%s #%d: %s\n", path, i+1, err)
+					failures++
+				case err != nil:
+					return err
+				case created:
+					fmt.Printf("%s #%d: imported as %d\n", path, i+1, id)
+					imported++
+				default:
+					fmt.Printf("%s #%d: already known as %d\n", path, i+1, id)
+					duplicates++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d imported, %d already known, %d invalid\n", imported, duplicates, failures)
+	if failures > 0 {
+		return fmt.Errorf("%d certificates couldn't be imported", failures)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestImport(t *testing.T) {
+	configPath, dbPath := writeTestConfig(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate key: %s", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "imported.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("couldn't create certificate: %s", err)
+	}
+	dir := filepath.Join(filepath.Dir(dbPath), "certs")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatalf("couldn't create directory: %s", err)
+	}
+	valid := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "valid.pem"), valid, 0o600); err != nil {
+		t.Fatalf("couldn't write certificate: %s", err)
+	}
+	if err := importCommand([]string{"-config", configPath, dir}); err != nil {
+		t.Fatalf("couldn't import certificates: %s", err)
+	}
+
+	invalid := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a certificate")})
+	if err := os.WriteFile(filepath.Join(dir, "invalid.pem"), invalid, 0o600); err != nil {
+		t.Fatalf("couldn't write certificate: %s", err)
+	}
+	err = importCommand([]string{"-config", configPath, dir})
+	if err == nil || err.Error() != "1 certificates couldn't be imported" {
+		t.Fatalf("expected the invalid certificate to be counted as a failure, got %v", err)
+	}
+}
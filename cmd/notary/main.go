@@ -3,47 +3,165 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/canonical/notary/internal/config"
+	"github.com/canonical/notary/internal/logging"
 	"github.com/canonical/notary/internal/server"
+	"github.com/canonical/notary/internal/tracing"
 )
 
+// commands are the subcommands of notary. Running notary without a subcommand starts the server.
+// import, backup, restore, admin and db act on the database of a server on the same host, while the others
+// are clients of the REST API of a server.
+var commands = map[string]func(args []string) error{
+	"import":  importCommand,
+	"backup":  backupCommand,
+	"restore": restoreCommand,
+	"admin":   adminCommand,
+	"db":      dbCommand,
+	"config":  configCommand,
+	"login":   loginCommand,
+	"csr":     csrCommand,
+	"cert":    certCommand,
+	"account": accountCommand,
+}
+
 func main() {
 	log.SetOutput(os.Stderr)
-	configFilePtr := flag.String("config", "", "The config file to be provided to the server")
-	flag.Parse()
-	if *configFilePtr == "" {
-		log.Fatalf("Providing a config file is required.")
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command, ok := commands[os.Args[1]]
+		if !ok {
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+		if err := command(os.Args[2:]); err != nil {
+			log.Fatalf("%s: %s", os.Args[1], err)
+		}
+		return
+	}
+	serve()
+}
+
+func serve() {
+	conf, err := loadConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Couldn't validate config: %s", err)
 	}
-	conf, err := config.Validate(*configFilePtr)
+	// The log level can be changed by reloading the config, but not the format.
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(conf.LogLevel)
+	slog.SetDefault(slog.New(logging.NewHandler(os.Stderr, conf.LogFormat, logLevel)))
+	shutdownTracing, err := tracing.Setup(context.Background(), conf.TracingEndpoint)
 	if err != nil {
-		log.Fatalf("Couldn't validate config file: %s", err)
+		fatal("Couldn't set up tracing", err)
 	}
-	srv, err := server.New(conf.Port, conf.Cert, conf.Key, conf.DBPath, conf.PebbleNotificationsEnabled)
+	srv, err := server.New(conf)
 	if err != nil {
-		log.Fatalf("Couldn't create server: %s", err)
+		fatal("Couldn't create server", err)
 	}
 
-	idleConnsClosed := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloadOnHangup(ctx, srv, logLevel)
+
+	stopped := make(chan struct{})
 	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
-		<-sigint
-		log.Println("Interrupt signal received")
-		if err := srv.Shutdown(context.Background()); err != nil {
-			log.Printf("HTTP server Shutdown error: %v", err)
+		defer close(stopped)
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		sig := <-stop
+		// Restoring the default behaviour of the signals lets a second one stop Notary right away.
+		signal.Stop(stop)
+		slog.Info("Stopping on signal, waiting for the requests in progress", "signal", sig.String(), "timeout", conf.ShutdownTimeout)
+		cancel()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+		defer cancelShutdown()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Server shutdown error", "error", err)
+		}
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			slog.Error("Couldn't export the last traces", "error", err)
 		}
-		close(idleConnsClosed)
 	}()
 
-	log.Printf("Starting server at %s", srv.Addr)
-	if err := srv.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
-		log.Fatalf("HTTP server ListenAndServe: %v", err)
+	slog.Info("Starting server", "address", srv.Addr)
+	if conf.MetricsPort != 0 {
+		slog.Info("Serving metrics", "address", net.JoinHostPort(conf.MetricsBindAddress, strconv.Itoa(conf.MetricsPort)))
+	}
+	if conf.AdminSocketPath != "" {
+		slog.Info("Serving the admin socket", "path", conf.AdminSocketPath)
+	}
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		fatal("HTTP server ListenAndServe", err)
+	}
+	<-stopped
+	slog.Info("Server stopped")
+}
+
+// fatal logs the error that stops the server and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// reloadOnHangup reloads the config of the server, from the same config file, environment and flags
+// it was started with, whenever a SIGHUP signal is received, until the context is done.
+// The log level is changed along with the config of the server.
+func reloadOnHangup(ctx context.Context, srv *server.Server, logLevel *slog.LevelVar) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+		slog.Info("Hangup signal received, reloading config")
+		conf, err := loadConfig(flag.NewFlagSet(os.Args[0], flag.ContinueOnError), os.Args[1:])
+		if err != nil {
+			slog.Error("Couldn't reload config, keeping the current one", "error", err)
+			continue
+		}
+		if err := srv.Reload(conf); err != nil {
+			slog.Error("Couldn't reload config, keeping the current one", "error", err)
+			continue
+		}
+		logLevel.Set(conf.LogLevel)
+		slog.Info("Reloaded config")
+	}
+}
+
+// loadConfig parses the flags of a subcommand, which include the config file of the server and the flags
+// overriding its fields, and returns the validated config. The config file is optional when every required field
+// is set by the environment or by flags.
+func loadConfig(flags *flag.FlagSet, args []string) (config.Config, error) {
+	c, err := loadConfigYAML(flags, args)
+	if err != nil {
+		return config.Config{}, err
+	}
+	conf, err := config.ValidateYAML(c)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("couldn't validate config: %w", err)
+	}
+	return conf, nil
+}
+
+// loadConfigYAML parses the flags of a subcommand like loadConfig, and returns the merged config without validating it.
+func loadConfigYAML(flags *flag.FlagSet, args []string) (config.ConfigYAML, error) {
+	configFilePtr := flags.String("config", "", "The config file of the server")
+	overrides := config.RegisterFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return config.ConfigYAML{}, err
 	}
-	log.Printf("Shutting down server")
-	<-idleConnsClosed
+	return config.Load(*configFilePtr, overrides)
 }
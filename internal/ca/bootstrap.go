@@ -0,0 +1,228 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Files written by Bootstrap in its directory.
+const (
+	BootstrapCACertFile = "ca.pem"
+	BootstrapCAKeyFile  = "ca-key.pem"
+	BootstrapCertFile   = "cert.pem"
+	BootstrapKeyFile    = "key.pem"
+)
+
+const (
+	bootstrapCAValidity = 10 * 365 * 24 * time.Hour
+	// ServingCertificateValidity is the validity of the serving certificates issued by Bootstrap.
+	ServingCertificateValidity = 90 * 24 * time.Hour
+	// ServingCertificateRenewBefore is how long before its expiry a serving certificate is renewed.
+	ServingCertificateRenewBefore = 30 * 24 * time.Hour
+)
+
+// Bootstrap makes sure the given directory holds an internal CA and a serving certificate it issued for the
+// given hostnames, which can be DNS names or IP addresses, so that Notary can serve HTTPS without a certificate
+// provided by the operator. The CA and the certificate are created the first time, and persisted.
+// The serving certificate is issued again when it is due for renewal, when the hostnames change, or when it wasn't
+// issued by the CA. It returns the paths of the certificate, followed by the CA, and of its key, and whether it was issued.
+func Bootstrap(dir string, hostnames []string, now time.Time) (string, string, bool, error) {
+	if len(hostnames) == 0 {
+		return "", "", false, errors.New("no hostnames were given")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", "", false, err
+	}
+	certPath := filepath.Join(dir, BootstrapCertFile)
+	keyPath := filepath.Join(dir, BootstrapKeyFile)
+	internalCA, err := loadOrCreateBootstrapCA(dir, now)
+	if err != nil {
+		return "", "", false, err
+	}
+	if !servingCertificateNeedsRenewal(certPath, keyPath, internalCA, hostnames, now) {
+		return certPath, keyPath, false, nil
+	}
+	certPEM, keyPEM, err := internalCA.issueServingCertificate(hostnames, now)
+	if err != nil {
+		return "", "", false, err
+	}
+	if err := writeFileAtomic(keyPath, keyPEM, 0o600); err != nil {
+		return "", "", false, err
+	}
+	if err := writeFileAtomic(certPath, certPEM, 0o644); err != nil {
+		return "", "", false, err
+	}
+	return certPath, keyPath, true, nil
+}
+
+// loadOrCreateBootstrapCA loads the internal CA persisted in the directory, or creates it if there is none.
+// An existing CA that can't be loaded is an error rather than being replaced, as clients may trust it.
+// A CA that expires before a new serving certificate would is replaced.
+func loadOrCreateBootstrapCA(dir string, now time.Time) (*CA, error) {
+	certPath := filepath.Join(dir, BootstrapCACertFile)
+	keyPath := filepath.Join(dir, BootstrapCAKeyFile)
+	certPEM, certErr := os.ReadFile(certPath)
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	if certErr == nil && keyErr == nil {
+		internalCA, err := Load(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load the internal CA from %s: %w", dir, err)
+		}
+		if now.Add(ServingCertificateValidity).Before(internalCA.Certificate.NotAfter) {
+			return internalCA, nil
+		}
+	} else if !errors.Is(certErr, os.ErrNotExist) || !errors.Is(keyErr, os.ErrNotExist) {
+		return nil, fmt.Errorf("couldn't load the internal CA from %s: %w", dir, errors.Join(certErr, keyErr))
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: "Notary Internal CA"},
+		NotBefore:             now,
+		NotAfter:              now.Add(bootstrapCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := writeFileAtomic(keyPath, keyPEM, 0o600); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(certPath, certPEM, 0o644); err != nil {
+		return nil, err
+	}
+	return Load(certPEM, keyPEM)
+}
+
+// servingCertificateNeedsRenewal reports whether the persisted serving certificate must be issued again.
+func servingCertificateNeedsRenewal(certPath string, keyPath string, internalCA *CA, hostnames []string, now time.Time) bool {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return true
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return true
+	}
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return true
+	}
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return true
+	}
+	if leaf.CheckSignatureFrom(internalCA.Certificate) != nil {
+		return true
+	}
+	if now.Add(ServingCertificateRenewBefore).After(leaf.NotAfter) {
+		return true
+	}
+	var names []string
+	names = append(names, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		names = append(names, ip.String())
+	}
+	wanted := normalizeHostnames(hostnames)
+	slices.Sort(names)
+	return !slices.Equal(names, wanted)
+}
+
+// issueServingCertificate issues a TLS server certificate for the given hostnames with a new key.
+// It returns the PEM encoded certificate followed by the CA chain, and the PEM encoded key.
+func (ca *CA) issueServingCertificate(hostnames []string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: hostnames[0]},
+		NotBefore:             now,
+		NotAfter:              now.Add(ServingCertificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, hostname := range hostnames {
+		if ip := net.ParseIP(hostname); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, hostname)
+		}
+	}
+	if template.NotAfter.After(ca.Certificate.NotAfter) {
+		template.NotAfter = ca.Certificate.NotAfter
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, &key.PublicKey, ca.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), ca.Chain...)
+	return certPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// normalizeHostnames returns the hostnames as they appear in a certificate, sorted.
+func normalizeHostnames(hostnames []string) []string {
+	normalized := make([]string, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		if ip := net.ParseIP(hostname); ip != nil {
+			hostname = ip.String()
+		}
+		normalized = append(normalized, hostname)
+	}
+	slices.Sort(normalized)
+	return normalized
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// writeFileAtomic replaces the file at the given path with the data, so that readers never see a partial file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
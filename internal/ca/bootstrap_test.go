@@ -0,0 +1,117 @@
+package ca_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/ca"
+)
+
+func loadServingCertificate(t *testing.T, certPath string, keyPath string) *x509.Certificate {
+	keyPair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("couldn't load serving certificate: %s", err)
+	}
+	if len(keyPair.Certificate) != 2 {
+		t.Fatalf("expected the serving certificate to be followed by the CA, got %d certificates", len(keyPair.Certificate))
+	}
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		t.Fatalf("couldn't parse serving certificate: %s", err)
+	}
+	return leaf
+}
+
+func TestBootstrap(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	hostnames := []string{"notary.example.com", "127.0.0.1"}
+
+	certPath, keyPath, issued, err := ca.Bootstrap(dir, hostnames, now)
+	if err != nil {
+		t.Fatalf("couldn't bootstrap: %s", err)
+	}
+	if !issued {
+		t.Fatalf("expected a serving certificate to be issued")
+	}
+	leaf := loadServingCertificate(t, certPath, keyPath)
+	if leaf.Subject.CommonName != "notary.example.com" || !slices.Equal(leaf.DNSNames, []string{"notary.example.com"}) {
+		t.Fatalf("unexpected subject %s and DNS names %v", leaf.Subject, leaf.DNSNames)
+	}
+	if len(leaf.IPAddresses) != 1 || leaf.IPAddresses[0].String() != "127.0.0.1" {
+		t.Fatalf("unexpected IP addresses %v", leaf.IPAddresses)
+	}
+	caPEM, err := os.ReadFile(filepath.Join(dir, ca.BootstrapCACertFile))
+	if err != nil {
+		t.Fatalf("couldn't read CA: %s", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "notary.example.com", Roots: roots}); err != nil {
+		t.Fatalf("serving certificate doesn't verify with the internal CA: %s", err)
+	}
+	info, err := os.Stat(keyPath)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected the key to only be readable by its owner, got %v", info.Mode())
+	}
+
+	t.Run("kept while valid", func(t *testing.T) {
+		_, _, issued, err := ca.Bootstrap(dir, []string{"127.0.0.1", "notary.example.com"}, now.Add(24*time.Hour))
+		if err != nil {
+			t.Fatalf("couldn't bootstrap: %s", err)
+		}
+		if issued {
+			t.Fatalf("expected the serving certificate to be kept")
+		}
+	})
+
+	t.Run("renewed before expiry", func(t *testing.T) {
+		later := now.Add(ca.ServingCertificateValidity - ca.ServingCertificateRenewBefore + time.Hour)
+		certPath, keyPath, issued, err := ca.Bootstrap(dir, hostnames, later)
+		if err != nil {
+			t.Fatalf("couldn't bootstrap: %s", err)
+		}
+		if !issued {
+			t.Fatalf("expected the serving certificate to be renewed")
+		}
+		renewed := loadServingCertificate(t, certPath, keyPath)
+		if renewed.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			t.Fatalf("expected a new serving certificate")
+		}
+		if _, err := renewed.Verify(x509.VerifyOptions{DNSName: "notary.example.com", Roots: roots, CurrentTime: later}); err != nil {
+			t.Fatalf("renewed certificate isn't issued by the same CA: %s", err)
+		}
+	})
+
+	t.Run("reissued for new hostnames", func(t *testing.T) {
+		certPath, keyPath, issued, err := ca.Bootstrap(dir, []string{"other.example.com"}, now)
+		if err != nil {
+			t.Fatalf("couldn't bootstrap: %s", err)
+		}
+		if !issued {
+			t.Fatalf("expected the serving certificate to be issued again")
+		}
+		if names := loadServingCertificate(t, certPath, keyPath).DNSNames; !slices.Equal(names, []string{"other.example.com"}) {
+			t.Fatalf("unexpected DNS names %v", names)
+		}
+	})
+}
+
+func TestBootstrapFails(t *testing.T) {
+	if _, _, _, err := ca.Bootstrap(t.TempDir(), nil, time.Now()); err == nil {
+		t.Fatalf("expected bootstrapping without hostnames to fail")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ca.BootstrapCACertFile), []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("couldn't write CA: %s", err)
+	}
+	if _, _, _, err := ca.Bootstrap(dir, []string{"localhost"}, time.Now()); err == nil {
+		t.Fatalf("expected a broken internal CA to be reported rather than replaced")
+	}
+}
@@ -0,0 +1,148 @@
+// Package ca signs certificate requests with a certificate authority loaded from PEM files,
+// shaping the issued certificates with certificate profiles.
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+// ErrCAProfile is returned when signing with a profile that issues CA certificates, which the CA doesn't allow.
+var ErrCAProfile = errors.New("CA profiles are not allowed")
+
+// A CA holds the certificate and private key used to sign certificates,
+// along with the PEM encoded chain that is appended to every certificate it issues.
+// Profiles that issue CA certificates can only be used when AllowCAProfiles is set.
+type CA struct {
+	Certificate     *x509.Certificate
+	Key             crypto.Signer
+	Chain           string
+	AllowCAProfiles bool
+}
+
+// Load parses a PEM encoded CA certificate bundle and its private key.
+// The first certificate in the bundle must be a CA certificate matching the key,
+// and any following certificates are its issuers.
+func Load(certPEM []byte, keyPEM []byte) (*CA, error) {
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if !certificate.IsCA {
+		return nil, errors.New("signing certificate is not a certificate authority")
+	}
+	signer, ok := keyPair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("signing key can't be used to sign certificates")
+	}
+	var chain bytes.Buffer
+	for _, der := range keyPair.Certificate {
+		if err := pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return nil, err
+		}
+	}
+	return &CA{
+		Certificate: certificate,
+		Key:         signer,
+		Chain:       chain.String(),
+	}, nil
+}
+
+// Sign issues a certificate for the given PEM encoded CSR following the given profile.
+// The subject and subject alternative names are copied from the CSR, and the validity is capped by the expiry of the CA.
+// It returns the PEM encoded certificate followed by the CA chain, or ErrCAProfile if the profile issues
+// CA certificates and the CA doesn't allow it.
+func (ca *CA) Sign(csrPEM string, profile db.CertificateProfile) (string, error) {
+	if profile.IsCA && !ca.AllowCAProfiles {
+		return "", ErrCAProfile
+	}
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil {
+		return "", errors.New("PEM Certificate Request string not found or malformed")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return "", fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+	template, err := Template(csr, profile, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if template.NotAfter.After(ca.Certificate.NotAfter) {
+		template.NotAfter = ca.Certificate.NotAfter
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, csr.PublicKey, ca.Key)
+	if err != nil {
+		return "", err
+	}
+	var bundle bytes.Buffer
+	if err := pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		return "", err
+	}
+	bundle.WriteString(ca.Chain)
+	return bundle.String(), nil
+}
+
+// Template builds the certificate template for the given CSR and profile, valid from the given time.
+func Template(csr *x509.CertificateRequest, profile db.CertificateProfile, now time.Time) (*x509.Certificate, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               csr.Subject,
+		DNSNames:              csr.DNSNames,
+		EmailAddresses:        csr.EmailAddresses,
+		IPAddresses:           csr.IPAddresses,
+		URIs:                  csr.URIs,
+		NotBefore:             now,
+		NotAfter:              now.AddDate(0, 0, profile.ValidityDays),
+		BasicConstraintsValid: true,
+		IsCA:                  profile.IsCA,
+		CRLDistributionPoints: profile.CRLDistributionPoints,
+		OCSPServer:            profile.OCSPServers,
+		IssuingCertificateURL: profile.IssuingCertificateURLs,
+	}
+	if profile.IsCA {
+		if profile.MaxPathLen >= 0 {
+			template.MaxPathLen = profile.MaxPathLen
+			template.MaxPathLenZero = profile.MaxPathLen == 0
+		} else {
+			template.MaxPathLen = -1
+		}
+	}
+	for _, usage := range profile.KeyUsage {
+		template.KeyUsage |= db.KeyUsages[usage]
+	}
+	for _, usage := range profile.ExtKeyUsage {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, db.ExtKeyUsages[usage])
+	}
+	for _, policy := range profile.CertificatePolicies {
+		oid, err := db.ParseOID(policy)
+		if err != nil {
+			return nil, err
+		}
+		template.PolicyIdentifiers = append(template.PolicyIdentifiers, oid)
+	}
+	return template, nil
+}
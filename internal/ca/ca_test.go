@@ -0,0 +1,166 @@
+package ca_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/ca"
+	"github.com/canonical/notary/internal/db"
+)
+
+// generateCA creates a self signed CA certificate and returns it with its private key, both PEM encoded.
+func generateCA(t *testing.T, isCA bool, notAfter time.Time) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate key: %s", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("couldn't create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("couldn't marshal key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func generateCSR(t *testing.T) string {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "service.example.com"},
+		DNSNames: []string{"service.example.com"},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	if err != nil {
+		t.Fatalf("couldn't create csr: %s", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+func TestSignWithProfile(t *testing.T) {
+	caCert, caKey := generateCA(t, true, time.Now().AddDate(10, 0, 0))
+	signingCA, err := ca.Load(caCert, caKey)
+	if err != nil {
+		t.Fatalf("couldn't load CA: %s", err)
+	}
+	csr := generateCSR(t)
+	profile := db.CertificateProfile{
+		Name:                   "web",
+		ValidityDays:           30,
+		KeyUsage:               []string{"digital_signature", "key_encipherment"},
+		ExtKeyUsage:            []string{"server_auth", "client_auth"},
+		CertificatePolicies:    []string{"2.23.140.1.2.1"},
+		CRLDistributionPoints:  []string{"http://ca.example.com/crl"},
+		OCSPServers:            []string{"http://ocsp.example.com"},
+		IssuingCertificateURLs: []string{"http://ca.example.com/ca.crt"},
+	}
+
+	bundle, err := signingCA.Sign(csr, profile)
+	if err != nil {
+		t.Fatalf("couldn't sign csr: %s", err)
+	}
+	if err := db.CertificateMatchesCSR(bundle, csr); err != nil {
+		t.Fatalf("issued bundle doesn't pass validation: %s", err)
+	}
+	block, _ := pem.Decode([]byte(bundle))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("couldn't parse issued certificate: %s", err)
+	}
+	if cert.IsCA {
+		t.Fatalf("expected a leaf certificate")
+	}
+	if cert.KeyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment {
+		t.Fatalf("unexpected key usage: %v", cert.KeyUsage)
+	}
+	if !slices.Equal(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}) {
+		t.Fatalf("unexpected extended key usage: %v", cert.ExtKeyUsage)
+	}
+	if len(cert.PolicyIdentifiers) != 1 || cert.PolicyIdentifiers[0].String() != "2.23.140.1.2.1" {
+		t.Fatalf("unexpected certificate policies: %v", cert.PolicyIdentifiers)
+	}
+	if cert.CRLDistributionPoints[0] != "http://ca.example.com/crl" || cert.OCSPServer[0] != "http://ocsp.example.com" || cert.IssuingCertificateURL[0] != "http://ca.example.com/ca.crt" {
+		t.Fatalf("distribution point and AIA urls weren't set")
+	}
+	if cert.Subject.CommonName != "service.example.com" || cert.DNSNames[0] != "service.example.com" {
+		t.Fatalf("subject wasn't copied from the csr")
+	}
+	if days := cert.NotAfter.Sub(cert.NotBefore).Hours() / 24; days != 30 {
+		t.Fatalf("expected a validity of 30 days, got %v", days)
+	}
+}
+
+func TestSignCapsValidityToCA(t *testing.T) {
+	caExpiry := time.Now().AddDate(0, 0, 10).Truncate(time.Second)
+	caCert, caKey := generateCA(t, true, caExpiry)
+	signingCA, err := ca.Load(caCert, caKey)
+	if err != nil {
+		t.Fatalf("couldn't load CA: %s", err)
+	}
+	bundle, err := signingCA.Sign(generateCSR(t), db.DefaultCertificateProfiles()[0])
+	if err != nil {
+		t.Fatalf("couldn't sign csr: %s", err)
+	}
+	block, _ := pem.Decode([]byte(bundle))
+	cert, _ := x509.ParseCertificate(block.Bytes)
+	if !cert.NotAfter.Equal(caExpiry) {
+		t.Fatalf("expected validity to be capped at %s, got %s", caExpiry, cert.NotAfter)
+	}
+}
+
+func TestSignCAProfile(t *testing.T) {
+	caCert, caKey := generateCA(t, true, time.Now().AddDate(10, 0, 0))
+	signingCA, _ := ca.Load(caCert, caKey)
+	profile := db.CertificateProfile{
+		Name:         "intermediate",
+		ValidityDays: 365,
+		KeyUsage:     []string{"cert_sign", "crl_sign"},
+		IsCA:         true,
+		MaxPathLen:   0,
+	}
+	if _, err := signingCA.Sign(generateCSR(t), profile); !errors.Is(err, ca.ErrCAProfile) {
+		t.Fatalf("expected a CA profile to be refused unless allowed, got %v", err)
+	}
+	signingCA.AllowCAProfiles = true
+	bundle, err := signingCA.Sign(generateCSR(t), profile)
+	if err != nil {
+		t.Fatalf("couldn't sign csr: %s", err)
+	}
+	block, _ := pem.Decode([]byte(bundle))
+	cert, _ := x509.ParseCertificate(block.Bytes)
+	if !cert.IsCA || cert.MaxPathLen != 0 || !cert.MaxPathLenZero {
+		t.Fatalf("expected a CA certificate with a path length of 0")
+	}
+}
+
+func TestLoadFails(t *testing.T) {
+	leafCert, leafKey := generateCA(t, false, time.Now().AddDate(1, 0, 0))
+	if _, err := ca.Load(leafCert, leafKey); err == nil {
+		t.Fatalf("expected loading a non CA certificate to fail")
+	}
+	caCert, _ := generateCA(t, true, time.Now().AddDate(1, 0, 0))
+	if _, err := ca.Load(caCert, leafKey); err == nil {
+		t.Fatalf("expected loading a CA with a mismatched key to fail")
+	}
+}
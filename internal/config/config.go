@@ -1,68 +1,295 @@
 package config
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/canonical/notary/internal/ca"
+	"github.com/canonical/notary/internal/db"
+	"github.com/canonical/notary/internal/logging"
 )
 
+// defaultBackupRetention is the number of scheduled backups kept when the retention isn't configured.
+const defaultBackupRetention = 7
+
+// defaultTLSBootstrapDirectory is where the internal CA and the serving certificate are kept when Notary
+// bootstraps its own TLS certificate, relative to the directory of the database.
+const defaultTLSBootstrapDirectory = "tls"
+
+// defaultTLSBootstrapHostnames are the hostnames of the bootstrapped serving certificate when none are configured.
+var defaultTLSBootstrapHostnames = []string{"localhost"}
+
+// defaultShutdownTimeout is how long requests in progress are given to finish when the server stops,
+// when the timeout isn't configured.
+const defaultShutdownTimeout = 10 * time.Second
+
+// defaultCertificateExpiryLimit is the maximum number of certificates whose expiry is exported as a metric,
+// when the limit isn't configured.
+const defaultCertificateExpiryLimit = 1000
+
+// minJWTSecretLength is the minimum length of a configured JWT secret, which matches the size of generated ones.
+const minJWTSecretLength = 32
+
+type CSRPolicyYAML struct {
+	MinRSAKeySize         int      `yaml:"min_rsa_key_size"`
+	AllowedCurves         []string `yaml:"allowed_curves"`
+	RequiredSubjectFields []string `yaml:"required_subject_fields"`
+	AllowedSANPatterns    []string `yaml:"allowed_san_patterns"`
+	ForbiddenSANPatterns  []string `yaml:"forbidden_san_patterns"`
+	ForbidWildcards       bool     `yaml:"forbid_wildcards"`
+	MaxSANs               int      `yaml:"max_sans"`
+	AllowKeyReuse         bool     `yaml:"allow_key_reuse"`
+}
+
+type SigningCAYAML struct {
+	CertPath string `yaml:"cert_path"`
+	KeyPath  string `yaml:"key_path"`
+}
+
+type BackupYAML struct {
+	Directory string `yaml:"directory"`
+	Interval  string `yaml:"interval"`
+	Retention int    `yaml:"retention"`
+}
+
+type TLSBootstrapYAML struct {
+	Directory string   `yaml:"directory"`
+	Hostnames []string `yaml:"hostnames"`
+}
+
+type TLSYAML struct {
+	MinVersion       string   `yaml:"min_version"`
+	CipherSuites     []string `yaml:"cipher_suites"`
+	CurvePreferences []string `yaml:"curve_preferences"`
+	ALPN             []string `yaml:"alpn"`
+}
+
+type HTTPYAML struct {
+	ReadTimeout    string `yaml:"read_timeout"`
+	WriteTimeout   string `yaml:"write_timeout"`
+	IdleTimeout    string `yaml:"idle_timeout"`
+	MaxHeaderBytes int    `yaml:"max_header_bytes"`
+}
+
+type MetricsYAML struct {
+	Port                   int    `yaml:"port"`
+	BindAddress            string `yaml:"bind_address"`
+	ClientCAPath           string `yaml:"client_ca_path"`
+	CertificateExpiry      bool   `yaml:"certificate_expiry"`
+	CertificateExpiryLimit int    `yaml:"certificate_expiry_limit"`
+}
+
+type RateLimitGroupYAML struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"`
+}
+
+type RateLimitYAML struct {
+	TrustedProxies []string           `yaml:"trusted_proxies"`
+	Login          RateLimitGroupYAML `yaml:"login"`
+	Submissions    RateLimitGroupYAML `yaml:"submissions"`
+	API            RateLimitGroupYAML `yaml:"api"`
+}
+
+type QuotasYAML struct {
+	MaxPendingCertificateRequests int `yaml:"max_pending_certificate_requests"`
+}
+
+type LoggingYAML struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type TracingYAML struct {
+	Endpoint string `yaml:"endpoint"`
+}
+
 type ConfigYAML struct {
-	KeyPath             string `yaml:"key_path"`
-	CertPath            string `yaml:"cert_path"`
-	DBPath              string `yaml:"db_path"`
-	Port                int    `yaml:"port"`
-	PebbleNotifications bool   `yaml:"pebble_notifications"`
+	KeyPath             string           `yaml:"key_path"`
+	CertPath            string           `yaml:"cert_path"`
+	DBPath              string           `yaml:"db_path"`
+	Port                int              `yaml:"port"`
+	PebbleNotifications bool             `yaml:"pebble_notifications"`
+	CSRPolicy           CSRPolicyYAML    `yaml:"csr_policy"`
+	SigningCA           SigningCAYAML    `yaml:"signing_ca"`
+	AllowCAProfiles     bool             `yaml:"allow_ca_profiles"`
+	Backup              BackupYAML       `yaml:"backup"`
+	JWTSecret           string           `yaml:"jwt_secret" secret:"true"`
+	TLSBootstrap        TLSBootstrapYAML `yaml:"tls_bootstrap"`
+	BindAddress         string           `yaml:"bind_address"`
+	TLS                 TLSYAML          `yaml:"tls"`
+	HTTP                HTTPYAML         `yaml:"http"`
+	Metrics             MetricsYAML      `yaml:"metrics"`
+	AdminSocket         string           `yaml:"admin_socket"`
+	ShutdownTimeout     string           `yaml:"shutdown_timeout"`
+	Logging             LoggingYAML      `yaml:"logging"`
+	Tracing             TracingYAML      `yaml:"tracing"`
+	RateLimit           RateLimitYAML    `yaml:"rate_limit"`
+	Quotas              QuotasYAML       `yaml:"quotas"`
 }
 
 type Config struct {
 	Key                        []byte
 	Cert                       []byte
+	KeyPath                    string
+	CertPath                   string
 	DBPath                     string
 	Port                       int
 	PebbleNotificationsEnabled bool
+	CSRPolicy                  db.CSRPolicy
+	SigningCACert              []byte
+	SigningCAKey               []byte
+	AllowCAProfiles            bool
+	BackupDirectory            string
+	BackupInterval             time.Duration
+	BackupRetention            int
+	JWTSecret                  []byte
+	TLSBootstrapDirectory      string
+	TLSBootstrapHostnames      []string
+	BindAddress                string
+	TLSMinVersion              uint16
+	TLSCipherSuites            []uint16
+	TLSCurvePreferences        []tls.CurveID
+	TLSNextProtos              []string
+	// ReadTimeout, WriteTimeout and IdleTimeout are disabled when they are 0.
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+	// MetricsPort is 0 when metrics are served on the public port. MetricsClientCA is nil when they are
+	// served over plain HTTP rather than mutual TLS.
+	MetricsPort        int
+	MetricsBindAddress string
+	MetricsClientCA    []byte
+	// MetricsCertificateExpiryLimit is the maximum number of certificates whose expiry is exported as a metric,
+	// and is 0 when it isn't exported.
+	MetricsCertificateExpiryLimit int
+	AdminSocketPath               string
+	ShutdownTimeout               time.Duration
+	LogLevel                      slog.Level
+	LogFormat                     string
+	// TracingEndpoint is the OTLP/HTTP endpoint the traces are exported to, and is empty when tracing is disabled.
+	TracingEndpoint string
+	// RateLimitLogin, RateLimitSubmissions and RateLimitAPI limit the requests of every client to each group of routes.
+	// TrustedProxies are the proxies whose X-Forwarded-For header is trusted to give the address of the client.
+	RateLimitLogin       RateLimit
+	RateLimitSubmissions RateLimit
+	RateLimitAPI         RateLimit
+	TrustedProxies       []netip.Prefix
+	// MaxPendingCertificateRequests is the number of outstanding certificate requests an account can have submitted,
+	// and is 0 when it isn't limited.
+	MaxPendingCertificateRequests int
 }
 
-// Validate opens and processes the given yaml file, and catches errors in the process
+// Validate opens and processes the given yaml file, and catches errors in the process.
+// The fields of the file are overridden by the environment, as described in Load.
 func Validate(filePath string) (Config, error) {
+	c, err := Load(filePath, nil)
+	if err != nil {
+		return Config{}, err
+	}
+	return ValidateYAML(c)
+}
+
+// ValidateYAML processes the given config, reading the files it refers to, and catches errors in the process
+func ValidateYAML(c ConfigYAML) (Config, error) {
 	config := Config{}
-	configYaml, err := os.ReadFile(filePath)
+	if c.CertPath == "" && c.KeyPath != "" {
+		return Config{}, errors.New("`cert_path` is empty")
+	}
+	if c.KeyPath == "" && c.CertPath != "" {
+		return Config{}, errors.New("`key_path` is empty")
+	}
+	if c.DBPath == "" {
+		return Config{}, errors.New("`db_path` is empty")
+	}
+	certPath, keyPath := c.CertPath, c.KeyPath
+	var bootstrapDirectory string
+	var bootstrapHostnames []string
+	if c.CertPath == "" {
+		bootstrapDirectory = c.TLSBootstrap.Directory
+		if bootstrapDirectory == "" {
+			bootstrapDirectory = filepath.Join(filepath.Dir(c.DBPath), defaultTLSBootstrapDirectory)
+		}
+		bootstrapHostnames = c.TLSBootstrap.Hostnames
+		if len(bootstrapHostnames) == 0 {
+			bootstrapHostnames = defaultTLSBootstrapHostnames
+		}
+		// The server issues the certificate when it starts, so that validating a config writes no files.
+		certPath = filepath.Join(bootstrapDirectory, ca.BootstrapCertFile)
+		keyPath = filepath.Join(bootstrapDirectory, ca.BootstrapKeyFile)
+	} else if c.TLSBootstrap.Directory != "" || len(c.TLSBootstrap.Hostnames) > 0 {
+		return Config{}, errors.New("`tls_bootstrap` can't be used along with `cert_path` and `key_path`")
+	}
+	var cert, key []byte
+	if bootstrapDirectory == "" {
+		var err error
+		cert, err = os.ReadFile(certPath)
+		if err != nil {
+			return Config{}, err
+		}
+		key, err = os.ReadFile(keyPath)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+	dbfile, err := os.OpenFile(c.DBPath, os.O_CREATE|os.O_RDONLY, 0o644)
 	if err != nil {
 		return Config{}, err
 	}
-	c := ConfigYAML{}
-	if err := yaml.Unmarshal(configYaml, &c); err != nil {
+	err = dbfile.Close()
+	if err != nil {
 		return Config{}, err
 	}
-	if c.CertPath == "" {
-		return Config{}, errors.New("`cert_path` is empty")
+	if c.Port == 0 {
+		return Config{}, errors.New("`port` is empty")
 	}
-	cert, err := os.ReadFile(c.CertPath)
+	bindAddress, err := parseBindAddress("bind_address", c.BindAddress)
 	if err != nil {
 		return Config{}, err
 	}
-	if c.KeyPath == "" {
-		return Config{}, errors.New("`key_path` is empty")
+	tlsMinVersion, err := parseTLSVersion(c.TLS.MinVersion)
+	if err != nil {
+		return Config{}, err
 	}
-	key, err := os.ReadFile(c.KeyPath)
+	nextProtos, err := parseALPN(c.TLS.ALPN)
 	if err != nil {
 		return Config{}, err
 	}
-	if c.DBPath == "" {
-		return Config{}, errors.New("`db_path` is empty")
+	cipherSuites, err := parseCipherSuites(c.TLS.CipherSuites, tlsMinVersion, nextProtos)
+	if err != nil {
+		return Config{}, err
 	}
-	dbfile, err := os.OpenFile(c.DBPath, os.O_CREATE|os.O_RDONLY, 0o644)
+	curvePreferences, err := parseCurves(c.TLS.CurvePreferences)
 	if err != nil {
 		return Config{}, err
 	}
-	err = dbfile.Close()
+	readTimeout, err := parseTimeout("read_timeout", c.HTTP.ReadTimeout, defaultReadTimeout)
 	if err != nil {
 		return Config{}, err
 	}
-	if c.Port == 0 {
-		return Config{}, errors.New("`port` is empty")
+	writeTimeout, err := parseTimeout("write_timeout", c.HTTP.WriteTimeout, defaultWriteTimeout)
+	if err != nil {
+		return Config{}, err
+	}
+	idleTimeout, err := parseTimeout("idle_timeout", c.HTTP.IdleTimeout, readTimeout)
+	if err != nil {
+		return Config{}, err
+	}
+	maxHeaderBytes := c.HTTP.MaxHeaderBytes
+	if maxHeaderBytes < 0 {
+		return Config{}, errors.New("`http.max_header_bytes` can't be negative")
+	}
+	if maxHeaderBytes == 0 {
+		maxHeaderBytes = defaultMaxHeaderBytes
 	}
 	if c.PebbleNotifications {
 		_, err := exec.LookPath("pebble")
@@ -70,11 +297,181 @@ func Validate(filePath string) (Config, error) {
 			return Config{}, fmt.Errorf("pebble binary not found: %w", err)
 		}
 	}
+	csrPolicy := db.CSRPolicy{
+		MinRSAKeySize:         c.CSRPolicy.MinRSAKeySize,
+		AllowedCurves:         c.CSRPolicy.AllowedCurves,
+		RequiredSubjectFields: c.CSRPolicy.RequiredSubjectFields,
+		AllowedSANPatterns:    c.CSRPolicy.AllowedSANPatterns,
+		ForbiddenSANPatterns:  c.CSRPolicy.ForbiddenSANPatterns,
+		ForbidWildcards:       c.CSRPolicy.ForbidWildcards,
+		MaxSANs:               c.CSRPolicy.MaxSANs,
+		AllowKeyReuse:         c.CSRPolicy.AllowKeyReuse,
+	}
+	if err := csrPolicy.Validate(); err != nil {
+		return Config{}, fmt.Errorf("`csr_policy` is invalid: %w", err)
+	}
+	var signingCACert, signingCAKey []byte
+	if c.SigningCA.CertPath != "" || c.SigningCA.KeyPath != "" {
+		if c.SigningCA.CertPath == "" {
+			return Config{}, errors.New("`signing_ca.cert_path` is empty")
+		}
+		if c.SigningCA.KeyPath == "" {
+			return Config{}, errors.New("`signing_ca.key_path` is empty")
+		}
+		signingCACert, err = os.ReadFile(c.SigningCA.CertPath)
+		if err != nil {
+			return Config{}, err
+		}
+		signingCAKey, err = os.ReadFile(c.SigningCA.KeyPath)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+	var backupInterval time.Duration
+	backupRetention := c.Backup.Retention
+	if c.Backup.Directory != "" {
+		if c.Backup.Interval == "" {
+			return Config{}, errors.New("`backup.interval` is empty")
+		}
+		backupInterval, err = time.ParseDuration(c.Backup.Interval)
+		if err != nil {
+			return Config{}, fmt.Errorf("`backup.interval` is invalid: %w", err)
+		}
+		if backupInterval < time.Minute {
+			return Config{}, errors.New("`backup.interval` must be at least 1m")
+		}
+		if backupRetention < 0 {
+			return Config{}, errors.New("`backup.retention` can't be negative")
+		}
+		if backupRetention == 0 {
+			backupRetention = defaultBackupRetention
+		}
+	}
+	metricsBindAddress, metricsClientCA, err := validateMetrics(c)
+	if err != nil {
+		return Config{}, err
+	}
+	certificateExpiryLimit, err := validateCertificateExpiry(c.Metrics)
+	if err != nil {
+		return Config{}, err
+	}
+	if c.AdminSocket != "" {
+		if err := validateAdminSocket(c.AdminSocket); err != nil {
+			return Config{}, err
+		}
+	}
+	shutdownTimeout := defaultShutdownTimeout
+	if c.ShutdownTimeout != "" {
+		shutdownTimeout, err = time.ParseDuration(c.ShutdownTimeout)
+		if err != nil {
+			return Config{}, fmt.Errorf("`shutdown_timeout` is invalid: %w", err)
+		}
+		if shutdownTimeout <= 0 {
+			return Config{}, errors.New("`shutdown_timeout` must be positive")
+		}
+	}
+	logLevel, logFormat, err := validateLogging(c.Logging)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := validateTracing(c.Tracing); err != nil {
+		return Config{}, err
+	}
+	rateLimitLogin, err := validateRateLimit("login", c.RateLimit.Login)
+	if err != nil {
+		return Config{}, err
+	}
+	rateLimitSubmissions, err := validateRateLimit("submissions", c.RateLimit.Submissions)
+	if err != nil {
+		return Config{}, err
+	}
+	rateLimitAPI, err := validateRateLimit("api", c.RateLimit.API)
+	if err != nil {
+		return Config{}, err
+	}
+	trustedProxies, err := parseTrustedProxies(c.RateLimit.TrustedProxies)
+	if err != nil {
+		return Config{}, err
+	}
+	if c.Quotas.MaxPendingCertificateRequests < 0 {
+		return Config{}, errors.New("`quotas.max_pending_certificate_requests` can't be negative")
+	}
+	if c.JWTSecret != "" && len(c.JWTSecret) < minJWTSecretLength {
+		return Config{}, fmt.Errorf("`jwt_secret` must be at least %d characters long", minJWTSecretLength)
+	}
 
 	config.Cert = cert
 	config.Key = key
+	config.CertPath = certPath
+	config.KeyPath = keyPath
 	config.DBPath = c.DBPath
 	config.Port = c.Port
 	config.PebbleNotificationsEnabled = c.PebbleNotifications
+	config.CSRPolicy = csrPolicy
+	config.SigningCACert = signingCACert
+	config.SigningCAKey = signingCAKey
+	config.AllowCAProfiles = c.AllowCAProfiles
+	config.BackupDirectory = c.Backup.Directory
+	config.BackupInterval = backupInterval
+	config.BackupRetention = backupRetention
+	if c.JWTSecret != "" {
+		config.JWTSecret = []byte(c.JWTSecret)
+	}
+	config.TLSBootstrapDirectory = bootstrapDirectory
+	config.TLSBootstrapHostnames = bootstrapHostnames
+	config.BindAddress = bindAddress
+	config.TLSMinVersion = tlsMinVersion
+	config.TLSCipherSuites = cipherSuites
+	config.TLSCurvePreferences = curvePreferences
+	config.TLSNextProtos = nextProtos
+	config.ReadTimeout = readTimeout
+	config.WriteTimeout = writeTimeout
+	config.IdleTimeout = idleTimeout
+	config.MaxHeaderBytes = maxHeaderBytes
+	config.MetricsPort = c.Metrics.Port
+	config.MetricsBindAddress = metricsBindAddress
+	config.MetricsClientCA = metricsClientCA
+	config.MetricsCertificateExpiryLimit = certificateExpiryLimit
+	config.AdminSocketPath = c.AdminSocket
+	config.ShutdownTimeout = shutdownTimeout
+	config.LogLevel = logLevel
+	config.LogFormat = logFormat
+	config.TracingEndpoint = c.Tracing.Endpoint
+	config.RateLimitLogin = rateLimitLogin
+	config.RateLimitSubmissions = rateLimitSubmissions
+	config.RateLimitAPI = rateLimitAPI
+	config.TrustedProxies = trustedProxies
+	config.MaxPendingCertificateRequests = c.Quotas.MaxPendingCertificateRequests
 	return config, nil
 }
+
+// validateLogging returns the level and the format of the logs, which default to info and text.
+func validateLogging(c LoggingYAML) (slog.Level, string, error) {
+	level := slog.LevelInfo
+	if c.Level != "" {
+		var err error
+		level, err = logging.ParseLevel(c.Level)
+		if err != nil {
+			return 0, "", fmt.Errorf("`logging.level`: %w", err)
+		}
+	}
+	switch c.Format {
+	case "":
+		return level, logging.FormatText, nil
+	case logging.FormatText, logging.FormatJSON:
+		return level, c.Format, nil
+	}
+	return 0, "", fmt.Errorf("`logging.format` must be text or json, got %q", c.Format)
+}
+
+// validateTracing checks the OTLP/HTTP endpoint the traces are exported to, when tracing is enabled.
+func validateTracing(c TracingYAML) error {
+	if c.Endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("`tracing.endpoint` must be an http or https URL, such as http://localhost:4318/v1/traces, got %q", c.Endpoint)
+	}
+	return nil
+}
@@ -1,10 +1,16 @@
 package config_test
 
 import (
+	"crypto/tls"
+	"flag"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/canonical/notary/internal/config"
 )
@@ -35,6 +41,57 @@ db_path: "./certs.db"
 port: 8000`
 	invalidYAMLConfig = `just_an=invalid
 yaml.here`
+	invalidCSRPolicyConfig = `key_path:  "./key_test.pem"
+cert_path: "./cert_test.pem"
+db_path: "./certs.db"
+port: 8000
+csr_policy:
+  allowed_curves: ["P-256", "curve25519"]`
+	noSigningCAKeyConfig = `key_path:  "./key_test.pem"
+cert_path: "./cert_test.pem"
+db_path: "./certs.db"
+port: 8000
+signing_ca:
+  cert_path: "./cert_test.pem"`
+	csrPolicyConfig = `key_path:  "./key_test.pem"
+cert_path: "./cert_test.pem"
+db_path: "./certs.db"
+port: 8000
+csr_policy:
+  min_rsa_key_size: 2048
+  allowed_curves: ["P-256", "P-384"]
+  required_subject_fields: ["common_name"]
+  allowed_san_patterns: ["*.example.com"]
+  forbid_wildcards: true
+  max_sans: 5`
+	backupConfig = `key_path:  "./key_test.pem"
+cert_path: "./cert_test.pem"
+db_path: "./certs.db"
+port: 8000
+backup:
+  directory: "./backups"
+  interval: 12h`
+	listenerConfig = `key_path:  "./key_test.pem"
+cert_path: "./cert_test.pem"
+db_path: "./certs.db"
+port: 8000
+bind_address: "[::1]"
+tls:
+  min_version: "1.2"
+  cipher_suites: ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"]
+  curve_preferences: ["X25519", "P256"]
+  alpn: ["http/1.1"]
+http:
+  read_timeout: 5s
+  write_timeout: 0s
+  max_header_bytes: 65536`
+	shortBackupIntervalConfig = `key_path:  "./key_test.pem"
+cert_path: "./cert_test.pem"
+db_path: "./certs.db"
+port: 8000
+backup:
+  directory: "./backups"
+  interval: 10s`
 )
 
 func TestMain(m *testing.M) {
@@ -92,6 +149,250 @@ func TestGoodConfigSuccess(t *testing.T) {
 	}
 }
 
+func TestCSRPolicyConfigSuccess(t *testing.T) {
+	writeConfigErr := os.WriteFile("config.yaml", []byte(csrPolicyConfig), 0o644)
+	if writeConfigErr != nil {
+		t.Fatalf("Error writing config file")
+	}
+	conf, err := config.Validate("config.yaml")
+	if err != nil {
+		t.Fatalf("Error occured: %s", err)
+	}
+	if conf.CSRPolicy.MinRSAKeySize != 2048 {
+		t.Fatalf("Minimum RSA key size was not configured correctly")
+	}
+	if len(conf.CSRPolicy.AllowedCurves) != 2 {
+		t.Fatalf("Allowed curves were not configured correctly")
+	}
+	if !conf.CSRPolicy.ForbidWildcards || conf.CSRPolicy.MaxSANs != 5 {
+		t.Fatalf("SAN rules were not configured correctly")
+	}
+}
+
+func TestBackupConfigSuccess(t *testing.T) {
+	writeConfigErr := os.WriteFile("config.yaml", []byte(backupConfig), 0o644)
+	if writeConfigErr != nil {
+		t.Fatalf("Error writing config file")
+	}
+	conf, err := config.Validate("config.yaml")
+	if err != nil {
+		t.Fatalf("Error occured: %s", err)
+	}
+	if conf.BackupDirectory != "./backups" || conf.BackupInterval != 12*time.Hour {
+		t.Fatalf("Backups were not configured correctly")
+	}
+	if conf.BackupRetention != 7 {
+		t.Fatalf("Expected the default backup retention, got %d", conf.BackupRetention)
+	}
+}
+
+func TestListenerConfigSuccess(t *testing.T) {
+	writeConfigErr := os.WriteFile("config.yaml", []byte(listenerConfig), 0o644)
+	if writeConfigErr != nil {
+		t.Fatalf("Error writing config file")
+	}
+	conf, err := config.Validate("config.yaml")
+	if err != nil {
+		t.Fatalf("Error occured: %s", err)
+	}
+	if conf.BindAddress != "::1" {
+		t.Fatalf("Bind address was not configured correctly: %q", conf.BindAddress)
+	}
+	if conf.TLSMinVersion != tls.VersionTLS12 || len(conf.TLSCipherSuites) != 2 || conf.TLSCipherSuites[1] != tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256 {
+		t.Fatalf("TLS versions and cipher suites were not configured correctly")
+	}
+	if !slices.Equal(conf.TLSCurvePreferences, []tls.CurveID{tls.X25519, tls.CurveP256}) || !slices.Equal(conf.TLSNextProtos, []string{"http/1.1"}) {
+		t.Fatalf("TLS curves and ALPN were not configured correctly")
+	}
+	if conf.ReadTimeout != 5*time.Second || conf.WriteTimeout != 0 || conf.IdleTimeout != 5*time.Second || conf.MaxHeaderBytes != 65536 {
+		t.Fatalf("HTTP timeouts and limits were not configured correctly")
+	}
+
+	writeConfigErr = os.WriteFile("config.yaml", []byte(validConfig+"\nmetrics:\n  port: 9090\nadmin_socket: ./admin.sock"), 0o644)
+	if writeConfigErr != nil {
+		t.Fatalf("Error writing config file")
+	}
+	conf, err = config.Validate("config.yaml")
+	if err != nil {
+		t.Fatalf("Error occured: %s", err)
+	}
+	if conf.BindAddress != "" || conf.TLSMinVersion != tls.VersionTLS12 || !slices.Equal(conf.TLSNextProtos, []string{"h2", "http/1.1"}) {
+		t.Fatalf("Unexpected default listener config")
+	}
+	if conf.ReadTimeout != 10*time.Second || conf.WriteTimeout != 10*time.Second || conf.MaxHeaderBytes != 1<<20 {
+		t.Fatalf("Unexpected default HTTP timeouts and limits")
+	}
+	if conf.ShutdownTimeout != 10*time.Second {
+		t.Fatalf("Unexpected default shutdown timeout %s", conf.ShutdownTimeout)
+	}
+	if conf.MetricsPort != 9090 || conf.MetricsClientCA != nil || conf.AdminSocketPath != "./admin.sock" {
+		t.Fatalf("Metrics and admin listeners were not configured correctly")
+	}
+	if conf.TracingEndpoint != "" {
+		t.Fatalf("Unexpected default tracing endpoint %q", conf.TracingEndpoint)
+	}
+	if conf.MetricsCertificateExpiryLimit != 0 {
+		t.Fatalf("Expected the expiry of certificates not to be exported by default")
+	}
+}
+
+func TestBadListenerConfigFail(t *testing.T) {
+	cases := []struct {
+		Name          string
+		Listener      string
+		ExpectedError string
+	}{
+		{"hostname bind address", "bind_address: example.com", "`bind_address` must be an IP address"},
+		{"old tls version", "tls:\n  min_version: \"1.0\"", "`tls.min_version` must be 1.2 or 1.3"},
+		{"unknown cipher suite", "tls:\n  cipher_suites: [TLS_FOO]", "unknown cipher suite \"TLS_FOO\""},
+		{"insecure cipher suite", "tls:\n  cipher_suites: [TLS_RSA_WITH_RC4_128_SHA]", "TLS_RSA_WITH_RC4_128_SHA is insecure"},
+		{"tls 1.3 cipher suite", "tls:\n  cipher_suites: [TLS_AES_128_GCM_SHA256]", "is a TLS 1.3 cipher suite"},
+		{"cipher suites with tls 1.3", "tls:\n  min_version: \"1.3\"\n  cipher_suites: [TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256]", "can't be set when `tls.min_version` is 1.3"},
+		{"cipher suites without http/2 ones", "tls:\n  cipher_suites: [TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384]", "when `tls.alpn` includes h2"},
+		{"unknown curve", "tls:\n  curve_preferences: [P-256]", "unknown curve \"P-256\""},
+		{"unsupported alpn", "tls:\n  alpn: [h3, http/1.1]", "unsupported protocol \"h3\""},
+		{"alpn without http/1.1", "tls:\n  alpn: [h2]", "`tls.alpn` must include http/1.1"},
+		{"invalid timeout", "http:\n  read_timeout: soon", "`http.read_timeout` is invalid"},
+		{"negative timeout", "http:\n  idle_timeout: -1s", "`http.idle_timeout` can't be negative"},
+		{"negative max header bytes", "http:\n  max_header_bytes: -1", "`http.max_header_bytes` can't be negative"},
+		{"metrics without port", "metrics:\n  bind_address: 127.0.0.1", "`metrics.port` is empty"},
+		{"metrics on the public port", "metrics:\n  port: 8000", "`metrics.port` must be different from `port`"},
+		{"invalid metrics client ca", "metrics:\n  port: 9090\n  client_ca_path: ./cert_test.pem", "no PEM encoded certificate found"},
+		{"certificate expiry limit without certificate expiry", "metrics:\n  certificate_expiry_limit: 10", "`metrics.certificate_expiry` isn't enabled"},
+		{"negative certificate expiry limit", "metrics:\n  certificate_expiry: true\n  certificate_expiry_limit: -1", "`metrics.certificate_expiry_limit` can't be negative"},
+		{"invalid shutdown timeout", "shutdown_timeout: 10", "`shutdown_timeout` is invalid"},
+		{"zero shutdown timeout", "shutdown_timeout: 0s", "`shutdown_timeout` must be positive"},
+		{"admin socket in a missing directory", "admin_socket: ./missing/admin.sock", "`admin_socket`: stat missing"},
+		{"tracing endpoint without scheme", "tracing:\n  endpoint: localhost:4318", "`tracing.endpoint` must be an http or https URL"},
+		{"tracing endpoint with grpc scheme", "tracing:\n  endpoint: grpc://localhost:4317", "`tracing.endpoint` must be an http or https URL"},
+		{"negative rate limit", "rate_limit:\n  login:\n    requests_per_minute: -1", "`rate_limit.login.requests_per_minute` can't be negative"},
+		{"burst without rate limit", "rate_limit:\n  api:\n    burst: 10", "`rate_limit.api.burst` is set but `rate_limit.api.requests_per_minute` isn't"},
+		{"hostname trusted proxy", "rate_limit:\n  trusted_proxies: [proxy.example.com]", "`rate_limit.trusted_proxies` must be IP addresses or CIDR ranges"},
+		{"negative pending certificate requests quota", "quotas:\n  max_pending_certificate_requests: -1", "`quotas.max_pending_certificate_requests` can't be negative"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := os.WriteFile("config.yaml", []byte(validConfig+"\n"+tc.Listener), 0o644)
+			if err != nil {
+				t.Fatalf("Failed writing config file: %v", err)
+			}
+			_, err = config.Validate("config.yaml")
+			if err == nil {
+				t.Fatalf("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tc.ExpectedError) {
+				t.Fatalf("Expected error not found: %s", err)
+			}
+		})
+	}
+}
+
+func TestLoggingConfig(t *testing.T) {
+	cases := []struct {
+		Name           string
+		Logging        string
+		ExpectedLevel  slog.Level
+		ExpectedFormat string
+		ExpectedError  string
+	}{
+		{"default", "", slog.LevelInfo, "text", ""},
+		{"json at debug level", "logging:\n  level: debug\n  format: json", slog.LevelDebug, "json", ""},
+		{"uppercase level", "logging:\n  level: WARN", slog.LevelWarn, "text", ""},
+		{"unknown level", "logging:\n  level: verbose", 0, "", "`logging.level`: unknown log level \"verbose\""},
+		{"unknown format", "logging:\n  format: logfmt", 0, "", "`logging.format` must be text or json"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := os.WriteFile("config.yaml", []byte(validConfig+"\n"+tc.Logging), 0o644)
+			if err != nil {
+				t.Fatalf("Failed writing config file: %v", err)
+			}
+			conf, err := config.Validate("config.yaml")
+			if tc.ExpectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+					t.Fatalf("Expected error %q, got %v", tc.ExpectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error occured: %s", err)
+			}
+			if conf.LogLevel != tc.ExpectedLevel || conf.LogFormat != tc.ExpectedFormat {
+				t.Fatalf("Logging was not configured correctly: %s %s", conf.LogLevel, conf.LogFormat)
+			}
+		})
+	}
+}
+
+func TestTracingConfigSuccess(t *testing.T) {
+	err := os.WriteFile("config.yaml", []byte(validConfig+"\ntracing:\n  endpoint: https://collector:4318/v1/traces"), 0o644)
+	if err != nil {
+		t.Fatalf("Failed writing config file: %v", err)
+	}
+	conf, err := config.Validate("config.yaml")
+	if err != nil {
+		t.Fatalf("Error occured: %s", err)
+	}
+	if conf.TracingEndpoint != "https://collector:4318/v1/traces" {
+		t.Fatalf("Tracing was not configured correctly: %q", conf.TracingEndpoint)
+	}
+}
+
+func TestCertificateExpiryConfigSuccess(t *testing.T) {
+	for yaml, expected := range map[string]int{
+		"metrics:\n  certificate_expiry: true":                                 1000,
+		"metrics:\n  certificate_expiry: true\n  certificate_expiry_limit: 50": 50,
+	} {
+		if err := os.WriteFile("config.yaml", []byte(validConfig+"\n"+yaml), 0o644); err != nil {
+			t.Fatalf("Failed writing config file: %v", err)
+		}
+		conf, err := config.Validate("config.yaml")
+		if err != nil {
+			t.Fatalf("Error occured: %s", err)
+		}
+		if conf.MetricsCertificateExpiryLimit != expected || conf.MetricsPort != 0 {
+			t.Fatalf("Expected a limit of %d, got %d", expected, conf.MetricsCertificateExpiryLimit)
+		}
+	}
+}
+
+func TestRateLimitConfigSuccess(t *testing.T) {
+	rateLimit := `rate_limit:
+  trusted_proxies: ["10.0.0.1", "fd00::/8", "192.168.1.7/16"]
+  login:
+    requests_per_minute: 10
+  submissions:
+    requests_per_minute: 60
+    burst: 5
+quotas:
+  max_pending_certificate_requests: 20`
+	if err := os.WriteFile("config.yaml", []byte(validConfig+"\n"+rateLimit), 0o644); err != nil {
+		t.Fatalf("Failed writing config file: %v", err)
+	}
+	conf, err := config.Validate("config.yaml")
+	if err != nil {
+		t.Fatalf("Error occured: %s", err)
+	}
+	if conf.RateLimitLogin != (config.RateLimit{RequestsPerMinute: 10, Burst: 10}) {
+		t.Fatalf("Expected the burst to default to the rate, got %+v", conf.RateLimitLogin)
+	}
+	if conf.RateLimitSubmissions != (config.RateLimit{RequestsPerMinute: 60, Burst: 5}) || conf.RateLimitAPI != (config.RateLimit{}) {
+		t.Fatalf("Rate limits were not configured correctly: %+v, %+v", conf.RateLimitSubmissions, conf.RateLimitAPI)
+	}
+	var proxies []string
+	for _, proxy := range conf.TrustedProxies {
+		proxies = append(proxies, proxy.String())
+	}
+	if !slices.Equal(proxies, []string{"10.0.0.1/32", "fd00::/8", "192.168.0.0/16"}) {
+		t.Fatalf("Trusted proxies were not configured correctly: %v", proxies)
+	}
+	if conf.MaxPendingCertificateRequests != 20 {
+		t.Fatalf("Quota was not configured correctly: %d", conf.MaxPendingCertificateRequests)
+	}
+}
+
 func TestBadConfigFail(t *testing.T) {
 	cases := []struct {
 		Name          string
@@ -104,6 +405,9 @@ func TestBadConfigFail(t *testing.T) {
 		{"wrong cert path", wrongCertPathConfig, "no such file or directory"},
 		{"wrong key path", wrongKeyPathConfig, "no such file or directory"},
 		{"invalid yaml", invalidYAMLConfig, "unmarshal errors"},
+		{"no signing ca key path", noSigningCAKeyConfig, "`signing_ca.key_path` is empty"},
+		{"short backup interval", shortBackupIntervalConfig, "`backup.interval` must be at least 1m"},
+		{"invalid csr policy", invalidCSRPolicyConfig, "`csr_policy` is invalid: unknown curve \"curve25519\""},
 	}
 
 	for _, tc := range cases {
@@ -121,3 +425,128 @@ func TestBadConfigFail(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigOverrides(t *testing.T) {
+	if err := os.WriteFile("config.yaml", []byte(csrPolicyConfig), 0o644); err != nil {
+		t.Fatalf("Error writing config file")
+	}
+	t.Setenv("NOTARY_PORT", "9000")
+	t.Setenv("NOTARY_DB_PATH", "./env.db")
+	t.Setenv("NOTARY_CSR_POLICY_ALLOWED_CURVES", "P-521, P-256")
+	t.Setenv("NOTARY_PEBBLE_NOTIFICATIONS", "false")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	overrides := config.RegisterFlags(flags)
+	err := flags.Parse([]string{"-db-path", "./flag.db", "-csr-policy.max-sans", "10", "-allow-ca-profiles"})
+	if err != nil {
+		t.Fatalf("Couldn't parse flags: %s", err)
+	}
+	c, err := config.Load("config.yaml", overrides)
+	if err != nil {
+		t.Fatalf("Couldn't load config: %s", err)
+	}
+	if c.Port != 9000 {
+		t.Errorf("Expected the environment to override the port, got %d", c.Port)
+	}
+	if c.DBPath != "./flag.db" {
+		t.Errorf("Expected flags to take precedence over the environment, got %s", c.DBPath)
+	}
+	if c.CertPath != "./cert_test.pem" {
+		t.Errorf("Expected the file to be used when there are no overrides, got %s", c.CertPath)
+	}
+	if strings.Join(c.CSRPolicy.AllowedCurves, ",") != "P-521,P-256" {
+		t.Errorf("Expected the allowed curves to be overridden, got %v", c.CSRPolicy.AllowedCurves)
+	}
+	if c.CSRPolicy.MaxSANs != 10 || c.CSRPolicy.MinRSAKeySize != 2048 {
+		t.Errorf("Expected only the overridden csr policy fields to change, got %+v", c.CSRPolicy)
+	}
+	if !c.AllowCAProfiles {
+		t.Errorf("Expected the boolean flag to be set")
+	}
+	conf, err := config.ValidateYAML(c)
+	if err != nil {
+		t.Fatalf("Couldn't validate config: %s", err)
+	}
+	if conf.Port != 9000 || conf.DBPath != "./flag.db" {
+		t.Errorf("Expected the overrides to be validated, got port %d and db path %s", conf.Port, conf.DBPath)
+	}
+
+	t.Setenv("NOTARY_PORT", "not-a-port")
+	if _, err := config.Load("config.yaml", nil); err == nil || !strings.Contains(err.Error(), "NOTARY_PORT") {
+		t.Errorf("Expected an invalid environment variable to be reported, got %v", err)
+	}
+}
+
+func TestConfigSecrets(t *testing.T) {
+	if err := os.WriteFile("config.yaml", []byte(validConfig), 0o644); err != nil {
+		t.Fatalf("Error writing config file")
+	}
+	secret := strings.Repeat("s", 40)
+	if err := os.WriteFile("jwt_secret", []byte(secret+"\n"), 0o600); err != nil {
+		t.Fatalf("Error writing secret file")
+	}
+	t.Setenv("NOTARY_JWT_SECRET_FILE", "jwt_secret")
+
+	conf, err := config.Validate("config.yaml")
+	if err != nil {
+		t.Fatalf("Couldn't validate config: %s", err)
+	}
+	if string(conf.JWTSecret) != secret {
+		t.Errorf("Expected the secret to be read from the file, got %q", conf.JWTSecret)
+	}
+
+	c, err := config.Load("config.yaml", nil)
+	if err != nil {
+		t.Fatalf("Couldn't load config: %s", err)
+	}
+	if c.Redacted().JWTSecret != "<redacted>" || c.JWTSecret != secret {
+		t.Errorf("Expected only the copy of the config to be redacted")
+	}
+
+	t.Setenv("NOTARY_JWT_SECRET", secret)
+	if _, err := config.Load("config.yaml", nil); err == nil {
+		t.Errorf("Expected setting a secret both directly and from a file to fail")
+	}
+
+	os.Unsetenv("NOTARY_JWT_SECRET_FILE")
+	t.Setenv("NOTARY_JWT_SECRET", "short")
+	if _, err := config.Validate("config.yaml"); err == nil || !strings.Contains(err.Error(), "jwt_secret") {
+		t.Errorf("Expected a short secret to be refused, got %v", err)
+	}
+}
+
+func TestTLSBootstrapConfigSuccess(t *testing.T) {
+	bootstrapConfig := `db_path: "./bootstrap/certs.db"
+port: 8000
+tls_bootstrap:
+  hostnames: ["notary.example.com", "10.0.0.1"]`
+	if err := os.MkdirAll("bootstrap", 0o755); err != nil {
+		t.Fatalf("Error creating directory")
+	}
+	if err := os.WriteFile("config.yaml", []byte(bootstrapConfig), 0o644); err != nil {
+		t.Fatalf("Error writing config file")
+	}
+	conf, err := config.Validate("config.yaml")
+	if err != nil {
+		t.Fatalf("Error occurred: %s", err)
+	}
+	if conf.TLSBootstrapDirectory != filepath.Join("bootstrap", "tls") {
+		t.Fatalf("Expected the internal CA to be kept next to the database, got %s", conf.TLSBootstrapDirectory)
+	}
+	if conf.CertPath != filepath.Join("bootstrap", "tls", "cert.pem") || conf.KeyPath != filepath.Join("bootstrap", "tls", "key.pem") {
+		t.Fatalf("Expected the bootstrapped serving certificate to be used, got %s and %s", conf.CertPath, conf.KeyPath)
+	}
+	if _, err := os.Stat(conf.TLSBootstrapDirectory); !os.IsNotExist(err) {
+		t.Fatalf("Expected validating the config not to bootstrap a serving certificate, got %v", err)
+	}
+
+	withCertificate := validConfig + `
+tls_bootstrap:
+  hostnames: ["notary.example.com"]`
+	if err := os.WriteFile("config.yaml", []byte(withCertificate), 0o644); err != nil {
+		t.Fatalf("Error writing config file")
+	}
+	if _, err := config.Validate("config.yaml"); err == nil || !strings.Contains(err.Error(), "`tls_bootstrap`") {
+		t.Fatalf("Expected tls_bootstrap along with a certificate to be refused, got %v", err)
+	}
+}
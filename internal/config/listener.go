@@ -0,0 +1,214 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Defaults of the listener, which match the ones Notary used before they were configurable.
+const (
+	defaultReadTimeout    = 10 * time.Second
+	defaultWriteTimeout   = 10 * time.Second
+	defaultMaxHeaderBytes = 1 << 20
+)
+
+// ALPN protocols supported by the server.
+const (
+	alpnHTTP2 = "h2"
+	alpnHTTP1 = "http/1.1"
+)
+
+var defaultNextProtos = []string{alpnHTTP2, alpnHTTP1}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var curves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// http2CipherSuites are the cipher suites HTTP/2 requires at least one of when TLS 1.2 is enabled.
+var http2CipherSuites = []uint16{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+}
+
+// parseBindAddress checks that the bind address is an IP address, and returns it without brackets.
+// An empty address binds to all interfaces.
+func parseBindAddress(key string, address string) (string, error) {
+	if address == "" {
+		return "", nil
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"))
+	if err != nil {
+		return "", fmt.Errorf("`%s` must be an IP address, such as 0.0.0.0, 127.0.0.1 or ::1, got %q", key, address)
+	}
+	return addr.String(), nil
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return tls.VersionTLS12, nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("`tls.min_version` must be 1.2 or 1.3, got %q", version)
+	}
+	return v, nil
+}
+
+// parseCipherSuites returns the IDs of the named TLS 1.2 cipher suites, in order of preference.
+// Insecure suites are refused, and so are TLS 1.3 suites, which Go doesn't allow to configure.
+func parseCipherSuites(names []string, minVersion uint16, nextProtos []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if minVersion == tls.VersionTLS13 {
+		return nil, errors.New("`tls.cipher_suites` only apply to TLS 1.2, and can't be set when `tls.min_version` is 1.3")
+	}
+	var ids []uint16
+	for _, name := range names {
+		if slices.ContainsFunc(tls.InsecureCipherSuites(), func(suite *tls.CipherSuite) bool { return suite.Name == name }) {
+			return nil, fmt.Errorf("`tls.cipher_suites`: %s is insecure", name)
+		}
+		index := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool { return suite.Name == name })
+		if index == -1 {
+			return nil, fmt.Errorf("`tls.cipher_suites`: unknown cipher suite %q", name)
+		}
+		suite := tls.CipherSuites()[index]
+		if !slices.Contains(suite.SupportedVersions, tls.VersionTLS12) {
+			return nil, fmt.Errorf("`tls.cipher_suites`: %s is a TLS 1.3 cipher suite, which is always enabled and can't be configured", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	if slices.Contains(nextProtos, alpnHTTP2) && !slices.ContainsFunc(ids, func(id uint16) bool { return slices.Contains(http2CipherSuites, id) }) {
+		return nil, fmt.Errorf("`tls.cipher_suites` must include %s or %s when `tls.alpn` includes h2",
+			tls.CipherSuiteName(http2CipherSuites[0]), tls.CipherSuiteName(http2CipherSuites[1]))
+	}
+	return ids, nil
+}
+
+func parseCurves(names []string) ([]tls.CurveID, error) {
+	var ids []tls.CurveID
+	for _, name := range names {
+		id, ok := curves[name]
+		if !ok {
+			return nil, fmt.Errorf("`tls.curve_preferences`: unknown curve %q, expected X25519, P256, P384 or P521", name)
+		}
+		if slices.Contains(ids, id) {
+			return nil, fmt.Errorf("`tls.curve_preferences`: %s is listed twice", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseALPN checks the ALPN protocols, in order of preference. HTTP/1.1 is required, as the server
+// always falls back to it for clients that don't negotiate a protocol.
+func parseALPN(protocols []string) ([]string, error) {
+	if len(protocols) == 0 {
+		return defaultNextProtos, nil
+	}
+	for i, protocol := range protocols {
+		if protocol != alpnHTTP2 && protocol != alpnHTTP1 {
+			return nil, fmt.Errorf("`tls.alpn`: unsupported protocol %q, expected h2 or http/1.1", protocol)
+		}
+		if slices.Contains(protocols[:i], protocol) {
+			return nil, fmt.Errorf("`tls.alpn`: %s is listed twice", protocol)
+		}
+	}
+	if !slices.Contains(protocols, alpnHTTP1) {
+		return nil, errors.New("`tls.alpn` must include http/1.1")
+	}
+	return protocols, nil
+}
+
+// parseTimeout parses a timeout of the http block, where 0 disables it and an empty value uses the default.
+func parseTimeout(key string, value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("`http.%s` is invalid: %w", key, err)
+	}
+	if timeout < 0 {
+		return 0, fmt.Errorf("`http.%s` can't be negative", key)
+	}
+	return timeout, nil
+}
+
+// validateMetrics checks the optional metrics listener, and returns its bind address and the PEM encoded CA
+// that client certificates must be issued by when it uses mutual TLS.
+func validateMetrics(c ConfigYAML) (string, []byte, error) {
+	if c.Metrics.Port == 0 {
+		if c.Metrics.BindAddress != "" || c.Metrics.ClientCAPath != "" {
+			return "", nil, errors.New("`metrics.port` is empty")
+		}
+		return "", nil, nil
+	}
+	if c.Metrics.Port < 0 || c.Metrics.Port > 65535 {
+		return "", nil, fmt.Errorf("`metrics.port` must be between 1 and 65535, got %d", c.Metrics.Port)
+	}
+	if c.Metrics.Port == c.Port {
+		return "", nil, errors.New("`metrics.port` must be different from `port`")
+	}
+	bindAddress, err := parseBindAddress("metrics.bind_address", c.Metrics.BindAddress)
+	if err != nil {
+		return "", nil, err
+	}
+	if c.Metrics.ClientCAPath == "" {
+		return bindAddress, nil, nil
+	}
+	clientCA, err := os.ReadFile(c.Metrics.ClientCAPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(clientCA) {
+		return "", nil, fmt.Errorf("`metrics.client_ca_path`: no PEM encoded certificate found in %s", c.Metrics.ClientCAPath)
+	}
+	return bindAddress, clientCA, nil
+}
+
+// validateCertificateExpiry returns the maximum number of certificates whose expiry is exported as a metric,
+// which is 0 unless it is enabled.
+func validateCertificateExpiry(c MetricsYAML) (int, error) {
+	if c.CertificateExpiryLimit < 0 {
+		return 0, errors.New("`metrics.certificate_expiry_limit` can't be negative")
+	}
+	if !c.CertificateExpiry {
+		if c.CertificateExpiryLimit != 0 {
+			return 0, errors.New("`metrics.certificate_expiry_limit` is set but `metrics.certificate_expiry` isn't enabled")
+		}
+		return 0, nil
+	}
+	if c.CertificateExpiryLimit == 0 {
+		return defaultCertificateExpiryLimit, nil
+	}
+	return c.CertificateExpiryLimit, nil
+}
+
+// validateAdminSocket checks that the admin socket can be created at the given path.
+func validateAdminSocket(path string) error {
+	info, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("`admin_socket`: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("`admin_socket`: %s is not a directory", filepath.Dir(path))
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables that override the fields of the config file.
+// A field is overridden by the variable named after its path in the file, such as NOTARY_CSR_POLICY_MAX_SANS.
+const EnvPrefix = "NOTARY_"
+
+// redacted replaces the value of secrets when the config is printed.
+const redacted = "<redacted>"
+
+// Overrides holds the fields of the config set with command line flags.
+type Overrides struct {
+	values map[string]string
+}
+
+// configField is a field of ConfigYAML, identified by its path in the config file.
+// Secret fields are tagged with `secret:"true"`: they can be read from a file and are redacted when printed.
+type configField struct {
+	path   []string
+	value  reflect.Value
+	secret bool
+}
+
+// key returns the path of the field in the config file, such as csr_policy.max_sans.
+func (f configField) key() string {
+	return strings.Join(f.path, ".")
+}
+
+func (f configField) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.Join(f.path, "_"))
+}
+
+func (f configField) flagName() string {
+	return strings.ReplaceAll(f.key(), "_", "-")
+}
+
+// set parses the value of the field from a flag or an environment variable. Lists are comma separated.
+func (f configField) set(value string) error {
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(value)
+	case reflect.Int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		f.value.SetInt(int64(i))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		f.value.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", f.value.Type())
+	}
+	return nil
+}
+
+// configFields lists the fields of the given config struct, including those of nested structs.
+func configFields(v reflect.Value, prefix []string) []configField {
+	var fields []configField
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		name, _, _ := strings.Cut(structField.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := append(append([]string{}, prefix...), name)
+		if structField.Type.Kind() == reflect.Struct {
+			fields = append(fields, configFields(v.Field(i), path)...)
+			continue
+		}
+		fields = append(fields, configField{path: path, value: v.Field(i), secret: structField.Tag.Get("secret") == "true"})
+	}
+	return fields
+}
+
+// RegisterFlags adds a flag overriding every field of the config file to the flag set.
+// Flags are named after the path of the field in the file, such as -csr-policy.max-sans.
+// Secrets can also be read from a file, such as with -jwt-secret-file.
+func RegisterFlags(flags *flag.FlagSet) *Overrides {
+	overrides := &Overrides{values: map[string]string{}}
+	for _, field := range configFields(reflect.ValueOf(&ConfigYAML{}).Elem(), nil) {
+		key := field.key()
+		usage := fmt.Sprintf("Overrides %s of the config file", key)
+		setValue := func(value string) error {
+			overrides.values[key] = value
+			return nil
+		}
+		if field.value.Kind() == reflect.Bool {
+			flags.BoolFunc(field.flagName(), usage, setValue)
+		} else {
+			flags.Func(field.flagName(), usage, setValue)
+		}
+		if field.secret {
+			flags.Func(field.flagName()+"-file", fmt.Sprintf("Reads %s from the given file", key), func(path string) error {
+				value, err := readSecretFile(path)
+				if err != nil {
+					return err
+				}
+				return setValue(value)
+			})
+		}
+	}
+	return overrides
+}
+
+// Load reads the config file at the given path, if any, and applies the overrides of the environment and
+// of the flags, in that order, so that flags take precedence over the environment, which takes precedence
+// over the file. The result isn't validated.
+func Load(filePath string, overrides *Overrides) (ConfigYAML, error) {
+	c := ConfigYAML{}
+	if filePath != "" {
+		configYaml, err := os.ReadFile(filePath)
+		if err != nil {
+			return ConfigYAML{}, err
+		}
+		if err := yaml.Unmarshal(configYaml, &c); err != nil {
+			return ConfigYAML{}, err
+		}
+	}
+	for _, field := range configFields(reflect.ValueOf(&c).Elem(), nil) {
+		value, ok, err := lookupEnv(field)
+		if err != nil {
+			return ConfigYAML{}, err
+		}
+		if ok {
+			if err := field.set(value); err != nil {
+				return ConfigYAML{}, fmt.Errorf("%s is invalid: %w", field.envName(), err)
+			}
+		}
+		if overrides == nil {
+			continue
+		}
+		if value, ok := overrides.values[field.key()]; ok {
+			if err := field.set(value); err != nil {
+				return ConfigYAML{}, fmt.Errorf("-%s is invalid: %w", field.flagName(), err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// lookupEnv returns the value of the environment variable overriding the field.
+// Secrets can instead be read from the file named by the variable with a _FILE suffix.
+func lookupEnv(field configField) (string, bool, error) {
+	value, ok := os.LookupEnv(field.envName())
+	if !field.secret {
+		return value, ok, nil
+	}
+	path, fileOk := os.LookupEnv(field.envName() + "_FILE")
+	if !fileOk {
+		return value, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("%s and %s_FILE can't both be set", field.envName(), field.envName())
+	}
+	value, err := readSecretFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// readSecretFile reads a secret from a file, ignoring the trailing newline editors and tools usually add.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", errors.New("secret file " + path + " is empty")
+	}
+	return value, nil
+}
+
+// Redacted returns a copy of the config in which the value of every secret that is set is replaced,
+// so that it can be shown safely.
+func (c ConfigYAML) Redacted() ConfigYAML {
+	for _, field := range configFields(reflect.ValueOf(&c).Elem(), nil) {
+		if field.secret && field.value.String() != "" {
+			field.value.SetString(redacted)
+		}
+	}
+	return c
+}
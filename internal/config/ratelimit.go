@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// RateLimit is the rate at which a client can send requests, with bursts of up to Burst requests at once.
+// A rate of 0 disables the limit.
+type RateLimit struct {
+	RequestsPerMinute int
+	Burst             int
+}
+
+// validateRateLimit checks the rate limit of a group of routes. The burst defaults to the number of requests
+// allowed per minute.
+func validateRateLimit(group string, c RateLimitGroupYAML) (RateLimit, error) {
+	if c.RequestsPerMinute < 0 {
+		return RateLimit{}, fmt.Errorf("`rate_limit.%s.requests_per_minute` can't be negative", group)
+	}
+	if c.Burst < 0 {
+		return RateLimit{}, fmt.Errorf("`rate_limit.%s.burst` can't be negative", group)
+	}
+	if c.RequestsPerMinute == 0 {
+		if c.Burst != 0 {
+			return RateLimit{}, fmt.Errorf("`rate_limit.%[1]s.burst` is set but `rate_limit.%[1]s.requests_per_minute` isn't", group)
+		}
+		return RateLimit{}, nil
+	}
+	if c.Burst == 0 {
+		return RateLimit{RequestsPerMinute: c.RequestsPerMinute, Burst: c.RequestsPerMinute}, nil
+	}
+	return RateLimit{RequestsPerMinute: c.RequestsPerMinute, Burst: c.Burst}, nil
+}
+
+// parseTrustedProxies parses the addresses of the trusted proxies, which are IP addresses or CIDR ranges.
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range proxies {
+		var prefix netip.Prefix
+		var err error
+		if strings.Contains(proxy, "/") {
+			prefix, err = netip.ParsePrefix(proxy)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(proxy)
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("`rate_limit.trusted_proxies` must be IP addresses or CIDR ranges, such as 10.0.0.1 or 10.0.0.0/8, got %q", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupPrefix and backupSuffix frame the names of the files written by scheduled backups.
+// The timestamp between them sorts in chronological order.
+const (
+	backupPrefix     = "notary-"
+	backupSuffix     = ".db"
+	backupTimeFormat = "20060102T150405.000Z"
+)
+
+// Backup writes a consistent snapshot of the database to the file at the given path, using the SQLite online
+// backup API, so that it can be taken while the database is in use. An existing file at the path is replaced
+// once the snapshot is complete. The file is only readable by its owner, as it holds the password hashes of the accounts.
+func (db *Database) Backup(path string) error {
+	tmpPath := path + ".tmp"
+	if err := os.Remove(tmpPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// SQLite keeps the mode of an existing empty file, which it fills as a new database.
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	dest, err := sql.Open("sqlite3", databaseURI(tmpPath, ""))
+	if err != nil {
+		return err
+	}
+	err = copyDatabase(dest, db.conn)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath) //nolint:errcheck
+		return fmt.Errorf("couldn't back up database: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// ValidateBackup makes sure the file at the given path is an intact Notary database
+// with a schema this version of Notary can use.
+func ValidateBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	conn, err := sql.Open("sqlite3", databaseURI(path, "mode=ro"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	problems, err := checkSchema(conn, certificateRequestsTableName, usersTableName)
+	if err != nil {
+		return fmt.Errorf("backup is %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("backup is invalid: %s", strings.Join(problems, ", "))
+	}
+	version, err := schemaVersion(conn)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("backup schema version %d is newer than the supported version %d", version, SchemaVersion)
+	}
+	return nil
+}
+
+// Restore replaces the content of the database at databasePath with the backup at backupPath, after validating it.
+// The backup is copied with the SQLite online backup API, and is migrated to the current schema if it is older.
+// Notary should be stopped while a backup is restored.
+func Restore(backupPath string, databasePath string) error {
+	if err := ValidateBackup(backupPath); err != nil {
+		return err
+	}
+	src, err := sql.Open("sqlite3", databaseURI(backupPath, "mode=ro"))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dest, err := sql.Open("sqlite3", databaseURI(databasePath, ""))
+	if err != nil {
+		return err
+	}
+	err = copyDatabase(dest, src)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't restore database: %w", err)
+	}
+	restored, err := NewDatabase(databasePath)
+	if err != nil {
+		return err
+	}
+	return restored.Close()
+}
+
+// RunScheduledBackups backs up the database to a new file in the given directory at every interval,
+// and removes the oldest backups so that at most retention of them are kept. It runs until the context is done.
+// Failed backups are logged and retried at the next interval. The result of every backup is passed to report,
+// unless it is nil.
+func (db *Database) RunScheduledBackups(ctx context.Context, directory string, interval time.Duration, retention int, report func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			err := db.backupToDirectory(directory, now, retention)
+			if err != nil {
+				slog.Error("Scheduled backup failed", "error", err)
+			}
+			if report != nil {
+				report(err)
+			}
+		}
+	}
+}
+
+func (db *Database) backupToDirectory(directory string, now time.Time, retention int) error {
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return err
+	}
+	name := backupPrefix + now.UTC().Format(backupTimeFormat) + backupSuffix
+	if err := db.Backup(filepath.Join(directory, name)); err != nil {
+		return err
+	}
+	return pruneBackups(directory, retention)
+}
+
+// pruneBackups removes the oldest scheduled backups in the directory until at most retention of them are left.
+func pruneBackups(directory string, retention int) error {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	slices.Sort(backups)
+	for len(backups) > retention {
+		if err := os.Remove(filepath.Join(directory, backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// copyDatabase copies the whole content of the src database into the dest database with the SQLite online backup API.
+func copyDatabase(dest *sql.DB, src *sql.DB) error {
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			destSQLite, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("destination is not an sqlite database")
+			}
+			srcSQLite, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("source is not an sqlite database")
+			}
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish() //nolint:errcheck
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
@@ -0,0 +1,192 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.NewDatabase(filepath.Join(dir, "notary.db"))
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+	if _, err := database.CreateCSR(AppleCSR); err != nil {
+		t.Fatalf("Couldn't create CSR: %s", err)
+	}
+
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := database.Backup(backupPath); err != nil {
+		t.Fatalf("Couldn't back up database: %s", err)
+	}
+	if err := db.ValidateBackup(backupPath); err != nil {
+		t.Fatalf("Backup is not valid: %s", err)
+	}
+	if _, err := database.CreateCSR(BananaCSR); err != nil {
+		t.Fatalf("Couldn't create CSR: %s", err)
+	}
+
+	restoredPath := filepath.Join(dir, "restored.db")
+	if err := db.Restore(backupPath, restoredPath); err != nil {
+		t.Fatalf("Couldn't restore backup: %s", err)
+	}
+	restored, err := db.NewDatabase(restoredPath)
+	if err != nil {
+		t.Fatalf("Couldn't open restored database: %s", err)
+	}
+	defer restored.Close()
+	csrs, err := restored.RetrieveAllCSRs()
+	if err != nil {
+		t.Fatalf("Couldn't retrieve CSRs: %s", err)
+	}
+	if len(csrs) != 1 || csrs[0].CSR != AppleCSR {
+		t.Fatalf("Restored database doesn't match the backup: %+v", csrs)
+	}
+}
+
+func TestRestoreValidatesBackup(t *testing.T) {
+	dir := t.TempDir()
+	notADatabase := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(notADatabase, []byte(strings.Repeat("garbage", 1000)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	targetPath := filepath.Join(dir, "notary.db")
+	if err := db.Restore(notADatabase, targetPath); err == nil {
+		t.Fatalf("Expected restoring an invalid backup to fail")
+	}
+	if err := db.Restore(filepath.Join(dir, "missing.db"), targetPath); err == nil {
+		t.Fatalf("Expected restoring a missing backup to fail")
+	}
+	if _, err := os.Stat(targetPath); err == nil {
+		t.Fatalf("Expected the database not to be touched by a failed restore")
+	}
+}
+
+func TestScheduledBackups(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.NewDatabase(filepath.Join(dir, "notary.db"))
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+	backupDir := filepath.Join(dir, "backups")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		database.RunScheduledBackups(ctx, backupDir, 20*time.Millisecond, 2, nil)
+		close(done)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	<-done
+
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		t.Fatalf("Couldn't read backup directory: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 backups to be retained, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if err := db.ValidateBackup(filepath.Join(backupDir, entry.Name())); err != nil {
+			t.Fatalf("Scheduled backup %s is not valid: %s", entry.Name(), err)
+		}
+	}
+}
+
+func TestBackupReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notary.db")
+	if _, err := db.OpenReadOnly(path); err == nil {
+		t.Fatalf("Expected a missing database not to be opened")
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected a missing database not to be created, got %v", err)
+	}
+	database, err := db.NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	if _, err := database.CreateCSR(AppleCSR); err != nil {
+		t.Fatalf("Couldn't create CSR: %s", err)
+	}
+	database.Close()
+
+	readOnly, err := db.OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("Couldn't open database: %s", err)
+	}
+	defer readOnly.Close()
+	if _, err := readOnly.CreateCSR(BananaCSR); err == nil {
+		t.Fatalf("Expected writes to a read-only database to fail")
+	}
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := readOnly.Backup(backupPath); err != nil {
+		t.Fatalf("Couldn't back up database: %s", err)
+	}
+	if err := db.ValidateBackup(backupPath); err != nil {
+		t.Fatalf("Backup is not valid: %s", err)
+	}
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		t.Fatalf("Couldn't stat backup: %s", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected the backup to only be readable by its owner, got %s", info.Mode().Perm())
+	}
+}
+
+func TestBackupWithSpecialCharactersInPaths(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data #1")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatalf("Couldn't create directory: %s", err)
+	}
+	path := filepath.Join(dir, "notary?mode=rw%20.db")
+	database, err := db.NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	if _, err := database.CreateCSR(AppleCSR); err != nil {
+		t.Fatalf("Couldn't create CSR: %s", err)
+	}
+	database.Close()
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != filepath.Base(path) {
+		t.Fatalf("Expected the database to be created at the given path, got %v: %v", entries, err)
+	}
+
+	readOnly, err := db.OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("Couldn't open database: %s", err)
+	}
+	defer readOnly.Close()
+	if _, err := readOnly.CreateCSR(BananaCSR); err == nil {
+		t.Fatalf("Expected writes to a read-only database to fail")
+	}
+	backupPath := filepath.Join(dir, "backup?mode=rw#%.db")
+	if err := readOnly.Backup(backupPath); err != nil {
+		t.Fatalf("Couldn't back up database: %s", err)
+	}
+	if err := db.ValidateBackup(backupPath); err != nil {
+		t.Fatalf("Backup is not valid: %s", err)
+	}
+	if err := db.Restore(backupPath, path); err != nil {
+		t.Fatalf("Couldn't restore backup: %s", err)
+	}
+	restored, err := db.NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer restored.Close()
+	if csrs, err := restored.RetrieveAllCSRs(); err != nil || len(csrs) != 1 {
+		t.Fatalf("Expected the restored database to hold the CSR, got %d: %v", len(csrs), err)
+	}
+}
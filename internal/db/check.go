@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Check looks for problems in the database: corruption, a schema that isn't up to date, missing tables,
+// and the lack of an admin account. It returns a description of every problem found, which is empty
+// when the database is healthy. The error is only set when the checks couldn't be run.
+func (db *Database) Check() ([]string, error) {
+	problems, err := checkSchema(db.conn, certificateRequestsTableName, usersTableName, profilesTableName)
+	if err != nil || len(problems) > 0 {
+		return problems, err
+	}
+	version, err := schemaVersion(db.conn)
+	if err != nil {
+		return nil, err
+	}
+	if version != SchemaVersion {
+		problems = append(problems, fmt.Sprintf("schema version %d isn't the current version %d", version, SchemaVersion))
+	}
+	users, err := db.RetrieveAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	admins := 0
+	for _, user := range users {
+		if user.Permissions == AdminPermission {
+			admins++
+		}
+	}
+	if admins == 0 {
+		problems = append(problems, "there is no admin account")
+	}
+	return problems, nil
+}
+
+// checkSchema runs the integrity and foreign key checks of SQLite, and makes sure the given tables exist.
+func checkSchema(conn *sql.DB, tables ...string) ([]string, error) {
+	var problems []string
+	rows, err := conn.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("not a valid database: %w", err)
+	}
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if result != "ok" {
+			problems = append(problems, "corrupted: "+result)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("not a valid database: %w", err)
+	}
+	rows, err = conn.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, err
+	}
+	if rows.Next() {
+		problems = append(problems, "a foreign key constraint is violated")
+	}
+	rows.Close()
+	for _, table := range tables {
+		var name string
+		err := conn.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("the %s table is missing", table))
+		}
+	}
+	return problems, nil
+}
+
+// ErrBusy is returned by Ping when another connection holds the write lock of the database.
+var ErrBusy = errors.New("database is busy")
+
+// Ping checks that the database can be read and written. The write is made in a transaction that is rolled back,
+// so that a database that can't be written, such as on a read-only or full disk, is detected without changing it.
+// The transaction doesn't wait for the write lock: when another connection holds it, Ping returns ErrBusy right away
+// rather than blocking the writers that queue behind it.
+func (db *Database) Ping(ctx context.Context) error {
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var busyTimeout int
+	if err := conn.QueryRowContext(ctx, "PRAGMA busy_timeout").Scan(&busyTimeout); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA busy_timeout = 0"); err != nil {
+		return err
+	}
+	// The connection goes back to the pool, where the other queries expect to wait for the lock.
+	defer conn.ExecContext(context.Background(), fmt.Sprintf("PRAGMA busy_timeout = %d", busyTimeout)) //nolint:errcheck
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		if isBusy(err) {
+			return ErrBusy
+		}
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	var version int
+	if err := tx.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		if isBusy(err) {
+			return ErrBusy
+		}
+		return fmt.Errorf("database can't be written: %w", err)
+	}
+	return nil
+}
+
+// isBusy reports whether the error is caused by another connection holding a lock on the database.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// Version returns the schema version of the database, which is SchemaVersion once every migration is applied.
+func (db *Database) Version() (int, error) {
+	return schemaVersion(db.conn)
+}
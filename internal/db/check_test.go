@@ -0,0 +1,169 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notary.db")
+	database, err := db.NewDatabase(path)
+	if err != nil {
+		t.Fatalf("couldn't create database: %s", err)
+	}
+	defer database.Close()
+
+	problems, err := database.Check()
+	if err != nil {
+		t.Fatalf("couldn't check database: %s", err)
+	}
+	if len(problems) != 1 || problems[0] != "there is no admin account" {
+		t.Fatalf("expected the missing admin to be reported, got %v", problems)
+	}
+
+	if _, err := database.CreateUser("admin", "Admin123", db.AdminPermission); err != nil {
+		t.Fatalf("couldn't create user: %s", err)
+	}
+	problems, err = database.Check()
+	if err != nil {
+		t.Fatalf("couldn't check database: %s", err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("couldn't open database: %s", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec("DROP TABLE certificate_profiles"); err != nil {
+		t.Fatalf("couldn't drop table: %s", err)
+	}
+	problems, err = database.Check()
+	if err != nil {
+		t.Fatalf("couldn't check database: %s", err)
+	}
+	if len(problems) != 1 || problems[0] != "the certificate_profiles table is missing" {
+		t.Fatalf("expected the missing table to be reported, got %v", problems)
+	}
+}
+
+func TestCheckReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notary.db")
+	database, err := db.NewDatabase(path)
+	if err != nil {
+		t.Fatalf("couldn't create database: %s", err)
+	}
+	if _, err := database.CreateUser("admin", "Admin123", db.AdminPermission); err != nil {
+		t.Fatalf("couldn't create user: %s", err)
+	}
+	database.Close()
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("couldn't open database: %s", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec(fmt.Sprintf("PRAGMA user_version = %d", db.SchemaVersion-1)); err != nil {
+		t.Fatalf("couldn't set schema version: %s", err)
+	}
+
+	readOnly, err := db.OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("couldn't open database: %s", err)
+	}
+	defer readOnly.Close()
+	problems, err := readOnly.Check()
+	if err != nil {
+		t.Fatalf("couldn't check database: %s", err)
+	}
+	expected := fmt.Sprintf("schema version %d isn't the current version %d", db.SchemaVersion-1, db.SchemaVersion)
+	if len(problems) != 1 || problems[0] != expected {
+		t.Fatalf("expected the outdated schema to be reported, got %v", problems)
+	}
+	if version, err := readOnly.Version(); err != nil || version != db.SchemaVersion-1 {
+		t.Fatalf("expected the check not to migrate the database, got version %d: %v", version, err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	database, err := db.NewDatabase(filepath.Join(t.TempDir(), "notary.db"))
+	if err != nil {
+		t.Fatalf("couldn't create database: %s", err)
+	}
+	if err := database.Ping(context.Background()); err != nil {
+		t.Fatalf("couldn't ping database: %s", err)
+	}
+	version, err := database.Version()
+	if err != nil {
+		t.Fatalf("couldn't get schema version: %s", err)
+	}
+	if version != db.SchemaVersion {
+		t.Fatalf("expected the ping to leave the schema version %d unchanged, got %d", db.SchemaVersion, version)
+	}
+
+	if err := database.Close(); err != nil {
+		t.Fatalf("couldn't close database: %s", err)
+	}
+	if err := database.Ping(context.Background()); err == nil {
+		t.Fatalf("expected pinging a closed database to fail")
+	}
+}
+
+func TestPingWithConcurrentWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notary.db")
+	database, err := db.NewDatabase(path)
+	if err != nil {
+		t.Fatalf("couldn't create database: %s", err)
+	}
+	defer database.Close()
+	other, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("couldn't open database: %s", err)
+	}
+	defer other.Close()
+	otherTx, err := other.Begin()
+	if err != nil {
+		t.Fatalf("couldn't begin transaction: %s", err)
+	}
+	if _, err := otherTx.Exec("PRAGMA user_version = 42"); err != nil {
+		t.Fatalf("couldn't write: %s", err)
+	}
+
+	start := time.Now()
+	if err := database.Ping(context.Background()); !errors.Is(err, db.ErrBusy) {
+		t.Fatalf("expected the ping to report a busy database, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the ping not to wait for the write lock, took %s", elapsed)
+	}
+
+	if err := otherTx.Rollback(); err != nil {
+		t.Fatalf("couldn't roll back: %s", err)
+	}
+	if err := database.Ping(context.Background()); err != nil {
+		t.Fatalf("couldn't ping database: %s", err)
+	}
+	// The connection used by the ping waits for the write lock again once it is back in the pool.
+	otherTx, err = other.Begin()
+	if err != nil {
+		t.Fatalf("couldn't begin transaction: %s", err)
+	}
+	if _, err := otherTx.Exec("PRAGMA user_version = 42"); err != nil {
+		t.Fatalf("couldn't write: %s", err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		otherTx.Rollback() //nolint:errcheck
+	}()
+	if _, err := database.CreateCSR(AppleCSR); err != nil {
+		t.Fatalf("expected the write to wait for the other writer, got %s", err)
+	}
+}
@@ -2,11 +2,19 @@
 package db
 
 import (
+	"context"
+	"crypto"
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/canonical/notary/internal/tracing"
+	"github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -20,14 +28,20 @@ const queryCreateCSRsTable = `CREATE TABLE IF NOT EXISTS %s (
 	certificate TEXT DEFAULT ''
 )`
 
+// CSR queries join every request with its successor, so that both ends of a renewal link can be read from a single row.
 const (
-	queryGetAllCSRs = "SELECT rowid, * FROM %s"
-	queryGetCSR     = "SELECT rowid, * FROM %s WHERE rowid=?"
-	queryCreateCSR  = "INSERT INTO %s (csr) VALUES (?)"
-	queryUpdateCSR  = "UPDATE %s SET certificate=? WHERE rowid=?"
-	queryDeleteCSR  = "DELETE FROM %s WHERE rowid=?"
+	queryGetAllCSRs      = "SELECT c.id, c.csr, c.certificate, c.fingerprint, c.profile_id, c.predecessor_id, COALESCE(s.id, 0), COALESCE(c.created_at, 0) FROM %[1]s c LEFT JOIN %[1]s s ON s.predecessor_id = c.id"
+	queryGetCSR          = "SELECT c.id, c.csr, c.certificate, c.fingerprint, c.profile_id, c.predecessor_id, COALESCE(s.id, 0), COALESCE(c.created_at, 0) FROM %[1]s c LEFT JOIN %[1]s s ON s.predecessor_id = c.id WHERE c.id=?"
+	queryUpdateCSR       = "UPDATE %s SET certificate=?, fingerprint=?, status=?, not_after=? WHERE id=?"
+	queryDeleteCSR       = "DELETE FROM %s WHERE id=?"
+	queryRelinkSuccessor = "UPDATE %s SET predecessor_id=? WHERE predecessor_id=?"
 )
 
+// A request is only created if its account has fewer outstanding requests than the quota, which is checked
+// by the insert itself so that concurrent requests can't exceed it. A quota of 0 means there is none.
+const queryCreateCSR = `INSERT INTO %[1]s (csr, profile_id, predecessor_id, created_at, owner_id) SELECT ?1, ?2, ?3, ?4, ?5
+	WHERE ?6 = 0 OR (SELECT COUNT(*) FROM %[1]s WHERE owner_id = ?5 AND status = 'outstanding') < ?6`
+
 const queryCreateUsersTable = `CREATE TABLE IF NOT EXISTS %s (
     user_id INTEGER PRIMARY KEY AUTOINCREMENT,
     username TEXT NOT NULL UNIQUE,
@@ -41,6 +55,7 @@ const (
 	queryGetUserByUsername = "SELECT * FROM %s WHERE username=?"
 	queryCreateUser        = "INSERT INTO %s (username, hashed_password, permissions) VALUES (?, ?, ?)"
 	queryUpdateUser        = "UPDATE %s SET hashed_password=? WHERE user_id=?"
+	queryUpdatePermissions = "UPDATE %s SET permissions=? WHERE user_id=?"
 	queryDeleteUser        = "DELETE FROM %s WHERE user_id=?"
 	queryGetNumUsers       = "SELECT COUNT(*) FROM %s"
 )
@@ -49,16 +64,51 @@ const (
 type Database struct {
 	certificateTable string
 	usersTable       string
+	profilesTable    string
+	csrPolicy        *atomic.Pointer[CSRPolicy]
 	conn             *sql.DB
+	tx               *sql.Tx
+	notifier         *notifier
+	// pendingQuota is the number of outstanding requests an account can have submitted, shared by every copy
+	// of the database. account is the ID of the account the database is bound to, and is 0 when there is none.
+	pendingQuota *atomic.Int64
+	account      int
+	// txEvents holds the events caused by the writes of the transaction the database is bound to,
+	// which are published once it is committed.
+	txEvents *[]CertificateEvent
+	// ctx is the context the queries are traced in, which is the background context when it is nil.
+	ctx context.Context
 }
 
 // A CertificateRequest struct represents an entry in the database.
-// The object contains a Certificate Request, its matching Certificate if any, and the row ID.
+// The object contains a Certificate Request, its matching Certificate if any, the row ID,
+// and the ID of the certificate profile selected for it, which is 0 when there is none.
+// Fingerprint is the SHA-256 fingerprint of the issued certificate, and is empty when there is none.
+// Certificates imported from elsewhere have no CSR.
+// Renewed requests are linked together: PredecessorID is the request this one renews,
+// and SuccessorID the request that renews this one, each being 0 when there is none.
+// CreatedAt is when the request was submitted, or the certificate imported, and is zero for entries created
+// before it was recorded.
 type CertificateRequest struct {
-	ID          int
-	CSR         string
-	Certificate string
+	ID            int
+	CSR           string
+	Certificate   string
+	Fingerprint   string
+	ProfileID     int
+	PredecessorID int
+	SuccessorID   int
+	CreatedAt     time.Time
 }
+
+// Permission levels of users. Admins can manage accounts and certificate profiles.
+const (
+	UserPermission  = 0
+	AdminPermission = 1
+)
+
+// PasswordRequirements describes the passwords ValidatePassword accepts.
+const PasswordRequirements = "Password must have 8 or more characters, must include at least one capital letter, one lowercase letter, and either a number or a symbol."
+
 type User struct {
 	ID          int
 	Username    string
@@ -66,11 +116,34 @@ type User struct {
 	Permissions int
 }
 
-var ErrIdNotFound = errors.New("id not found")
+var (
+	ErrIdNotFound      = errors.New("id not found")
+	ErrProfileNotFound = errors.New("certificate profile not found")
+	ErrAlreadyRenewed  = errors.New("certificate request was already renewed")
+	ErrNotIssued       = errors.New("certificate request has no issued certificate")
+	ErrImported        = errors.New("certificate was imported without a certificate request")
+	ErrQuotaExceeded   = errors.New("account has reached its quota of pending certificate requests")
+	// ErrAlreadyExists is returned when a CSR, a username or a profile name is already recorded.
+	ErrAlreadyExists = errors.New("already exists")
+	// The validation errors of CSRs, certificates and certificate profiles wrap these errors, followed by what is wrong.
+	// Certificates that aren't issued by the certificate after them, or whose key doesn't match the key of their CSR,
+	// also wrap ErrInvalidChain or ErrCertificateMismatch.
+	ErrInvalidCSR          = errors.New("csr validation failed")
+	ErrInvalidCertificate  = errors.New("cert validation failed")
+	ErrInvalidProfile      = errors.New("profile validation failed")
+	ErrInvalidChain        = errors.New("invalid certificate chain")
+	ErrCertificateMismatch = errors.New("certificate does not match CSR")
+)
+
+// isUniqueViolation reports whether the error is the violation of a unique constraint or index.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
 
 // RetrieveAllCSRs gets every CertificateRequest entry in the table.
 func (db *Database) RetrieveAllCSRs() ([]CertificateRequest, error) {
-	rows, err := db.conn.Query(fmt.Sprintf(queryGetAllCSRs, db.certificateTable))
+	rows, err := db.querier().Query(fmt.Sprintf(queryGetAllCSRs, db.certificateTable))
 	if err != nil {
 		return nil, err
 	}
@@ -79,9 +152,11 @@ func (db *Database) RetrieveAllCSRs() ([]CertificateRequest, error) {
 	defer rows.Close()
 	for rows.Next() {
 		var csr CertificateRequest
-		if err := rows.Scan(&csr.ID, &csr.CSR, &csr.Certificate); err != nil {
+		var createdAt int64
+		if err := rows.Scan(&csr.ID, &csr.CSR, &csr.Certificate, &csr.Fingerprint, &csr.ProfileID, &csr.PredecessorID, &csr.SuccessorID, &createdAt); err != nil {
 			return nil, err
 		}
+		csr.CreatedAt = unixTime(createdAt)
 		allCsrs = append(allCsrs, csr)
 	}
 	return allCsrs, nil
@@ -91,77 +166,223 @@ func (db *Database) RetrieveAllCSRs() ([]CertificateRequest, error) {
 // It returns the row id and matching certificate alongside the CSR in a CertificateRequest object.
 func (db *Database) RetrieveCSR(id string) (CertificateRequest, error) {
 	var newCSR CertificateRequest
-	row := db.conn.QueryRow(fmt.Sprintf(queryGetCSR, db.certificateTable), id)
-	if err := row.Scan(&newCSR.ID, &newCSR.CSR, &newCSR.Certificate); err != nil {
+	var createdAt int64
+	row := db.querier().QueryRow(fmt.Sprintf(queryGetCSR, db.certificateTable), id)
+	if err := row.Scan(&newCSR.ID, &newCSR.CSR, &newCSR.Certificate, &newCSR.Fingerprint, &newCSR.ProfileID, &newCSR.PredecessorID, &newCSR.SuccessorID, &createdAt); err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			return newCSR, ErrIdNotFound
 		}
 		return newCSR, err
 	}
+	newCSR.CreatedAt = unixTime(createdAt)
 	return newCSR, nil
 }
 
 // CreateCSR creates a new entry in the repository.
-// The given CSR must be valid and unique
+// The given CSR must be valid, unique and must satisfy the CSR policy of the database.
 func (db *Database) CreateCSR(csr string) (int64, error) {
-	if err := ValidateCertificateRequest(csr); err != nil {
-		return 0, errors.New("csr validation failed: " + err.Error())
+	return db.CreateCSRWithProfile(csr, 0)
+}
+
+// CreateCSRWithProfile creates a new entry in the repository that will be signed with the given certificate profile.
+// A profile ID of 0 means no profile is selected. The request is recorded as submitted by the account the database
+// is bound to, and ErrQuotaExceeded is returned when that account has reached its quota of outstanding requests.
+func (db *Database) CreateCSRWithProfile(csr string, profileID int) (int64, error) {
+	if profileID != 0 {
+		if _, err := db.RetrieveCertificateProfile(fmt.Sprint(profileID)); err != nil {
+			if errors.Is(err, ErrIdNotFound) {
+				return 0, ErrProfileNotFound
+			}
+			return 0, err
+		}
 	}
-	result, err := db.conn.Exec(fmt.Sprintf(queryCreateCSR, db.certificateTable), csr)
+	parsedCSR, err := parseCertificateRequest(csr)
 	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidCSR, err)
+	}
+	if err := db.policy().Check(parsedCSR); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidCSR, err)
+	}
+	return db.insertCSR(csr, profileID, 0)
+}
+
+// insertCSR creates a request for the account the database is bound to, unless the account has reached its quota.
+// It returns ErrAlreadyExists when the CSR is already recorded, or ErrAlreadyRenewed when the predecessor already
+// has a renewal, as a request can only be renewed once.
+func (db *Database) insertCSR(csr string, profileID int, predecessorID int) (int64, error) {
+	owner := sql.NullInt64{Int64: int64(db.account), Valid: db.account != 0}
+	result, err := db.querier().Exec(fmt.Sprintf(queryCreateCSR, db.certificateTable),
+		csr, profileID, predecessorID, time.Now().Unix(), owner, db.pendingQuota.Load())
+	if err != nil {
+		if isUniqueViolation(err) && predecessorID != 0 {
+			return 0, ErrAlreadyRenewed
+		}
+		if isUniqueViolation(err) {
+			return 0, ErrAlreadyExists
+		}
 		return 0, err
 	}
-	id, err := result.LastInsertId()
+	created, err := result.RowsAffected()
 	if err != nil {
 		return 0, err
 	}
-	return id, nil
+	if created == 0 {
+		return 0, ErrQuotaExceeded
+	}
+	db.certificatesChanged()
+	return result.LastInsertId()
 }
 
 // UpdateCSR adds a new cert to the given CSR in the repository.
 // The given certificate must share the public key of the CSR and must be valid.
+// Imported certificates have no CSR and can't be updated.
 func (db *Database) UpdateCSR(id string, cert string) (int64, error) {
 	csr, err := db.RetrieveCSR(id)
 	if err != nil {
 		return 0, err
 	}
+	if csr.CSR == "" {
+		return 0, ErrImported
+	}
 	if cert != "rejected" && cert != "" {
 		err = ValidateCertificate(cert)
 		if err != nil {
-			return 0, errors.New("cert validation failed: " + err.Error())
+			return 0, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
 		}
 		err = CertificateMatchesCSR(cert, csr.CSR)
 		if err != nil {
-			return 0, errors.New("cert validation failed: " + err.Error())
+			return 0, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
 		}
 		cert = sanitizeCertificateBundle(cert)
 	}
-	_, err = db.conn.Exec(fmt.Sprintf(queryUpdateCSR, db.certificateTable), cert, csr.ID)
+	_, err = db.querier().Exec(fmt.Sprintf(queryUpdateCSR, db.certificateTable), cert, certificateFingerprint(cert), certificateStatus(cert), certificateNotAfter(cert), csr.ID)
 	if err != nil {
 		return 0, err
 	}
+	var events []CertificateEvent
+	if eventType := certificateEventType(csr.Certificate, cert); eventType != "" {
+		events = append(events, CertificateEvent{Type: eventType, RequestID: csr.ID, SubmittedAt: csr.CreatedAt, Time: time.Now()})
+	}
+	db.certificatesChanged(events...)
 	return int64(csr.ID), nil
 }
 
+// RenewCSR creates a new certificate request that renews the request with the given id, and returns the id of the renewal.
+// The renewed request must have an issued certificate and can only be renewed once.
+// The renewal keeps the certificate profile of its predecessor, and its CSR must have the same subject.
+// If csr is empty, the CSR of the predecessor is reused. Reusing the key of the predecessor, either this way or with a new CSR,
+// is only allowed if the CSR policy of the database allows key reuse.
+// Imported certificates can be renewed too, in which case a CSR is required and must match the subject of the certificate.
+// Like other requests, the renewal counts against the quota of the account the database is bound to.
+func (db *Database) RenewCSR(id string, csr string) (int64, error) {
+	predecessor, err := db.RetrieveCSR(id)
+	if err != nil {
+		return 0, err
+	}
+	if predecessor.SuccessorID != 0 {
+		return 0, ErrAlreadyRenewed
+	}
+	if predecessor.Certificate == "" || predecessor.Certificate == "rejected" {
+		return 0, ErrNotIssued
+	}
+	if csr == "" {
+		if predecessor.CSR == "" {
+			return 0, fmt.Errorf("%w: a csr is required to renew an imported certificate", ErrInvalidCSR)
+		}
+		csr = predecessor.CSR
+	}
+	parsedCSR, err := parseCertificateRequest(csr)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidCSR, err)
+	}
+	predecessorSubject, predecessorPublicKey, err := predecessor.identity()
+	if err != nil {
+		return 0, err
+	}
+	if parsedCSR.Subject.String() != predecessorSubject.String() {
+		return 0, fmt.Errorf("%w: subject %q doesn't match the subject %q of the renewed request", ErrInvalidCSR, parsedCSR.Subject, predecessorSubject)
+	}
+	predecessorKey, ok := predecessorPublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if ok && predecessorKey.Equal(parsedCSR.PublicKey) && !db.policy().AllowKeyReuse {
+		return 0, fmt.Errorf("%w: reusing the key of the renewed request is not allowed", ErrInvalidCSR)
+	}
+	if err := db.policy().Check(parsedCSR); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidCSR, err)
+	}
+	return db.insertCSR(csr, predecessor.ProfileID, predecessor.ID)
+}
+
+// RetrieveCurrentCSR returns the most recent request with an issued certificate in the renewal lineage
+// of the request with the given id. Renewals that are pending or were rejected are skipped.
+func (db *Database) RetrieveCurrentCSR(id string) (CertificateRequest, error) {
+	csr, err := db.RetrieveCSR(id)
+	if err != nil {
+		return csr, err
+	}
+	for csr.SuccessorID != 0 {
+		csr, err = db.RetrieveCSR(fmt.Sprint(csr.SuccessorID))
+		if err != nil {
+			return csr, err
+		}
+	}
+	for csr.Certificate == "" || csr.Certificate == "rejected" {
+		if csr.PredecessorID == 0 {
+			return CertificateRequest{}, ErrNotIssued
+		}
+		csr, err = db.RetrieveCSR(fmt.Sprint(csr.PredecessorID))
+		if err != nil {
+			return csr, err
+		}
+	}
+	return csr, nil
+}
+
 // DeleteCSR removes a CSR from the database alongside the certificate that may have been generated for it.
+// If the CSR was part of a renewal lineage, its successor is linked to its predecessor so the lineage stays intact.
 func (db *Database) DeleteCSR(id string) (int64, error) {
-	result, err := db.conn.Exec(fmt.Sprintf(queryDeleteCSR, db.certificateTable), id)
+	csr, err := db.RetrieveCSR(id)
 	if err != nil {
 		return 0, err
 	}
-	deleteId, err := result.RowsAffected()
+	var deleteId int64
+	err = db.Transaction(func(tx *Database) error {
+		result, err := tx.querier().Exec(fmt.Sprintf(queryDeleteCSR, tx.certificateTable), csr.ID)
+		if err != nil {
+			return err
+		}
+		deleteId, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if deleteId == 0 {
+			return ErrIdNotFound
+		}
+		_, err = tx.querier().Exec(fmt.Sprintf(queryRelinkSuccessor, tx.certificateTable), csr.PredecessorID, csr.ID)
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
-	if deleteId == 0 {
-		return 0, ErrIdNotFound
-	}
 	return deleteId, nil
 }
 
+// SetCSRPolicy replaces the policy that new certificate requests are validated against.
+func (db *Database) SetCSRPolicy(policy CSRPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("invalid csr policy: %w", err)
+	}
+	db.csrPolicy.Store(&policy)
+	return nil
+}
+
+// policy returns the policy that new certificate requests are validated against.
+func (db *Database) policy() *CSRPolicy {
+	return db.csrPolicy.Load()
+}
+
 // RetrieveAllUsers returns all of the users and their fields available in the database.
 func (db *Database) RetrieveAllUsers() ([]User, error) {
-	rows, err := db.conn.Query(fmt.Sprintf(queryGetAllUsers, db.usersTable))
+	rows, err := db.querier().Query(fmt.Sprintf(queryGetAllUsers, db.usersTable))
 	if err != nil {
 		return nil, err
 	}
@@ -181,7 +402,7 @@ func (db *Database) RetrieveAllUsers() ([]User, error) {
 // RetrieveUser retrieves the name, password and the permission level of a user.
 func (db *Database) RetrieveUser(id string) (User, error) {
 	var newUser User
-	row := db.conn.QueryRow(fmt.Sprintf(queryGetUser, db.usersTable), id)
+	row := db.querier().QueryRow(fmt.Sprintf(queryGetUser, db.usersTable), id)
 	if err := row.Scan(&newUser.ID, &newUser.Username, &newUser.Password, &newUser.Permissions); err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			return newUser, ErrIdNotFound
@@ -194,7 +415,7 @@ func (db *Database) RetrieveUser(id string) (User, error) {
 // RetrieveUser retrieves the id, password and the permission level of a user.
 func (db *Database) RetrieveUserByUsername(name string) (User, error) {
 	var newUser User
-	row := db.conn.QueryRow(fmt.Sprintf(queryGetUserByUsername, db.usersTable), name)
+	row := db.querier().QueryRow(fmt.Sprintf(queryGetUserByUsername, db.usersTable), name)
 	if err := row.Scan(&newUser.ID, &newUser.Username, &newUser.Password, &newUser.Permissions); err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			return newUser, ErrIdNotFound
@@ -204,16 +425,27 @@ func (db *Database) RetrieveUserByUsername(name string) (User, error) {
 	return newUser, nil
 }
 
+// hashPassword hashes and salts the password in its own span, as hashing is slow on purpose.
+func (db *Database) hashPassword(password string) ([]byte, error) {
+	_, span := tracing.Tracer(tracerName).Start(db.context(), "hash password")
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	tracing.End(span, err)
+	return hash, err
+}
+
 // CreateUser creates a new user from a given username, password and permission level.
 // The permission level 1 represents an admin, and a 0 represents a regular user.
 // The password passed in should be in plaintext. This function handles hashing and salting the password before storing it in the database.
 func (db *Database) CreateUser(username string, password string, permission int) (int64, error) {
-	pw, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	pw, err := db.hashPassword(password)
 	if err != nil {
 		return 0, err
 	}
-	result, err := db.conn.Exec(fmt.Sprintf(queryCreateUser, db.usersTable), username, pw, permission)
+	result, err := db.querier().Exec(fmt.Sprintf(queryCreateUser, db.usersTable), username, pw, permission)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrAlreadyExists
+		}
 		return 0, err
 	}
 	id, err := result.LastInsertId()
@@ -230,11 +462,11 @@ func (db *Database) UpdateUser(id, password string) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	pw, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	pw, err := db.hashPassword(password)
 	if err != nil {
 		return 0, err
 	}
-	result, err := db.conn.Exec(fmt.Sprintf(queryUpdateUser, db.usersTable), pw, user.ID)
+	result, err := db.querier().Exec(fmt.Sprintf(queryUpdateUser, db.usersTable), pw, user.ID)
 	if err != nil {
 		return 0, err
 	}
@@ -245,9 +477,40 @@ func (db *Database) UpdateUser(id, password string) (int64, error) {
 	return affectedRows, nil
 }
 
+// UpdateUserPermissions sets the permission level of the given user.
+func (db *Database) UpdateUserPermissions(id string, permissions int) (int64, error) {
+	user, err := db.RetrieveUser(id)
+	if err != nil {
+		return 0, err
+	}
+	result, err := db.querier().Exec(fmt.Sprintf(queryUpdatePermissions, db.usersTable), permissions, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ValidatePassword reports whether a password meets the PasswordRequirements.
+func ValidatePassword(password string) bool {
+	if len(password) < 8 {
+		return false
+	}
+	hasCapital := regexp.MustCompile(`[A-Z]`).MatchString(password)
+	if !hasCapital {
+		return false
+	}
+	hasLower := regexp.MustCompile(`[a-z]`).MatchString(password)
+	if !hasLower {
+		return false
+	}
+	hasNumberOrSymbol := regexp.MustCompile(`[0-9!@#$%^&*()_+\-=\[\]{};':"|,.<>?~]`).MatchString(password)
+
+	return hasNumberOrSymbol
+}
+
 // DeleteUser removes a user from the table.
 func (db *Database) DeleteUser(id string) (int64, error) {
-	result, err := db.conn.Exec(fmt.Sprintf(queryDeleteUser, db.usersTable), id)
+	result, err := db.querier().Exec(fmt.Sprintf(queryDeleteUser, db.usersTable), id)
 	if err != nil {
 		return 0, err
 	}
@@ -264,7 +527,7 @@ func (db *Database) DeleteUser(id string) (int64, error) {
 // NumUsers returns the number of users in the database.
 func (db *Database) NumUsers() (int, error) {
 	var numUsers int
-	row := db.conn.QueryRow(fmt.Sprintf(queryGetNumUsers, db.usersTable))
+	row := db.querier().QueryRow(fmt.Sprintf(queryGetNumUsers, db.usersTable))
 	if err := row.Scan(&numUsers); err != nil {
 		return 0, err
 	}
@@ -287,19 +550,65 @@ func (db *Database) Close() error {
 // The database path must be a valid file path or ":memory:".
 // The table will be created if it doesn't exist in the format expected by the package.
 func NewDatabase(databasePath string) (*Database, error) {
-	conn, err := sql.Open("sqlite3", databasePath)
+	// Transactions take the write lock when they begin, waiting for other writers like any other query. A deferred
+	// transaction that reads before it writes would instead fail right away when another writer holds the lock.
+	dsn := databaseURI(databasePath, "_txlock=immediate")
+	if databasePath == ":memory:" {
+		dsn = databasePath
+	}
+	conn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
+	if databasePath == ":memory:" {
+		// Every connection to :memory: opens a distinct empty database, so all queries must share a single one.
+		conn.SetMaxOpenConns(1)
+	}
 	if _, err := conn.Exec(fmt.Sprintf(queryCreateCSRsTable, certificateRequestsTableName)); err != nil {
 		return nil, err
 	}
 	if _, err := conn.Exec(fmt.Sprintf(queryCreateUsersTable, usersTableName)); err != nil {
 		return nil, err
 	}
+	if err := migrate(conn); err != nil {
+		return nil, err
+	}
+	return newDatabase(conn), nil
+}
+
+// OpenReadOnly connects to an existing database without creating or migrating anything, so that it can be
+// backed up or checked while a server uses it, or while it may be damaged. Writes to it fail.
+func OpenReadOnly(databasePath string) (*Database, error) {
+	if _, err := os.Stat(databasePath); err != nil {
+		return nil, err
+	}
+	conn, err := sql.Open("sqlite3", databaseURI(databasePath, "mode=ro"))
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newDatabase(conn), nil
+}
+
+// databaseURI returns the URI the driver opens the database file at the given path with, along with the given query.
+// The path is escaped, so that characters such as ?, # and % are part of the file name rather than of the URI.
+func databaseURI(path string, query string) string {
+	uri := url.URL{Scheme: "file", Path: path, OmitHost: true, RawQuery: query}
+	return uri.String()
+}
+
+func newDatabase(conn *sql.DB) *Database {
 	db := new(Database)
 	db.conn = conn
 	db.certificateTable = certificateRequestsTableName
 	db.usersTable = usersTableName
-	return db, nil
+	db.profilesTable = profilesTableName
+	db.csrPolicy = &atomic.Pointer[CSRPolicy]{}
+	db.csrPolicy.Store(&CSRPolicy{})
+	db.notifier = newNotifier()
+	db.pendingQuota = &atomic.Int64{}
+	return db
 }
@@ -1,6 +1,7 @@
 package db_test
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -85,32 +86,39 @@ func TestCSRsEndToEnd(t *testing.T) {
 }
 
 func TestCreateFails(t *testing.T) {
-	db, _ := db.NewDatabase(":memory:")
-	defer db.Close()
+	database, _ := db.NewDatabase(":memory:")
+	defer database.Close()
 
 	InvalidCSR := strings.ReplaceAll(AppleCSR, "M", "i")
-	if _, err := db.CreateCSR(InvalidCSR); err == nil {
-		t.Fatalf("Expected error due to invalid CSR")
+	if _, err := database.CreateCSR(InvalidCSR); !errors.Is(err, db.ErrInvalidCSR) {
+		t.Fatalf("Expected error due to invalid CSR, got %v", err)
 	}
 
-	db.CreateCSR(AppleCSR) //nolint:errcheck
-	if _, err := db.CreateCSR(AppleCSR); err == nil {
-		t.Fatalf("Expected error due to duplicate CSR")
+	database.CreateCSR(AppleCSR) //nolint:errcheck
+	if _, err := database.CreateCSR(AppleCSR); !errors.Is(err, db.ErrAlreadyExists) {
+		t.Fatalf("Expected error due to duplicate CSR, got %v", err)
+	}
+	database.CreateUser("admin", "Admin123", db.AdminPermission) //nolint:errcheck
+	if _, err := database.CreateUser("admin", "Admin123", db.UserPermission); !errors.Is(err, db.ErrAlreadyExists) {
+		t.Fatalf("Expected error due to duplicate username, got %v", err)
 	}
 }
 
 func TestUpdateFails(t *testing.T) {
-	db, _ := db.NewDatabase(":memory:")
-	defer db.Close()
+	database, _ := db.NewDatabase(":memory:")
+	defer database.Close()
 
-	id1, _ := db.CreateCSR(AppleCSR)  //nolint:errcheck
-	id2, _ := db.CreateCSR(BananaCSR) //nolint:errcheck
+	id1, _ := database.CreateCSR(AppleCSR)  //nolint:errcheck
+	id2, _ := database.CreateCSR(BananaCSR) //nolint:errcheck
 	InvalidCert := strings.ReplaceAll(BananaCert, "/", "+")
-	if _, err := db.UpdateCSR(strconv.FormatInt(id2, 10), InvalidCert); err == nil {
+	if _, err := database.UpdateCSR(strconv.FormatInt(id2, 10), InvalidCert); err == nil {
 		t.Fatalf("Expected updating with invalid cert to fail")
 	}
-	if _, err := db.UpdateCSR(strconv.FormatInt(id1, 10), BananaCert); err == nil {
-		t.Fatalf("Expected updating with mismatched cert to fail")
+	if _, err := database.UpdateCSR(strconv.FormatInt(id1, 10), BananaCert+"\n"+IssuerCert); !errors.Is(err, db.ErrInvalidCertificate) || !errors.Is(err, db.ErrCertificateMismatch) {
+		t.Fatalf("Expected updating with mismatched cert to fail, got %v", err)
+	}
+	if _, err := database.UpdateCSR(strconv.FormatInt(id2, 10), IssuerCert+"\n"+BananaCert); !errors.Is(err, db.ErrInvalidCertificate) || !errors.Is(err, db.ErrInvalidChain) {
+		t.Fatalf("Expected updating with an invalid chain to fail, got %v", err)
 	}
 }
 
@@ -181,6 +189,33 @@ func TestUsersEndToEnd(t *testing.T) {
 	if err := bcrypt.CompareHashAndPassword([]byte(retrievedUser.Password), []byte("thebestpassword")); err != nil {
 		t.Fatalf("The new password that was given does not match the password that was stored.")
 	}
+
+	if _, err := db.UpdateUserPermissions(strconv.FormatInt(id2, 10), 1); err != nil {
+		t.Fatalf("Couldn't complete UpdateUserPermissions: %s", err)
+	}
+	retrievedUser, _ = db.RetrieveUser(strconv.FormatInt(id2, 10))
+	if retrievedUser.Permissions != 1 {
+		t.Fatalf("The user wasn't promoted to admin")
+	}
+	if _, err := db.UpdateUserPermissions("100", 1); err == nil {
+		t.Fatalf("Expected UpdateUserPermissions of a missing user to fail")
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	cases := map[string]bool{
+		"Admin123":  true,
+		"userPass!": true,
+		"short1A":   false,
+		"alllower1": false,
+		"ALLUPPER1": false,
+		"NoNumbers": false,
+	}
+	for password, valid := range cases {
+		if db.ValidatePassword(password) != valid {
+			t.Errorf("expected ValidatePassword(%q) to be %v", password, valid)
+		}
+	}
 }
 
 func Example() {
@@ -208,3 +243,64 @@ func Example() {
 		log.Fatalln(err)
 	}
 }
+
+func TestRenewCSR(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+
+	id, err := database.CreateCSR(BananaCSR)
+	if err != nil {
+		t.Fatalf("Couldn't complete Create: %s", err)
+	}
+	firstID := strconv.FormatInt(id, 10)
+	if _, err := database.RenewCSR(firstID, ""); !errors.Is(err, db.ErrNotIssued) {
+		t.Fatalf("Expected renewing a request without a certificate to fail, got: %v", err)
+	}
+	BananaCertBundle := strings.TrimSpace(fmt.Sprintf("%s%s", BananaCert, IssuerCert))
+	if _, err := database.UpdateCSR(firstID, BananaCertBundle); err != nil {
+		t.Fatalf("Couldn't complete Update: %s", err)
+	}
+	if _, err := database.RenewCSR(firstID, ""); err == nil {
+		t.Fatalf("Expected reusing the key to fail when the policy doesn't allow it")
+	}
+	if err := database.SetCSRPolicy(db.CSRPolicy{AllowKeyReuse: true}); err != nil {
+		t.Fatalf("Couldn't set csr policy: %s", err)
+	}
+	secondID, err := database.RenewCSR(firstID, "")
+	if err != nil {
+		t.Fatalf("Couldn't renew with key reuse: %s", err)
+	}
+	if _, err := database.RenewCSR(firstID, ""); !errors.Is(err, db.ErrAlreadyRenewed) {
+		t.Fatalf("Expected renewing a request twice to fail, got: %v", err)
+	}
+	if _, err := database.UpdateCSR(strconv.FormatInt(secondID, 10), BananaCertBundle); err != nil {
+		t.Fatalf("Couldn't complete Update: %s", err)
+	}
+	thirdID, err := database.RenewCSR(strconv.FormatInt(secondID, 10), "")
+	if err != nil {
+		t.Fatalf("Couldn't renew the renewal: %s", err)
+	}
+
+	current, err := database.RetrieveCurrentCSR(firstID)
+	if err != nil {
+		t.Fatalf("Couldn't retrieve current request: %s", err)
+	}
+	if current.ID != int(secondID) {
+		t.Fatalf("Expected the current request to be %d, got %d", secondID, current.ID)
+	}
+
+	if _, err := database.DeleteCSR(strconv.FormatInt(secondID, 10)); err != nil {
+		t.Fatalf("Couldn't complete Delete: %s", err)
+	}
+	third, _ := database.RetrieveCSR(strconv.FormatInt(thirdID, 10))
+	if third.PredecessorID != int(id) {
+		t.Fatalf("Expected the lineage to be relinked after deleting a request, got predecessor %d", third.PredecessorID)
+	}
+	first, _ := database.RetrieveCSR(firstID)
+	if first.SuccessorID != int(thirdID) {
+		t.Fatalf("Expected the first request to link to the third one, got successor %d", first.SuccessorID)
+	}
+}
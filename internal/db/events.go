@@ -0,0 +1,91 @@
+package db
+
+import (
+	"sync"
+	"time"
+)
+
+// Types of the events in the lifecycle of a certificate request.
+const (
+	EventIssued   = "issued"
+	EventRejected = "rejected"
+	EventRevoked  = "revoked"
+)
+
+// CertificateEvent is a change in the lifecycle of a certificate request: a certificate was issued for it,
+// it was rejected, or its certificate was revoked.
+// SubmittedAt is when the request was created, and is zero for requests created before it was recorded.
+type CertificateEvent struct {
+	Type        string
+	RequestID   int
+	SubmittedAt time.Time
+	Time        time.Time
+}
+
+// notifier publishes the writes to certificate requests, and is shared by every copy of the database.
+type notifier struct {
+	changes   chan struct{}
+	mu        sync.Mutex
+	observers []func(CertificateEvent)
+}
+
+func newNotifier() *notifier {
+	return &notifier{changes: make(chan struct{}, 1)}
+}
+
+// publish signals a change, and passes the events to every observer.
+func (n *notifier) publish(events []CertificateEvent) {
+	select {
+	case n.changes <- struct{}{}:
+	default:
+	}
+	n.mu.Lock()
+	observers := n.observers
+	n.mu.Unlock()
+	for _, event := range events {
+		for _, observe := range observers {
+			observe(event)
+		}
+	}
+}
+
+// Changes returns a channel that receives a value after certificate requests or certificates are written.
+// Writes made in a transaction are signalled once it is committed, and every committed transaction is signalled
+// whatever it wrote. Writes that happen before the previous one was received are signalled only once,
+// so the channel must have a single receiver, which reads the current state of the database when signalled.
+func (db *Database) Changes() <-chan struct{} {
+	return db.notifier.changes
+}
+
+// OnCertificateEvent calls observe with every event in the lifecycle of certificate requests, once the write that
+// caused it is committed. Events of a transaction that is rolled back are dropped.
+// observe is called by the goroutine that made the write, so it must not block.
+func (db *Database) OnCertificateEvent(observe func(CertificateEvent)) {
+	db.notifier.mu.Lock()
+	defer db.notifier.mu.Unlock()
+	db.notifier.observers = append(db.notifier.observers, observe)
+}
+
+// certificatesChanged publishes that certificate requests or certificates were written, with the events the writes
+// caused. When the database is bound to a transaction, they are published once it is committed instead.
+func (db *Database) certificatesChanged(events ...CertificateEvent) {
+	if db.tx != nil {
+		*db.txEvents = append(*db.txEvents, events...)
+		return
+	}
+	db.notifier.publish(events)
+}
+
+// certificateEventType returns the type of the event caused by replacing the certificate of a request,
+// or "" when there is none, as when the certificate of a request that has none is deleted.
+func certificateEventType(previous string, cert string) string {
+	switch {
+	case cert == "rejected":
+		return EventRejected
+	case cert != "":
+		return EventIssued
+	case certificateStatus(previous) == statusIssued:
+		return EventRevoked
+	}
+	return ""
+}
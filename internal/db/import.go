@@ -0,0 +1,133 @@
+package db
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	queryGetCSRIDByFingerprint = "SELECT id FROM %s WHERE fingerprint=? LIMIT 1"
+	queryImportCertificate     = "INSERT INTO %s (csr, certificate, fingerprint, status, not_after, created_at) VALUES ('', ?, ?, 'imported', ?, ?)"
+)
+
+// ImportCertificate records a certificate that was issued outside of Notary, so that it is listed and monitored
+// like any certificate issued for a request. The given bundle must start with the certificate, optionally followed
+// by its issuers in order. It returns the id of the entry holding the certificate, and whether it was created.
+// A certificate that is already known, imported or issued, isn't imported again and the id of the existing entry is returned.
+func (db *Database) ImportCertificate(bundle string) (int64, bool, error) {
+	certificates, err := parseCertificateBundle(bundle)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
+	}
+	if len(certificates) == 0 {
+		return 0, false, fmt.Errorf("%w: no certificate PEM strings were found", ErrInvalidCertificate)
+	}
+	if err := validateCertificateChain(certificates); err != nil {
+		return 0, false, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
+	}
+	bundle = sanitizeCertificateBundle(bundle)
+	fingerprint := certificateFingerprint(bundle)
+	if id, err := db.csrIDByFingerprint(fingerprint); err == nil {
+		return id, false, nil
+	} else if !errors.Is(err, ErrIdNotFound) {
+		return 0, false, err
+	}
+	result, err := db.querier().Exec(fmt.Sprintf(queryImportCertificate, db.certificateTable), bundle, fingerprint, certificateNotAfter(bundle), time.Now().Unix())
+	if err != nil {
+		if isUniqueViolation(err) {
+			id, err := db.csrIDByFingerprint(fingerprint)
+			return id, false, err
+		}
+		return 0, false, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, false, err
+	}
+	db.certificatesChanged()
+	return id, true, nil
+}
+
+func (db *Database) csrIDByFingerprint(fingerprint string) (int64, error) {
+	var id int64
+	row := db.querier().QueryRow(fmt.Sprintf(queryGetCSRIDByFingerprint, db.certificateTable), fingerprint)
+	if err := row.Scan(&id); err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return 0, ErrIdNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// SplitCertificateBundles splits PEM data holding any number of certificates, each optionally followed by its issuers,
+// into one bundle per certificate. A certificate starts a new bundle unless it issued the certificate before it.
+// PEM blocks that aren't certificates, such as private keys, are ignored.
+func SplitCertificateBundles(data string) []string {
+	var bundles []string
+	var current bytes.Buffer
+	var previous *x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		issuesPrevious := err == nil && previous != nil &&
+			bytes.Equal(previous.RawIssuer, cert.RawSubject) && previous.CheckSignatureFrom(cert) == nil
+		if !issuesPrevious && current.Len() > 0 {
+			bundles = append(bundles, current.String())
+			current.Reset()
+		}
+		pem.Encode(&current, block) //nolint:errcheck
+		previous = cert
+	}
+	if current.Len() > 0 {
+		bundles = append(bundles, current.String())
+	}
+	return bundles
+}
+
+// certificateFingerprint returns the hex encoded SHA-256 fingerprint of the first certificate in the given bundle,
+// or an empty string if there is none.
+func certificateFingerprint(bundle string) string {
+	block, _ := pem.Decode([]byte(bundle))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return ""
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// identity returns the subject and public key that a renewal of the request must keep.
+// Imported certificates have no CSR, so the subject and key of the certificate are used instead.
+func (csr CertificateRequest) identity() (pkix.Name, crypto.PublicKey, error) {
+	if csr.CSR != "" {
+		parsed, err := parseCertificateRequest(csr.CSR)
+		if err != nil {
+			return pkix.Name{}, nil, err
+		}
+		return parsed.Subject, parsed.PublicKey, nil
+	}
+	certificates, err := parseCertificateBundle(csr.Certificate)
+	if err != nil {
+		return pkix.Name{}, nil, err
+	}
+	if len(certificates) == 0 {
+		return pkix.Name{}, nil, ErrNotIssued
+	}
+	return certificates[0].Subject, certificates[0].PublicKey, nil
+}
@@ -0,0 +1,87 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+func TestSplitCertificateBundles(t *testing.T) {
+	data := BananaCert + "\n" + IssuerCert + "\n" + StrawberryCert + "\n" + IssuerCert + "\n" + StrawberryCert
+	bundles := db.SplitCertificateBundles(data)
+	if len(bundles) != 3 {
+		t.Fatalf("expected 3 bundles, got %d", len(bundles))
+	}
+	if strings.Count(bundles[0], "BEGIN CERTIFICATE") != 2 || strings.Count(bundles[2], "BEGIN CERTIFICATE") != 1 {
+		t.Fatalf("certificates weren't grouped with their issuers: %v", bundles)
+	}
+	if len(db.SplitCertificateBundles(AppleCSR)) != 0 {
+		t.Fatalf("expected PEM blocks that aren't certificates to be ignored")
+	}
+}
+
+func TestImportCertificate(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+
+	id, created, err := database.ImportCertificate(StrawberryCert + "\n" + IssuerCert)
+	if err != nil || !created {
+		t.Fatalf("Couldn't import certificate: %v", err)
+	}
+	duplicateID, created, err := database.ImportCertificate(StrawberryCert)
+	if err != nil || created || duplicateID != id {
+		t.Fatalf("Expected the certificate to be deduplicated by fingerprint, got id %d, created %t, err %v", duplicateID, created, err)
+	}
+
+	csrID, _ := database.CreateCSR(BananaCSR)
+	if _, err := database.UpdateCSR(fmt.Sprint(csrID), BananaCert+"\n"+IssuerCert); err != nil {
+		t.Fatalf("Couldn't issue certificate: %s", err)
+	}
+	issuedID, created, err := database.ImportCertificate(BananaCert)
+	if err != nil || created || issuedID != csrID {
+		t.Fatalf("Expected an issued certificate not to be imported again, got id %d, created %t, err %v", issuedID, created, err)
+	}
+
+	csrs, err := database.RetrieveAllCSRs()
+	if err != nil {
+		t.Fatalf("Couldn't complete RetrieveAll: %s", err)
+	}
+	if len(csrs) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(csrs))
+	}
+	imported, _ := database.RetrieveCSR(fmt.Sprint(id))
+	if imported.CSR != "" || imported.Fingerprint == "" || imported.Fingerprint == csrs[1].Fingerprint {
+		t.Fatalf("Unexpected imported entry: %+v", imported)
+	}
+
+	if _, err := database.UpdateCSR(fmt.Sprint(id), "rejected"); !errors.Is(err, db.ErrImported) {
+		t.Fatalf("Expected updating an imported certificate to fail, got %v", err)
+	}
+	if _, err := database.RenewCSR(fmt.Sprint(id), ""); err == nil {
+		t.Fatalf("Expected renewing an imported certificate without a CSR to fail")
+	}
+	if _, err := database.RenewCSR(fmt.Sprint(id), StrawberryCSR); err == nil || !strings.Contains(err.Error(), "reusing the key") {
+		t.Fatalf("Expected the key of the imported certificate to be checked, got %v", err)
+	}
+}
+
+func TestImportCertificateFails(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+
+	cases := []string{"", AppleCSR, BananaCert + "\n" + WrongSubjectIssuerCert}
+	for _, bundle := range cases {
+		if _, _, err := database.ImportCertificate(bundle); err == nil || !strings.HasPrefix(err.Error(), "cert validation failed") {
+			t.Fatalf("Expected import to fail validation, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations bring the schema of an existing database up to date.
+// They are applied in order, and the position of a migration in the list plus one
+// is the schema version the database has once it has been applied.
+// The schema version is stored in the user_version pragma of the SQLite database.
+// Migrations must never be edited or reordered once released, only appended to.
+var migrations = []func(tx *sql.Tx) error{
+	migrateCertificateProfiles,
+	migrateRenewalLinks,
+	migrateImportedCertificates,
+	migrateCertificateStatus,
+	migrateCreationTimes,
+	migrateRequestOwners,
+}
+
+// SchemaVersion is the schema version of a database that has every migration applied.
+var SchemaVersion = len(migrations)
+
+// migrate applies every migration the database hasn't seen yet, each in its own transaction.
+func migrate(conn *sql.DB) error {
+	version, err := schemaVersion(conn)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than the supported version %d", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := conn.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[i](tx); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return fmt.Errorf("couldn't apply migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback() //nolint:errcheck
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func schemaVersion(conn *sql.DB) (int, error) {
+	var version int
+	if err := conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// migrateCertificateProfiles creates the certificate profiles table, seeds it with the default profiles,
+// and lets certificate requests reference a profile.
+func migrateCertificateProfiles(tx *sql.Tx) error {
+	if _, err := tx.Exec(fmt.Sprintf(queryCreateProfilesTable, profilesTableName)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN profile_id INTEGER NOT NULL DEFAULT 0", certificateRequestsTableName)); err != nil {
+		return err
+	}
+	for _, profile := range DefaultCertificateProfiles() {
+		if _, err := insertCertificateProfile(tx, profilesTableName, profile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateRenewalLinks rebuilds the certificate requests table with a stable id column and a link to the
+// request each renewal replaces. A CSR only has to be unique among requests that aren't renewals,
+// so that a renewal can reuse the CSR of its predecessor, and every request can be renewed at most once.
+func migrateRenewalLinks(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE certificate_requests_new (
+			id INTEGER PRIMARY KEY,
+			csr TEXT NOT NULL,
+			certificate TEXT DEFAULT '',
+			profile_id INTEGER NOT NULL DEFAULT 0,
+			predecessor_id INTEGER NOT NULL DEFAULT 0
+		)`,
+		fmt.Sprintf("INSERT INTO certificate_requests_new (id, csr, certificate, profile_id) SELECT rowid, csr, certificate, profile_id FROM %s", certificateRequestsTableName),
+		fmt.Sprintf("DROP TABLE %s", certificateRequestsTableName),
+		fmt.Sprintf("ALTER TABLE certificate_requests_new RENAME TO %s", certificateRequestsTableName),
+		fmt.Sprintf("CREATE UNIQUE INDEX certificate_requests_csr ON %s (csr) WHERE predecessor_id = 0", certificateRequestsTableName),
+		fmt.Sprintf("CREATE UNIQUE INDEX certificate_requests_predecessor ON %s (predecessor_id) WHERE predecessor_id != 0", certificateRequestsTableName),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateImportedCertificates records the fingerprint of every issued certificate, so that imported certificates
+// can be deduplicated against them. Imported certificates have no CSR, so they are left out of the CSR uniqueness
+// constraint and are instead unique by fingerprint.
+func migrateImportedCertificates(tx *sql.Tx) error {
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN fingerprint TEXT NOT NULL DEFAULT ''", certificateRequestsTableName),
+		"DROP INDEX certificate_requests_csr",
+		fmt.Sprintf("CREATE UNIQUE INDEX certificate_requests_csr ON %s (csr) WHERE predecessor_id = 0 AND csr != ''", certificateRequestsTableName),
+		fmt.Sprintf("CREATE UNIQUE INDEX certificate_requests_imported ON %s (fingerprint) WHERE csr = ''", certificateRequestsTableName),
+		fmt.Sprintf("CREATE INDEX certificate_requests_fingerprint ON %s (fingerprint)", certificateRequestsTableName),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	rows, err := tx.Query(fmt.Sprintf("SELECT id, certificate FROM %s WHERE certificate NOT IN ('', 'rejected')", certificateRequestsTableName))
+	if err != nil {
+		return err
+	}
+	fingerprints := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var certificate string
+		if err := rows.Scan(&id, &certificate); err != nil {
+			rows.Close()
+			return err
+		}
+		fingerprints[id] = certificateFingerprint(certificate)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, fingerprint := range fingerprints {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET fingerprint=? WHERE id=?", certificateRequestsTableName), fingerprint, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateCertificateStatus stores the status of every request and the expiry of its certificate, and indexes them
+// together, so that requests can be counted by status and certificates by expiry without reading their PEM data.
+// Expiries are in seconds since the epoch, and are NULL for requests without a certificate.
+func migrateCertificateStatus(tx *sql.Tx) error {
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN status TEXT NOT NULL DEFAULT 'outstanding'", certificateRequestsTableName),
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN not_after INTEGER", certificateRequestsTableName),
+		fmt.Sprintf(`UPDATE %s SET status = CASE
+			WHEN csr = '' THEN 'imported'
+			WHEN certificate = 'rejected' THEN 'rejected'
+			WHEN certificate != '' THEN 'issued'
+			ELSE 'outstanding' END`, certificateRequestsTableName),
+		fmt.Sprintf("CREATE INDEX certificate_requests_status ON %s (status, not_after)", certificateRequestsTableName),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	rows, err := tx.Query(fmt.Sprintf("SELECT id, certificate FROM %s WHERE status IN ('issued', 'imported')", certificateRequestsTableName))
+	if err != nil {
+		return err
+	}
+	expiries := make(map[int]sql.NullInt64)
+	for rows.Next() {
+		var id int
+		var certificate string
+		if err := rows.Scan(&id, &certificate); err != nil {
+			rows.Close()
+			return err
+		}
+		expiries[id] = certificateNotAfter(certificate)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, expiry := range expiries {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET not_after=? WHERE id=?", certificateRequestsTableName), expiry, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateCreationTimes records when every request is submitted, in seconds since the epoch.
+// It is NULL for the requests that already exist, as when they were submitted is unknown.
+func migrateCreationTimes(tx *sql.Tx) error {
+	_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN created_at INTEGER", certificateRequestsTableName))
+	return err
+}
+
+// migrateRequestOwners records the account that submitted every request, and indexes the requests by account and
+// status so that the outstanding requests of an account can be counted. It is NULL for the requests that already
+// exist, as who submitted them is unknown.
+func migrateRequestOwners(tx *sql.Tx) error {
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN owner_id INTEGER", certificateRequestsTableName)); err != nil {
+		return err
+	}
+	_, err := tx.Exec(fmt.Sprintf("CREATE INDEX certificate_requests_owner ON %s (owner_id, status)", certificateRequestsTableName))
+	return err
+}
@@ -0,0 +1,250 @@
+package db
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Subject fields that can be required by a CSRPolicy.
+const (
+	SubjectCommonName         = "common_name"
+	SubjectOrganization       = "organization"
+	SubjectOrganizationalUnit = "organizational_unit"
+	SubjectCountry            = "country"
+	SubjectProvince           = "province"
+	SubjectLocality           = "locality"
+)
+
+// CSRPolicy describes the constraints a certificate request must satisfy before it is accepted.
+// The zero value places no constraints on a request beyond it being a well formed and correctly signed CSR.
+// AllowKeyReuse only applies to renewals, which may use the key of the request they renew when it is set.
+//
+// SAN patterns are shell patterns as understood by path.Match, and are matched against every SAN of the request
+// according to its type. DNS names are matched case-insensitively label by label, so that * covers exactly one
+// label: *.example.com matches a.example.com but neither example.com nor a.b.example.com. Email addresses and URIs
+// are matched case-insensitively as a whole, with * also covering slashes. IP addresses match a pattern that is
+// the same address, a CIDR range holding it, or a shell pattern of its text form.
+type CSRPolicy struct {
+	MinRSAKeySize         int
+	AllowedCurves         []string
+	RequiredSubjectFields []string
+	AllowedSANPatterns    []string
+	ForbiddenSANPatterns  []string
+	ForbidWildcards       bool
+	MaxSANs               int
+	AllowKeyReuse         bool
+}
+
+// Validate makes sure the policy itself is usable: every curve and subject field must be known,
+// every SAN pattern must be well formed and limits must not be negative.
+func (p *CSRPolicy) Validate() error {
+	if p.MinRSAKeySize < 0 {
+		return errors.New("minimum rsa key size can't be negative")
+	}
+	if p.MaxSANs < 0 {
+		return errors.New("maximum number of SANs can't be negative")
+	}
+	for _, curve := range p.AllowedCurves {
+		if !slices.Contains([]string{"P-224", "P-256", "P-384", "P-521"}, curve) {
+			return fmt.Errorf("unknown curve %q", curve)
+		}
+	}
+	for _, field := range p.RequiredSubjectFields {
+		if _, ok := subjectFieldValue(&x509.CertificateRequest{}, field); !ok {
+			return fmt.Errorf("unknown subject field %q", field)
+		}
+	}
+	for _, pattern := range slices.Concat(p.AllowedSANPatterns, p.ForbiddenSANPatterns) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid SAN pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Check validates the given parsed certificate request against the policy.
+// The returned error describes the first rule the request violates and is meant to be shown to the requester.
+func (p *CSRPolicy) Check(csr *x509.CertificateRequest) error {
+	if err := p.checkPublicKey(csr); err != nil {
+		return err
+	}
+	for _, field := range p.RequiredSubjectFields {
+		value, _ := subjectFieldValue(csr, field)
+		if value == "" {
+			return fmt.Errorf("subject field %s is required", field)
+		}
+	}
+	sans := subjectAlternativeNames(csr)
+	if p.MaxSANs > 0 && len(sans) > p.MaxSANs {
+		return fmt.Errorf("request has %d SANs, the maximum allowed is %d", len(sans), p.MaxSANs)
+	}
+	for _, dnsName := range csr.DNSNames {
+		if !strings.Contains(dnsName, "*") {
+			continue
+		}
+		if p.ForbidWildcards {
+			return fmt.Errorf("wildcard SAN %s is not allowed", dnsName)
+		}
+		if !validWildcard(dnsName) {
+			return fmt.Errorf("wildcard SAN %s is malformed: only the leftmost label may be a wildcard", dnsName)
+		}
+	}
+	for _, san := range sans {
+		for _, pattern := range p.ForbiddenSANPatterns {
+			if san.matches(pattern) {
+				return fmt.Errorf("SAN %s is forbidden by pattern %s", san.value, pattern)
+			}
+		}
+		if len(p.AllowedSANPatterns) == 0 {
+			continue
+		}
+		if !slices.ContainsFunc(p.AllowedSANPatterns, san.matches) {
+			return fmt.Errorf("SAN %s does not match any allowed pattern", san.value)
+		}
+	}
+	return nil
+}
+
+func (p *CSRPolicy) checkPublicKey(csr *x509.CertificateRequest) error {
+	switch key := csr.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if size := key.N.BitLen(); size < p.MinRSAKeySize {
+			return fmt.Errorf("rsa key size %d is smaller than the minimum of %d", size, p.MinRSAKeySize)
+		}
+	case *ecdsa.PublicKey:
+		curve := key.Curve.Params().Name
+		if len(p.AllowedCurves) > 0 && !slices.Contains(p.AllowedCurves, curve) {
+			return fmt.Errorf("curve %s is not allowed, allowed curves are %s", curve, strings.Join(p.AllowedCurves, ", "))
+		}
+	case ed25519.PublicKey:
+		return nil
+	default:
+		return errors.New("unsupported public key type")
+	}
+	return nil
+}
+
+// subjectFieldValue returns the value of the named subject field in the given request,
+// and whether the name refers to a known field.
+func subjectFieldValue(csr *x509.CertificateRequest, field string) (string, bool) {
+	subject := csr.Subject
+	switch field {
+	case SubjectCommonName:
+		return subject.CommonName, true
+	case SubjectOrganization:
+		return strings.Join(subject.Organization, ""), true
+	case SubjectOrganizationalUnit:
+		return strings.Join(subject.OrganizationalUnit, ""), true
+	case SubjectCountry:
+		return strings.Join(subject.Country, ""), true
+	case SubjectProvince:
+		return strings.Join(subject.Province, ""), true
+	case SubjectLocality:
+		return strings.Join(subject.Locality, ""), true
+	}
+	return "", false
+}
+
+// sanType is the type of a subject alternative name, which decides how patterns are matched against it.
+type sanType int
+
+const (
+	sanDNS sanType = iota
+	sanEmail
+	sanIP
+	sanURI
+)
+
+// subjectAltName is a subject alternative name of a request.
+type subjectAltName struct {
+	typ   sanType
+	value string
+}
+
+func subjectAlternativeNames(csr *x509.CertificateRequest) []subjectAltName {
+	var sans []subjectAltName
+	for _, dnsName := range csr.DNSNames {
+		sans = append(sans, subjectAltName{sanDNS, dnsName})
+	}
+	for _, email := range csr.EmailAddresses {
+		sans = append(sans, subjectAltName{sanEmail, email})
+	}
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, subjectAltName{sanIP, ip.String()})
+	}
+	for _, uri := range csr.URIs {
+		sans = append(sans, subjectAltName{sanURI, uri.String()})
+	}
+	return sans
+}
+
+// matches reports whether the SAN matches the given pattern, following the rules of its type.
+func (san subjectAltName) matches(pattern string) bool {
+	switch san.typ {
+	case sanDNS:
+		return matchDNSName(pattern, san.value)
+	case sanIP:
+		return matchIP(pattern, san.value)
+	default:
+		return matchAcrossSlashes(strings.ToLower(pattern), strings.ToLower(san.value))
+	}
+}
+
+// matchDNSName matches a DNS name against a pattern label by label, ignoring case and a trailing dot,
+// so that a wildcard never covers more or less than one label.
+func matchDNSName(pattern string, dnsName string) bool {
+	patternLabels := strings.Split(strings.TrimSuffix(strings.ToLower(pattern), "."), ".")
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(dnsName), "."), ".")
+	if len(patternLabels) != len(labels) {
+		return false
+	}
+	for i, label := range labels {
+		if matched, _ := path.Match(patternLabels[i], label); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchIP matches the text form of an IP address against a pattern that is an address, a CIDR range or a shell pattern.
+func matchIP(pattern string, ip string) bool {
+	address := net.ParseIP(ip)
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		return network.Contains(address)
+	}
+	if patternAddress := net.ParseIP(pattern); patternAddress != nil {
+		return patternAddress.Equal(address)
+	}
+	matched, _ := path.Match(pattern, ip)
+	return matched
+}
+
+// matchAcrossSlashes is path.Match with slashes treated as any other character, so that * covers them.
+func matchAcrossSlashes(pattern string, name string) bool {
+	const slash = "\x00"
+	matched, _ := path.Match(strings.ReplaceAll(pattern, "/", slash), strings.ReplaceAll(name, "/", slash))
+	return matched
+}
+
+// validWildcard reports whether a wildcard DNS name only uses the wildcard as its full leftmost label,
+// and leaves at least two labels after it, as in *.example.com.
+func validWildcard(dnsName string) bool {
+	labels := strings.Split(dnsName, ".")
+	if labels[0] != "*" || len(labels) < 3 {
+		return false
+	}
+	for _, label := range labels[1:] {
+		if label == "" || strings.Contains(label, "*") {
+			return false
+		}
+	}
+	return true
+}
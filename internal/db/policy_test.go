@@ -0,0 +1,254 @@
+package db_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+// generateCSR creates a PEM encoded certificate request for the given key, subject and DNS SANs.
+func generateCSR(t *testing.T, key crypto.Signer, subject pkix.Name, dnsNames ...string) string {
+	t.Helper()
+	template := x509.CertificateRequest{
+		Subject:  subject,
+		DNSNames: dnsNames,
+	}
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	if err != nil {
+		t.Fatalf("couldn't create csr: %s", err)
+	}
+	var buff bytes.Buffer
+	if err := pem.Encode(&buff, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes}); err != nil {
+		t.Fatalf("couldn't encode csr: %s", err)
+	}
+	return buff.String()
+}
+
+func parseCSR(t *testing.T, csr string) *x509.CertificateRequest {
+	t.Helper()
+	block, _ := pem.Decode([]byte(csr))
+	parsedCSR, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatalf("couldn't parse csr: %s", err)
+	}
+	return parsedCSR
+}
+
+func TestCSRPolicyCheck(t *testing.T) {
+	rsa1024Key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	rsa2048Key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p256Key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	subject := pkix.Name{CommonName: "example.com", Organization: []string{"Canonical"}}
+
+	cases := []struct {
+		name        string
+		policy      db.CSRPolicy
+		csr         string
+		expectedErr string
+	}{
+		{
+			name:   "empty policy accepts anything",
+			policy: db.CSRPolicy{},
+			csr:    generateCSR(t, rsa1024Key, pkix.Name{}, "*.example.com", "a.example.com"),
+		},
+		{
+			name:        "rsa key too small",
+			policy:      db.CSRPolicy{MinRSAKeySize: 2048},
+			csr:         generateCSR(t, rsa1024Key, subject),
+			expectedErr: "rsa key size 1024 is smaller than the minimum of 2048",
+		},
+		{
+			name:   "rsa key large enough",
+			policy: db.CSRPolicy{MinRSAKeySize: 2048},
+			csr:    generateCSR(t, rsa2048Key, subject),
+		},
+		{
+			name:   "allowed curve",
+			policy: db.CSRPolicy{AllowedCurves: []string{"P-256"}},
+			csr:    generateCSR(t, p256Key, subject),
+		},
+		{
+			name:        "forbidden curve",
+			policy:      db.CSRPolicy{AllowedCurves: []string{"P-256"}},
+			csr:         generateCSR(t, p384Key, subject),
+			expectedErr: "curve P-384 is not allowed, allowed curves are P-256",
+		},
+		{
+			name:        "missing subject field",
+			policy:      db.CSRPolicy{RequiredSubjectFields: []string{db.SubjectCommonName, db.SubjectCountry}},
+			csr:         generateCSR(t, p256Key, subject),
+			expectedErr: "subject field country is required",
+		},
+		{
+			name:        "too many SANs",
+			policy:      db.CSRPolicy{MaxSANs: 1},
+			csr:         generateCSR(t, p256Key, subject, "a.example.com", "b.example.com"),
+			expectedErr: "request has 2 SANs, the maximum allowed is 1",
+		},
+		{
+			name:        "wildcards forbidden",
+			policy:      db.CSRPolicy{ForbidWildcards: true},
+			csr:         generateCSR(t, p256Key, subject, "*.example.com"),
+			expectedErr: "wildcard SAN *.example.com is not allowed",
+		},
+		{
+			name:        "malformed wildcard",
+			policy:      db.CSRPolicy{},
+			csr:         generateCSR(t, p256Key, subject, "a.*.example.com"),
+			expectedErr: "wildcard SAN a.*.example.com is malformed",
+		},
+		{
+			name:        "SAN outside allowed patterns",
+			policy:      db.CSRPolicy{AllowedSANPatterns: []string{"*.example.com"}},
+			csr:         generateCSR(t, p256Key, subject, "a.example.com", "a.example.org"),
+			expectedErr: "SAN a.example.org does not match any allowed pattern",
+		},
+		{
+			name:        "SAN matches forbidden pattern",
+			policy:      db.CSRPolicy{AllowedSANPatterns: []string{"*.example.com"}, ForbiddenSANPatterns: []string{"admin.*.com"}},
+			csr:         generateCSR(t, p256Key, subject, "admin.example.com"),
+			expectedErr: "SAN admin.example.com is forbidden by pattern admin.*.com",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.policy.Check(parseCSR(t, c.csr))
+			if c.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("expected csr to be accepted, got: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error %q, got nil", c.expectedErr)
+			}
+			if !strings.HasPrefix(err.Error(), c.expectedErr) {
+				t.Fatalf("expected error %q, got %q", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestCSRPolicySANPatterns(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	request := func(template x509.CertificateRequest) *x509.CertificateRequest {
+		csrBytes, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+		if err != nil {
+			t.Fatalf("couldn't create csr: %s", err)
+		}
+		csr, err := x509.ParseCertificateRequest(csrBytes)
+		if err != nil {
+			t.Fatalf("couldn't parse csr: %s", err)
+		}
+		return csr
+	}
+	spiffeURI, _ := url.Parse("spiffe://example.org/ns/prod/sa/admin")
+
+	cases := []struct {
+		name      string
+		policy    db.CSRPolicy
+		csr       x509.CertificateRequest
+		forbidden bool
+	}{
+		{"upper case DNS name", db.CSRPolicy{ForbiddenSANPatterns: []string{"*.internal"}}, x509.CertificateRequest{DNSNames: []string{"FOO.INTERNAL"}}, true},
+		{"DNS name with a trailing dot", db.CSRPolicy{ForbiddenSANPatterns: []string{"*.internal"}}, x509.CertificateRequest{DNSNames: []string{"foo.internal."}}, true},
+		{"upper case pattern", db.CSRPolicy{AllowedSANPatterns: []string{"*.EXAMPLE.COM"}}, x509.CertificateRequest{DNSNames: []string{"a.example.com"}}, false},
+		{"wildcard covering two labels", db.CSRPolicy{AllowedSANPatterns: []string{"*.example.com"}}, x509.CertificateRequest{DNSNames: []string{"a.b.example.com"}}, true},
+		{"wildcard covering no label", db.CSRPolicy{AllowedSANPatterns: []string{"*.example.com"}}, x509.CertificateRequest{DNSNames: []string{"example.com"}}, true},
+		{"URI path", db.CSRPolicy{ForbiddenSANPatterns: []string{"spiffe://example.org/*"}}, x509.CertificateRequest{URIs: []*url.URL{spiffeURI}}, true},
+		{"upper case email address", db.CSRPolicy{ForbiddenSANPatterns: []string{"admin@*"}}, x509.CertificateRequest{EmailAddresses: []string{"ADMIN@example.com"}}, true},
+		{"IP address in a forbidden range", db.CSRPolicy{ForbiddenSANPatterns: []string{"10.0.0.0/8"}}, x509.CertificateRequest{IPAddresses: []net.IP{net.ParseIP("10.1.2.3")}}, true},
+		{"IP address outside a forbidden range", db.CSRPolicy{ForbiddenSANPatterns: []string{"10.0.0.0/8"}}, x509.CertificateRequest{IPAddresses: []net.IP{net.ParseIP("192.168.1.1")}}, false},
+		{"IP address not matched by DNS patterns", db.CSRPolicy{AllowedSANPatterns: []string{"*.example.com"}}, x509.CertificateRequest{IPAddresses: []net.IP{net.ParseIP("192.168.1.1")}}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.policy.Check(request(c.csr))
+			if c.forbidden && err == nil {
+				t.Fatalf("expected the SAN to be refused")
+			}
+			if !c.forbidden && err != nil {
+				t.Fatalf("expected the SAN to be accepted, got: %s", err)
+			}
+		})
+	}
+}
+
+func TestCSRPolicyValidate(t *testing.T) {
+	cases := []struct {
+		policy      db.CSRPolicy
+		expectedErr string
+	}{
+		{db.CSRPolicy{MinRSAKeySize: -1}, "minimum rsa key size can't be negative"},
+		{db.CSRPolicy{MaxSANs: -1}, "maximum number of SANs can't be negative"},
+		{db.CSRPolicy{AllowedCurves: []string{"secp256k1"}}, `unknown curve "secp256k1"`},
+		{db.CSRPolicy{RequiredSubjectFields: []string{"email"}}, `unknown subject field "email"`},
+		{db.CSRPolicy{AllowedSANPatterns: []string{"[a-"}}, `invalid SAN pattern "[a-"`},
+	}
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("InvalidPolicy%d", i), func(t *testing.T) {
+			err := c.policy.Validate()
+			if err == nil {
+				t.Fatalf("expected error %q, got nil", c.expectedErr)
+			}
+			if !strings.HasPrefix(err.Error(), c.expectedErr) {
+				t.Fatalf("expected error %q, got %q", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestCreateCSREnforcesPolicy(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+
+	err = database.SetCSRPolicy(db.CSRPolicy{RequiredSubjectFields: []string{db.SubjectCountry}})
+	if err != nil {
+		t.Fatalf("Couldn't set csr policy: %s", err)
+	}
+	if _, err := database.CreateCSR(AppleCSR); err != nil {
+		t.Fatalf("Expected CSR with a country to be accepted: %s", err)
+	}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, err = database.CreateCSR(generateCSR(t, key, pkix.Name{CommonName: "example.com"}))
+	if err == nil {
+		t.Fatalf("Expected CSR without a country to be rejected")
+	}
+	if err.Error() != "csr validation failed: subject field country is required" {
+		t.Fatalf("Unexpected rejection message: %s", err)
+	}
+}
+
+func TestCreateCSRRejectsBadSignature(t *testing.T) {
+	database, _ := db.NewDatabase(":memory:")
+	defer database.Close()
+
+	block, _ := pem.Decode([]byte(AppleCSR))
+	block.Bytes[len(block.Bytes)-1] ^= 0xff
+	tamperedCSR := string(pem.EncodeToMemory(block))
+	_, err := database.CreateCSR(tamperedCSR)
+	if err == nil {
+		t.Fatalf("Expected CSR with an invalid signature to be rejected")
+	}
+	if !strings.Contains(err.Error(), "invalid certificate request signature") {
+		t.Fatalf("Unexpected rejection message: %s", err)
+	}
+}
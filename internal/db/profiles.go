@@ -0,0 +1,357 @@
+package db
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const profilesTableName = "certificate_profiles"
+
+const queryCreateProfilesTable = `CREATE TABLE IF NOT EXISTS %s (
+	profile_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	validity_days INTEGER NOT NULL,
+	key_usage TEXT NOT NULL,
+	ext_key_usage TEXT NOT NULL,
+	is_ca INTEGER NOT NULL,
+	max_path_len INTEGER NOT NULL,
+	certificate_policies TEXT NOT NULL,
+	crl_distribution_points TEXT NOT NULL,
+	ocsp_servers TEXT NOT NULL,
+	issuing_certificate_urls TEXT NOT NULL
+)`
+
+const profileColumns = "profile_id, name, validity_days, key_usage, ext_key_usage, is_ca, max_path_len, certificate_policies, crl_distribution_points, ocsp_servers, issuing_certificate_urls"
+
+const (
+	queryGetAllProfiles       = "SELECT " + profileColumns + " FROM %s"
+	queryGetProfile           = "SELECT " + profileColumns + " FROM %s WHERE profile_id=?"
+	queryCreateProfile        = "INSERT INTO %s (name, validity_days, key_usage, ext_key_usage, is_ca, max_path_len, certificate_policies, crl_distribution_points, ocsp_servers, issuing_certificate_urls) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	queryUpdateProfile        = "UPDATE %s SET name=?, validity_days=?, key_usage=?, ext_key_usage=?, is_ca=?, max_path_len=?, certificate_policies=?, crl_distribution_points=?, ocsp_servers=?, issuing_certificate_urls=? WHERE profile_id=?"
+	queryDeleteProfile        = "DELETE FROM %s WHERE profile_id=?"
+	queryCountCSRsWithProfile = "SELECT COUNT(*) FROM %s WHERE profile_id=?"
+)
+
+// KeyUsages and ExtKeyUsages map the key usages and extended key usages that can be set in a CertificateProfile
+// to the bits and values they set in the certificates signed with it.
+var (
+	KeyUsages = map[string]x509.KeyUsage{
+		"digital_signature":  x509.KeyUsageDigitalSignature,
+		"content_commitment": x509.KeyUsageContentCommitment,
+		"key_encipherment":   x509.KeyUsageKeyEncipherment,
+		"data_encipherment":  x509.KeyUsageDataEncipherment,
+		"key_agreement":      x509.KeyUsageKeyAgreement,
+		"cert_sign":          x509.KeyUsageCertSign,
+		"crl_sign":           x509.KeyUsageCRLSign,
+		"encipher_only":      x509.KeyUsageEncipherOnly,
+		"decipher_only":      x509.KeyUsageDecipherOnly,
+	}
+	ExtKeyUsages = map[string]x509.ExtKeyUsage{
+		"any":              x509.ExtKeyUsageAny,
+		"server_auth":      x509.ExtKeyUsageServerAuth,
+		"client_auth":      x509.ExtKeyUsageClientAuth,
+		"code_signing":     x509.ExtKeyUsageCodeSigning,
+		"email_protection": x509.ExtKeyUsageEmailProtection,
+		"time_stamping":    x509.ExtKeyUsageTimeStamping,
+		"ocsp_signing":     x509.ExtKeyUsageOCSPSigning,
+	}
+)
+
+// A CertificateProfile describes the contents of the certificates Notary signs with it.
+// Certificate policies are given as dotted OIDs, and the URL lists are copied as-is into the
+// CRL distribution points and authority information access extensions.
+// MaxPathLen only applies to CA profiles, and a negative value means the path length is unconstrained.
+type CertificateProfile struct {
+	ID                     int
+	Name                   string
+	ValidityDays           int
+	KeyUsage               []string
+	ExtKeyUsage            []string
+	IsCA                   bool
+	MaxPathLen             int
+	CertificatePolicies    []string
+	CRLDistributionPoints  []string
+	OCSPServers            []string
+	IssuingCertificateURLs []string
+}
+
+var ErrProfileInUse = errors.New("profile is in use by certificate requests")
+
+// DefaultCertificateProfiles returns the profiles every new database is seeded with.
+func DefaultCertificateProfiles() []CertificateProfile {
+	return []CertificateProfile{
+		{
+			Name:         "tls_server",
+			ValidityDays: 365,
+			KeyUsage:     []string{"digital_signature", "key_encipherment"},
+			ExtKeyUsage:  []string{"server_auth"},
+		},
+		{
+			Name:         "tls_client",
+			ValidityDays: 365,
+			KeyUsage:     []string{"digital_signature"},
+			ExtKeyUsage:  []string{"client_auth"},
+		},
+		{
+			Name:         "mtls",
+			ValidityDays: 365,
+			KeyUsage:     []string{"digital_signature", "key_encipherment"},
+			ExtKeyUsage:  []string{"server_auth", "client_auth"},
+		},
+		{
+			Name:         "code_signing",
+			ValidityDays: 365,
+			KeyUsage:     []string{"digital_signature"},
+			ExtKeyUsage:  []string{"code_signing"},
+		},
+		{
+			Name:         "smime",
+			ValidityDays: 365,
+			KeyUsage:     []string{"digital_signature", "key_encipherment"},
+			ExtKeyUsage:  []string{"email_protection"},
+		},
+	}
+}
+
+// Validate makes sure the profile can be used to sign certificates.
+// It does not judge whether the profile is allowed to issue CA certificates, which is up to the caller.
+// The returned error is a *FieldError naming the first invalid field.
+func (p *CertificateProfile) Validate() error {
+	if p.Name == "" {
+		return &FieldError{Field: "name", Message: "profile name is required"}
+	}
+	if p.ValidityDays <= 0 {
+		return &FieldError{Field: "validity_days", Message: "validity must be at least 1 day"}
+	}
+	for _, usage := range p.KeyUsage {
+		if _, ok := KeyUsages[usage]; !ok {
+			return &FieldError{Field: "key_usage", Message: fmt.Sprintf("unknown key usage %q", usage)}
+		}
+	}
+	for _, usage := range p.ExtKeyUsage {
+		if _, ok := ExtKeyUsages[usage]; !ok {
+			return &FieldError{Field: "ext_key_usage", Message: fmt.Sprintf("unknown extended key usage %q", usage)}
+		}
+	}
+	if !p.IsCA && slices.Contains(p.KeyUsage, "cert_sign") {
+		return &FieldError{Field: "key_usage", Message: "key usage cert_sign requires a CA profile"}
+	}
+	for _, policy := range p.CertificatePolicies {
+		if _, err := ParseOID(policy); err != nil {
+			return &FieldError{Field: "certificate_policies", Message: fmt.Sprintf("invalid certificate policy %q: %s", policy, err)}
+		}
+	}
+	urls := []struct {
+		field string
+		urls  []string
+	}{
+		{"crl_distribution_points", p.CRLDistributionPoints},
+		{"ocsp_servers", p.OCSPServers},
+		{"issuing_certificate_urls", p.IssuingCertificateURLs},
+	}
+	for _, list := range urls {
+		for _, rawURL := range list.urls {
+			u, err := url.Parse(rawURL)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return &FieldError{Field: list.field, Message: fmt.Sprintf("invalid url %q", rawURL)}
+			}
+		}
+	}
+	return nil
+}
+
+// ParseOID parses a dotted object identifier such as 2.23.140.1.2.1.
+func ParseOID(oid string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(oid, ".")
+	if len(parts) < 2 {
+		return nil, errors.New("an OID needs at least two components")
+	}
+	parsed := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		var component int
+		if _, err := fmt.Sscanf(part, "%d", &component); err != nil || component < 0 || fmt.Sprint(component) != part {
+			return nil, fmt.Errorf("invalid OID component %q", part)
+		}
+		parsed[i] = component
+	}
+	return parsed, nil
+}
+
+// RetrieveAllCertificateProfiles gets every certificate profile in the database.
+func (db *Database) RetrieveAllCertificateProfiles() ([]CertificateProfile, error) {
+	rows, err := db.querier().Query(fmt.Sprintf(queryGetAllProfiles, db.profilesTable))
+	if err != nil {
+		return nil, err
+	}
+
+	var allProfiles []CertificateProfile
+	defer rows.Close()
+	for rows.Next() {
+		profile, err := scanCertificateProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		allProfiles = append(allProfiles, profile)
+	}
+	return allProfiles, nil
+}
+
+// RetrieveCertificateProfile gets the certificate profile with the given id.
+func (db *Database) RetrieveCertificateProfile(id string) (CertificateProfile, error) {
+	row := db.querier().QueryRow(fmt.Sprintf(queryGetProfile, db.profilesTable), id)
+	profile, err := scanCertificateProfile(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return profile, ErrIdNotFound
+		}
+		return profile, err
+	}
+	return profile, nil
+}
+
+// CreateCertificateProfile validates and stores a new certificate profile. The name of the profile must be unique,
+// or ErrAlreadyExists is returned.
+func (db *Database) CreateCertificateProfile(profile CertificateProfile) (int64, error) {
+	if err := profile.Validate(); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidProfile, err)
+	}
+	return insertCertificateProfile(db.querier(), db.profilesTable, profile)
+}
+
+// UpdateCertificateProfile replaces every field of the certificate profile with the given id.
+func (db *Database) UpdateCertificateProfile(id string, profile CertificateProfile) (int64, error) {
+	existing, err := db.RetrieveCertificateProfile(id)
+	if err != nil {
+		return 0, err
+	}
+	if err := profile.Validate(); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidProfile, err)
+	}
+	args, err := certificateProfileArgs(profile)
+	if err != nil {
+		return 0, err
+	}
+	args = append(args, existing.ID)
+	if _, err := db.querier().Exec(fmt.Sprintf(queryUpdateProfile, db.profilesTable), args...); err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrAlreadyExists
+		}
+		return 0, err
+	}
+	return int64(existing.ID), nil
+}
+
+// DeleteCertificateProfile removes a certificate profile. Profiles that are selected by a certificate request can't be removed.
+func (db *Database) DeleteCertificateProfile(id string) (int64, error) {
+	var usage int
+	row := db.querier().QueryRow(fmt.Sprintf(queryCountCSRsWithProfile, db.certificateTable), id)
+	if err := row.Scan(&usage); err != nil {
+		return 0, err
+	}
+	if usage > 0 {
+		return 0, ErrProfileInUse
+	}
+	result, err := db.querier().Exec(fmt.Sprintf(queryDeleteProfile, db.profilesTable), id)
+	if err != nil {
+		return 0, err
+	}
+	deleteId, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if deleteId == 0 {
+		return 0, ErrIdNotFound
+	}
+	return deleteId, nil
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func insertCertificateProfile(conn execer, table string, profile CertificateProfile) (int64, error) {
+	args, err := certificateProfileArgs(profile)
+	if err != nil {
+		return 0, err
+	}
+	result, err := conn.Exec(fmt.Sprintf(queryCreateProfile, table), args...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrAlreadyExists
+		}
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// certificateProfileArgs returns the column values of a profile in the order used by the insert and update queries.
+// List fields are stored as JSON arrays.
+func certificateProfileArgs(profile CertificateProfile) ([]any, error) {
+	args := []any{profile.Name, profile.ValidityDays}
+	lists := [][]string{profile.KeyUsage, profile.ExtKeyUsage}
+	for _, list := range lists {
+		encoded, err := encodeList(list)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, encoded)
+	}
+	args = append(args, profile.IsCA, profile.MaxPathLen)
+	lists = [][]string{profile.CertificatePolicies, profile.CRLDistributionPoints, profile.OCSPServers, profile.IssuingCertificateURLs}
+	for _, list := range lists {
+		encoded, err := encodeList(list)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, encoded)
+	}
+	return args, nil
+}
+
+func scanCertificateProfile(row scanner) (CertificateProfile, error) {
+	var profile CertificateProfile
+	var keyUsage, extKeyUsage, policies, crlDistributionPoints, ocspServers, issuingCertificateURLs string
+	err := row.Scan(
+		&profile.ID, &profile.Name, &profile.ValidityDays, &keyUsage, &extKeyUsage, &profile.IsCA,
+		&profile.MaxPathLen, &policies, &crlDistributionPoints, &ocspServers, &issuingCertificateURLs,
+	)
+	if err != nil {
+		return profile, err
+	}
+	lists := map[*[]string]string{
+		&profile.KeyUsage:               keyUsage,
+		&profile.ExtKeyUsage:            extKeyUsage,
+		&profile.CertificatePolicies:    policies,
+		&profile.CRLDistributionPoints:  crlDistributionPoints,
+		&profile.OCSPServers:            ocspServers,
+		&profile.IssuingCertificateURLs: issuingCertificateURLs,
+	}
+	for field, encoded := range lists {
+		if err := json.Unmarshal([]byte(encoded), field); err != nil {
+			return profile, fmt.Errorf("couldn't decode profile %d: %w", profile.ID, err)
+		}
+	}
+	return profile, nil
+}
+
+func encodeList(list []string) (string, error) {
+	if list == nil {
+		list = []string{}
+	}
+	encoded, err := json.Marshal(list)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,148 @@
+package db_test
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+func TestCertificateProfilesEndToEnd(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+
+	profiles, err := database.RetrieveAllCertificateProfiles()
+	if err != nil {
+		t.Fatalf("Couldn't complete RetrieveAll: %s", err)
+	}
+	if len(profiles) != len(db.DefaultCertificateProfiles()) {
+		t.Fatalf("Expected the default profiles to be seeded, got %d profiles", len(profiles))
+	}
+
+	profile := db.CertificateProfile{
+		Name:                  "internal_web",
+		ValidityDays:          90,
+		KeyUsage:              []string{"digital_signature"},
+		ExtKeyUsage:           []string{"server_auth"},
+		CertificatePolicies:   []string{"2.23.140.1.2.1"},
+		CRLDistributionPoints: []string{"http://ca.example.com/crl"},
+	}
+	id, err := database.CreateCertificateProfile(profile)
+	if err != nil {
+		t.Fatalf("Couldn't complete Create: %s", err)
+	}
+	if _, err := database.CreateCertificateProfile(profile); err == nil {
+		t.Fatalf("Expected error due to duplicate profile name")
+	}
+	retrieved, err := database.RetrieveCertificateProfile(strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatalf("Couldn't complete Retrieve: %s", err)
+	}
+	if retrieved.Name != profile.Name || retrieved.ValidityDays != 90 || retrieved.CRLDistributionPoints[0] != "http://ca.example.com/crl" {
+		t.Fatalf("The retrieved profile doesn't match the profile that was given: %+v", retrieved)
+	}
+
+	profile.ValidityDays = 30
+	if _, err := database.UpdateCertificateProfile(strconv.FormatInt(id, 10), profile); err != nil {
+		t.Fatalf("Couldn't complete Update: %s", err)
+	}
+	retrieved, _ = database.RetrieveCertificateProfile(strconv.FormatInt(id, 10))
+	if retrieved.ValidityDays != 30 {
+		t.Fatalf("The profile wasn't updated")
+	}
+
+	csrID, err := database.CreateCSRWithProfile(AppleCSR, int(id))
+	if err != nil {
+		t.Fatalf("Couldn't create CSR with profile: %s", err)
+	}
+	csr, _ := database.RetrieveCSR(strconv.FormatInt(csrID, 10))
+	if csr.ProfileID != int(id) {
+		t.Fatalf("Expected CSR to reference profile %d, got %d", id, csr.ProfileID)
+	}
+	if _, err := database.DeleteCertificateProfile(strconv.FormatInt(id, 10)); !errors.Is(err, db.ErrProfileInUse) {
+		t.Fatalf("Expected deleting a profile in use to fail, got: %v", err)
+	}
+	if _, err := database.DeleteCSR(strconv.FormatInt(csrID, 10)); err != nil {
+		t.Fatalf("Couldn't delete CSR: %s", err)
+	}
+	if _, err := database.DeleteCertificateProfile(strconv.FormatInt(id, 10)); err != nil {
+		t.Fatalf("Couldn't complete Delete: %s", err)
+	}
+	if _, err := database.RetrieveCertificateProfile(strconv.FormatInt(id, 10)); !errors.Is(err, db.ErrIdNotFound) {
+		t.Fatalf("Expected profile to be deleted, got: %v", err)
+	}
+	if _, err := database.CreateCSRWithProfile(BananaCSR, 1000); !errors.Is(err, db.ErrProfileNotFound) {
+		t.Fatalf("Expected creating a CSR with an unknown profile to fail, got: %v", err)
+	}
+}
+
+func TestCertificateProfileValidationFails(t *testing.T) {
+	cases := []struct {
+		profile       db.CertificateProfile
+		expectedField string
+		expectedErr   string
+	}{
+		{db.CertificateProfile{ValidityDays: 1}, "name", "profile name is required"},
+		{db.CertificateProfile{Name: "p"}, "validity_days", "validity must be at least 1 day"},
+		{db.CertificateProfile{Name: "p", ValidityDays: 1, KeyUsage: []string{"sign_everything"}}, "key_usage", `unknown key usage "sign_everything"`},
+		{db.CertificateProfile{Name: "p", ValidityDays: 1, ExtKeyUsage: []string{"web"}}, "ext_key_usage", `unknown extended key usage "web"`},
+		{db.CertificateProfile{Name: "p", ValidityDays: 1, KeyUsage: []string{"cert_sign"}}, "key_usage", "key usage cert_sign requires a CA profile"},
+		{db.CertificateProfile{Name: "p", ValidityDays: 1, CertificatePolicies: []string{"2.x.1"}}, "certificate_policies", `invalid certificate policy "2.x.1"`},
+		{db.CertificateProfile{Name: "p", ValidityDays: 1, OCSPServers: []string{"ocsp.example.com"}}, "ocsp_servers", `invalid url "ocsp.example.com"`},
+	}
+	for _, c := range cases {
+		t.Run(c.expectedErr, func(t *testing.T) {
+			err := c.profile.Validate()
+			if err == nil {
+				t.Fatalf("Expected error %q, got nil", c.expectedErr)
+			}
+			if !strings.HasPrefix(err.Error(), c.expectedErr) {
+				t.Fatalf("Expected error %q, got %q", c.expectedErr, err)
+			}
+			var fieldErr *db.FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != c.expectedField {
+				t.Fatalf("Expected the error to be about field %s, got %v", c.expectedField, fieldErr)
+			}
+		})
+	}
+}
+
+func TestMigrateExistingDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "db.sqlite3")
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Couldn't open database: %s", err)
+	}
+	_, err = conn.Exec(`CREATE TABLE CertificateRequests (csr TEXT PRIMARY KEY UNIQUE NOT NULL, certificate TEXT DEFAULT '')`)
+	if err != nil {
+		t.Fatalf("Couldn't create legacy table: %s", err)
+	}
+	if _, err := conn.Exec("INSERT INTO CertificateRequests (csr) VALUES (?)", AppleCSR); err != nil {
+		t.Fatalf("Couldn't insert legacy CSR: %s", err)
+	}
+	conn.Close()
+
+	database, err := db.NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Couldn't migrate database: %s", err)
+	}
+	defer database.Close()
+	csrs, err := database.RetrieveAllCSRs()
+	if err != nil {
+		t.Fatalf("Couldn't retrieve CSRs after migration: %s", err)
+	}
+	if len(csrs) != 1 || csrs[0].CSR != AppleCSR || csrs[0].ProfileID != 0 {
+		t.Fatalf("Existing CSRs weren't preserved by the migration: %+v", csrs)
+	}
+	profiles, _ := database.RetrieveAllCertificateProfiles()
+	if len(profiles) != len(db.DefaultCertificateProfiles()) {
+		t.Fatalf("Expected the default profiles to be seeded by the migration")
+	}
+}
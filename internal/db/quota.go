@@ -0,0 +1,16 @@
+package db
+
+// ForAccount returns a copy of the database bound to the account with the given ID, so that the certificate
+// requests created with it are recorded as submitted by the account and count against its quota.
+func (db *Database) ForAccount(id int) *Database {
+	accountDB := *db
+	accountDB.account = id
+	return &accountDB
+}
+
+// SetPendingRequestQuota sets the number of outstanding certificate requests an account can have submitted.
+// Requests created without an account, and those submitted before the account was recorded, don't count.
+// A quota of 0 means there is none.
+func (db *Database) SetPendingRequestQuota(quota int) {
+	db.pendingQuota.Store(int64(quota))
+}
@@ -0,0 +1,62 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+func TestPendingRequestQuota(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+	if err := database.SetCSRPolicy(db.CSRPolicy{AllowKeyReuse: true}); err != nil {
+		t.Fatalf("Couldn't set CSR policy: %s", err)
+	}
+	database.SetPendingRequestQuota(1)
+	alice, bob := database.ForAccount(1), database.ForAccount(2)
+
+	appleID, err := alice.CreateCSR(AppleCSR)
+	if err != nil {
+		t.Fatalf("Couldn't create CSR: %s", err)
+	}
+	if _, err := alice.CreateCSR(BananaCSR); !errors.Is(err, db.ErrQuotaExceeded) {
+		t.Fatalf("Expected the quota of the account to be exceeded, got %v", err)
+	}
+	bananaID, err := bob.CreateCSR(BananaCSR)
+	if err != nil {
+		t.Fatalf("Expected the quota to be counted per account, got %s", err)
+	}
+
+	if _, err := database.UpdateCSR(fmt.Sprint(appleID), "rejected"); err != nil {
+		t.Fatalf("Couldn't reject CSR: %s", err)
+	}
+	if _, err := alice.CreateCSR(StrawberryCSR); err != nil {
+		t.Fatalf("Expected rejected requests not to count against the quota, got %s", err)
+	}
+
+	if _, err := bob.UpdateCSR(fmt.Sprint(bananaID), BananaCert+"\n"+IssuerCert); err != nil {
+		t.Fatalf("Couldn't issue certificate: %s", err)
+	}
+	if _, err := bob.RenewCSR(fmt.Sprint(bananaID), ""); err != nil {
+		t.Fatalf("Expected issued requests not to count against the quota, got %s", err)
+	}
+	if _, err := bob.CreateCSR(StrawberryCSR); !errors.Is(err, db.ErrQuotaExceeded) {
+		t.Fatalf("Expected the renewal to count against the quota, got %v", err)
+	}
+
+	if _, err := database.DeleteCSR(fmt.Sprint(appleID)); err != nil {
+		t.Fatalf("Couldn't delete CSR: %s", err)
+	}
+	if _, err := alice.CreateCSR(AppleCSR); !errors.Is(err, db.ErrQuotaExceeded) {
+		t.Fatalf("Expected the quota of the account to be exceeded, got %v", err)
+	}
+	database.SetPendingRequestQuota(0)
+	if _, err := alice.CreateCSR(AppleCSR); err != nil {
+		t.Fatalf("Expected a quota of 0 not to limit requests, got %s", err)
+	}
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+// Statuses of certificate requests, stored alongside them so that they can be counted without reading their PEM data.
+const (
+	statusOutstanding = "outstanding"
+	statusIssued      = "issued"
+	statusRejected    = "rejected"
+	statusImported    = "imported"
+)
+
+const (
+	queryCountCSRsByStatus = "SELECT status, COUNT(*) FROM %s GROUP BY status"
+	// The expiry of issued certificates is counted from the status index, which orders them by expiry,
+	// so that only the certificates expiring in the next 90 days or already expired are read.
+	queryCountCertificatesByExpiry = `SELECT
+	COALESCE(SUM(not_after < ?1), 0),
+	COALESCE(SUM(not_after >= ?1 AND not_after < ?2), 0),
+	COALESCE(SUM(not_after >= ?1 AND not_after < ?3), 0),
+	COALESCE(SUM(not_after >= ?1 AND not_after < ?4), 0),
+	COALESCE(SUM(not_after >= ?1 AND not_after < ?5), 0)
+	FROM %s WHERE status IN ('issued', 'imported') AND not_after < ?5`
+	// Issued and imported certificates are each read in order of expiry from the status index, so that only
+	// the certificates expiring first are read. Certificates renewed by an issued certificate are left out.
+	queryGetExpiringCertificates = `SELECT id, certificate, fingerprint FROM (
+		SELECT * FROM (SELECT id, certificate, fingerprint, not_after FROM %[1]s c WHERE status = 'issued'
+			AND NOT EXISTS (SELECT 1 FROM %[1]s s WHERE s.predecessor_id = c.id AND s.predecessor_id != 0 AND s.status = 'issued')
+			ORDER BY not_after LIMIT ?1)
+		UNION ALL
+		SELECT * FROM (SELECT id, certificate, fingerprint, not_after FROM %[1]s c WHERE status = 'imported'
+			AND NOT EXISTS (SELECT 1 FROM %[1]s s WHERE s.predecessor_id = c.id AND s.predecessor_id != 0 AND s.status = 'issued')
+			ORDER BY not_after LIMIT ?1)
+	) ORDER BY not_after LIMIT ?1`
+)
+
+// CertificateCounts holds the number of certificate requests and certificates in the database.
+// Imported certificates count as certificates but not as certificate requests.
+type CertificateCounts struct {
+	CertificateRequests            int
+	OutstandingCertificateRequests int
+	Certificates                   int
+}
+
+// ExpiryCounts holds the number of certificates that are expired, and that expire within each period.
+// A certificate expiring within a day also counts as expiring within 7, 30 and 90 days, and expired
+// certificates only count as expired.
+type ExpiryCounts struct {
+	Expired      int
+	Within1Day   int
+	Within7Days  int
+	Within30Days int
+	Within90Days int
+}
+
+// CountCertificates returns the number of certificate requests and certificates in the database.
+func (db *Database) CountCertificates() (CertificateCounts, error) {
+	var counts CertificateCounts
+	rows, err := db.querier().Query(fmt.Sprintf(queryCountCSRsByStatus, db.certificateTable))
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return counts, err
+		}
+		switch status {
+		case statusOutstanding:
+			counts.CertificateRequests += count
+			counts.OutstandingCertificateRequests += count
+		case statusRejected:
+			counts.CertificateRequests += count
+		case statusIssued:
+			counts.CertificateRequests += count
+			counts.Certificates += count
+		case statusImported:
+			counts.Certificates += count
+		}
+	}
+	return counts, rows.Err()
+}
+
+// CountCertificatesByExpiry returns the number of certificates that are expired at the given time, and that expire
+// within each period after it.
+func (db *Database) CountCertificatesByExpiry(now time.Time) (ExpiryCounts, error) {
+	var counts ExpiryCounts
+	day := 24 * time.Hour
+	row := db.querier().QueryRow(fmt.Sprintf(queryCountCertificatesByExpiry, db.certificateTable),
+		now.Unix(), now.Add(day).Unix(), now.Add(7*day).Unix(), now.Add(30*day).Unix(), now.Add(90*day).Unix())
+	err := row.Scan(&counts.Expired, &counts.Within1Day, &counts.Within7Days, &counts.Within30Days, &counts.Within90Days)
+	return counts, err
+}
+
+// RetrieveExpiringCertificates returns the entries of at most limit certificates, those expiring first, including
+// the ones that already expired. Certificates that were renewed by an issued certificate are left out, as they
+// are replaced by their renewal. Only the ID, the certificate and the fingerprint of the entries are set.
+func (db *Database) RetrieveExpiringCertificates(limit int) ([]CertificateRequest, error) {
+	rows, err := db.querier().Query(fmt.Sprintf(queryGetExpiringCertificates, db.certificateTable), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var certificates []CertificateRequest
+	for rows.Next() {
+		var csr CertificateRequest
+		if err := rows.Scan(&csr.ID, &csr.Certificate, &csr.Fingerprint); err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, csr)
+	}
+	return certificates, rows.Err()
+}
+
+// certificateStatus returns the status of a request holding the given certificate, which is empty while
+// the request is outstanding and "rejected" once it was rejected.
+func certificateStatus(cert string) string {
+	switch cert {
+	case "":
+		return statusOutstanding
+	case "rejected":
+		return statusRejected
+	}
+	return statusIssued
+}
+
+// certificateNotAfter returns the expiry, in seconds since the epoch, of the first certificate of a bundle,
+// or NULL when there is none.
+func certificateNotAfter(bundle string) sql.NullInt64 {
+	block, _ := pem.Decode([]byte(bundle))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return sql.NullInt64{}
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: cert.NotAfter.Unix(), Valid: true}
+}
+
+// unixTime returns the time of the given seconds since the epoch, or the zero time when they are 0.
+func unixTime(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
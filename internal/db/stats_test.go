@@ -0,0 +1,250 @@
+package db_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+// BananaCert and StrawberryCert both expire on 2025-06-28 at 08:42 UTC.
+var testCertsExpiry = time.Date(2025, 6, 28, 8, 42, 0, 0, time.UTC)
+
+func TestCountCertificates(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+
+	if _, err := database.CreateCSR(AppleCSR); err != nil {
+		t.Fatalf("Couldn't create CSR: %s", err)
+	}
+	bananaID, _ := database.CreateCSR(BananaCSR)
+	if _, err := database.UpdateCSR(fmt.Sprint(bananaID), BananaCert+"\n"+IssuerCert); err != nil {
+		t.Fatalf("Couldn't issue certificate: %s", err)
+	}
+	strawberryID, _ := database.CreateCSR(StrawberryCSR)
+	if _, err := database.UpdateCSR(fmt.Sprint(strawberryID), "rejected"); err != nil {
+		t.Fatalf("Couldn't reject CSR: %s", err)
+	}
+	if _, _, err := database.ImportCertificate(StrawberryCert + "\n" + IssuerCert); err != nil {
+		t.Fatalf("Couldn't import certificate: %s", err)
+	}
+
+	counts, err := database.CountCertificates()
+	if err != nil {
+		t.Fatalf("Couldn't count certificates: %s", err)
+	}
+	if counts != (db.CertificateCounts{CertificateRequests: 3, OutstandingCertificateRequests: 1, Certificates: 2}) {
+		t.Fatalf("Unexpected counts: %+v", counts)
+	}
+
+	cases := []struct {
+		now      time.Time
+		expected db.ExpiryCounts
+	}{
+		{testCertsExpiry.Add(-12 * time.Hour), db.ExpiryCounts{Within1Day: 2, Within7Days: 2, Within30Days: 2, Within90Days: 2}},
+		{testCertsExpiry.Add(-10 * 24 * time.Hour), db.ExpiryCounts{Within30Days: 2, Within90Days: 2}},
+		{testCertsExpiry.Add(-100 * 24 * time.Hour), db.ExpiryCounts{}},
+		{testCertsExpiry.Add(time.Hour), db.ExpiryCounts{Expired: 2}},
+	}
+	for _, c := range cases {
+		expiry, err := database.CountCertificatesByExpiry(c.now)
+		if err != nil {
+			t.Fatalf("Couldn't count certificates by expiry: %s", err)
+		}
+		if expiry != c.expected {
+			t.Fatalf("Unexpected counts at %s: expected %+v, got %+v", c.now, c.expected, expiry)
+		}
+	}
+
+	if _, err := database.UpdateCSR(fmt.Sprint(bananaID), ""); err != nil {
+		t.Fatalf("Couldn't delete certificate: %s", err)
+	}
+	counts, _ = database.CountCertificates()
+	expiry, _ := database.CountCertificatesByExpiry(testCertsExpiry.Add(time.Hour))
+	if counts.OutstandingCertificateRequests != 2 || counts.Certificates != 1 || expiry.Expired != 1 {
+		t.Fatalf("Expected the deleted certificate not to be counted anymore, got %+v and %+v", counts, expiry)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+	changed := func() bool {
+		select {
+		case <-database.Changes():
+			return true
+		default:
+			return false
+		}
+	}
+
+	id, _ := database.CreateCSR(AppleCSR)
+	database.CreateCSR(BananaCSR) //nolint:errcheck
+	if !changed() || changed() {
+		t.Fatalf("Expected the creations to be signalled once")
+	}
+	if _, err := database.RetrieveAllCSRs(); err != nil || changed() {
+		t.Fatalf("Expected reads not to be signalled")
+	}
+	err = database.Transaction(func(tx *db.Database) error {
+		if _, err := tx.UpdateCSR(fmt.Sprint(id), "rejected"); err != nil {
+			return err
+		}
+		if changed() {
+			t.Fatalf("Expected the write to be signalled once the transaction is committed")
+		}
+		return nil
+	})
+	if err != nil || !changed() {
+		t.Fatalf("Expected the committed transaction to be signalled, got %v", err)
+	}
+	if _, err := database.DeleteCSR(fmt.Sprint(id)); err != nil || !changed() {
+		t.Fatalf("Expected the deletion to be signalled, got %v", err)
+	}
+}
+
+func TestMigrateCertificateStatus(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "db.sqlite3")
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Couldn't open database: %s", err)
+	}
+	_, err = conn.Exec(`CREATE TABLE CertificateRequests (csr TEXT PRIMARY KEY UNIQUE NOT NULL, certificate TEXT DEFAULT '')`)
+	if err != nil {
+		t.Fatalf("Couldn't create legacy table: %s", err)
+	}
+	for csr, cert := range map[string]string{AppleCSR: "", BananaCSR: BananaCert + "\n" + IssuerCert, StrawberryCSR: "rejected"} {
+		if _, err := conn.Exec("INSERT INTO CertificateRequests (csr, certificate) VALUES (?, ?)", csr, cert); err != nil {
+			t.Fatalf("Couldn't insert legacy CSR: %s", err)
+		}
+	}
+	conn.Close()
+
+	database, err := db.NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Couldn't migrate database: %s", err)
+	}
+	defer database.Close()
+	counts, err := database.CountCertificates()
+	if err != nil || counts != (db.CertificateCounts{CertificateRequests: 3, OutstandingCertificateRequests: 1, Certificates: 1}) {
+		t.Fatalf("Unexpected counts after migration: %+v, %v", counts, err)
+	}
+	expiry, err := database.CountCertificatesByExpiry(testCertsExpiry.Add(time.Hour))
+	if err != nil || expiry.Expired != 1 {
+		t.Fatalf("Expected the expiry of the existing certificate to be stored by the migration, got %+v, %v", expiry, err)
+	}
+}
+
+func TestRetrieveExpiringCertificates(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+	if err := database.SetCSRPolicy(db.CSRPolicy{AllowKeyReuse: true}); err != nil {
+		t.Fatalf("Couldn't set CSR policy: %s", err)
+	}
+
+	bananaID, _ := database.CreateCSR(BananaCSR)
+	if _, err := database.UpdateCSR(fmt.Sprint(bananaID), BananaCert+"\n"+IssuerCert); err != nil {
+		t.Fatalf("Couldn't issue certificate: %s", err)
+	}
+	strawberryID, _, _ := database.ImportCertificate(StrawberryCert + "\n" + IssuerCert)
+	issuerID, _, _ := database.ImportCertificate(IssuerCert)
+	database.CreateCSR(AppleCSR) //nolint:errcheck
+
+	ids := func(limit int) []int {
+		certificates, err := database.RetrieveExpiringCertificates(limit)
+		if err != nil {
+			t.Fatalf("Couldn't retrieve expiring certificates: %s", err)
+		}
+		var ids []int
+		for _, certificate := range certificates {
+			if certificate.Certificate == "" || certificate.Fingerprint == "" {
+				t.Fatalf("Expected the certificate and its fingerprint to be retrieved: %+v", certificate)
+			}
+			ids = append(ids, certificate.ID)
+		}
+		return ids
+	}
+	if got := ids(2); fmt.Sprint(got) != fmt.Sprint([]int64{bananaID, strawberryID}) {
+		t.Fatalf("Expected the certificates expiring first, got %v", got)
+	}
+	if got := ids(10); fmt.Sprint(got) != fmt.Sprint([]int64{bananaID, strawberryID, issuerID}) {
+		t.Fatalf("Expected every certificate in order of expiry, got %v", got)
+	}
+
+	renewalID, err := database.RenewCSR(fmt.Sprint(bananaID), "")
+	if err != nil {
+		t.Fatalf("Couldn't renew CSR: %s", err)
+	}
+	if got := ids(10); len(got) != 3 || got[0] != int(bananaID) {
+		t.Fatalf("Expected a pending renewal not to replace its predecessor, got %v", got)
+	}
+	if _, err := database.UpdateCSR(fmt.Sprint(renewalID), BananaCert+"\n"+IssuerCert); err != nil {
+		t.Fatalf("Couldn't issue renewal: %s", err)
+	}
+	if got := ids(10); len(got) != 3 || got[0] != int(renewalID) {
+		t.Fatalf("Expected the renewed certificate to be replaced by its renewal, got %v", got)
+	}
+}
+
+func TestCertificateEvents(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+	var events []db.CertificateEvent
+	database.OnCertificateEvent(func(event db.CertificateEvent) { events = append(events, event) })
+
+	before := time.Now().Add(-time.Second)
+	bananaID, _ := database.CreateCSR(BananaCSR)
+	strawberryID, _ := database.CreateCSR(StrawberryCSR)
+	database.UpdateCSR(fmt.Sprint(bananaID), "")                         //nolint:errcheck
+	database.UpdateCSR(fmt.Sprint(bananaID), BananaCert+"\n"+IssuerCert) //nolint:errcheck
+	database.UpdateCSR(fmt.Sprint(bananaID), "")                         //nolint:errcheck
+	err = database.Transaction(func(tx *db.Database) error {
+		if _, err := tx.UpdateCSR(fmt.Sprint(strawberryID), "rejected"); err != nil {
+			return err
+		}
+		if len(events) != 2 {
+			t.Fatalf("Expected the events of a transaction to be published once it is committed")
+		}
+		return tx.Transaction(func(nested *db.Database) error {
+			nested.UpdateCSR(fmt.Sprint(bananaID), BananaCert+"\n"+IssuerCert) //nolint:errcheck
+			return errors.New("rolled back")
+		})
+	})
+	if err == nil {
+		t.Fatalf("Expected the transaction to fail")
+	}
+	database.Transaction(func(tx *db.Database) error { //nolint:errcheck
+		tx.UpdateCSR(fmt.Sprint(strawberryID), "rejected") //nolint:errcheck
+		return nil
+	})
+
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		if event.SubmittedAt.Before(before) || event.Time.Before(event.SubmittedAt) {
+			t.Fatalf("Unexpected times of the event: %+v", event)
+		}
+	}
+	if fmt.Sprint(types) != fmt.Sprint([]string{db.EventIssued, db.EventRevoked, db.EventRejected}) {
+		t.Fatalf("Unexpected events: %v", types)
+	}
+	if events[0].RequestID != int(bananaID) || events[2].RequestID != int(strawberryID) {
+		t.Fatalf("Unexpected requests of the events: %+v", events)
+	}
+}
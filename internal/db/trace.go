@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/canonical/notary/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the tracer of the database spans.
+const tracerName = "github.com/canonical/notary/internal/db"
+
+// WithContext returns a copy of the database bound to the context, so that the queries performed on it are
+// traced as children of the span of the context, such as the span of the request they are performed for.
+func (db *Database) WithContext(ctx context.Context) *Database {
+	ctxDB := *db
+	ctxDB.ctx = ctx
+	return &ctxDB
+}
+
+func (db *Database) context() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
+	return db.ctx
+}
+
+// startSpan starts a span of the database as a child of the span of its context, and returns the context of the span.
+func (db *Database) startSpan(name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Tracer(tracerName).Start(db.context(), name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, semconv.DBSystemSqlite)...),
+	)
+}
+
+// tracedQuerier traces every query performed with the querier, in a span named after its operation.
+type tracedQuerier struct {
+	querier
+	db *Database
+}
+
+func (q tracedQuerier) start(query string) trace.Span {
+	operation, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	operation = strings.ToUpper(operation)
+	_, span := q.db.startSpan(operation, semconv.DBOperationName(operation), semconv.DBQueryText(query))
+	return span
+}
+
+func (q tracedQuerier) Exec(query string, args ...any) (sql.Result, error) {
+	span := q.start(query)
+	result, err := q.querier.Exec(query, args...)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (q tracedQuerier) Query(query string, args ...any) (*sql.Rows, error) {
+	span := q.start(query)
+	rows, err := q.querier.Query(query, args...)
+	tracing.End(span, err)
+	return rows, err
+}
+
+func (q tracedQuerier) QueryRow(query string, args ...any) *sql.Row {
+	span := q.start(query)
+	row := q.querier.QueryRow(query, args...)
+	err := row.Err()
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	tracing.End(span, err)
+	return row
+}
@@ -0,0 +1,87 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/canonical/notary/internal/db"
+	"github.com/canonical/notary/internal/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordSpans records the spans ended during the test in memory.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracing.Install(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background()) //nolint:errcheck
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+	return exporter
+}
+
+func TestTracing(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+	exporter := recordSpans(t)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	err = database.WithContext(ctx).Transaction(func(tx *db.Database) error {
+		id, err := tx.CreateCSR(AppleCSR)
+		if err != nil {
+			return err
+		}
+		_, err = tx.RetrieveCSR(fmt.Sprint(id))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't complete Transaction: %s", err)
+	}
+	if _, err := database.WithContext(ctx).CreateUser("admin", "Admin123", 1); err != nil {
+		t.Fatalf("Couldn't complete CreateUser: %s", err)
+	}
+	if _, err := database.RetrieveUser("1"); err != nil {
+		t.Fatalf("Couldn't complete RetrieveUser: %s", err)
+	}
+	parent.End()
+
+	spans := map[string]tracetest.SpanStub{}
+	children := map[string]int{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+		children[span.Parent.SpanID().String()]++
+	}
+	transaction, ok := spans["transaction"]
+	if !ok || transaction.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("expected the transaction to be traced as a child of the request")
+	}
+	if children[transaction.SpanContext.SpanID().String()] != 2 {
+		t.Fatalf("expected the queries of the transaction to be traced as its children, got %d", children[transaction.SpanContext.SpanID().String()])
+	}
+	for _, name := range []string{"INSERT", "SELECT", "hash password"} {
+		if _, ok := spans[name]; !ok {
+			t.Fatalf("expected a %q span", name)
+		}
+	}
+	if hash := spans["hash password"]; hash.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("expected password hashing to be traced as a child of the request")
+	}
+	var roots int
+	for _, span := range exporter.GetSpans() {
+		if !span.Parent.IsValid() {
+			roots++
+		}
+	}
+	// The request and the query of the database without a context.
+	if roots != 2 {
+		t.Fatalf("expected queries without a context to be traced on their own, got %d root spans", roots)
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/canonical/notary/internal/tracing"
+)
+
+// querier is implemented by both database connections and transactions.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// querier returns the transaction the database is bound to, or its connection if there is none.
+// Its queries are traced in the context of the database.
+func (db *Database) querier() querier {
+	if db.tx != nil {
+		return tracedQuerier{db.tx, db}
+	}
+	return tracedQuerier{db.conn, db}
+}
+
+// Transaction runs fn with a copy of the database bound to a transaction, so that every operation fn
+// performs on it is applied all together or not at all. The transaction is committed if fn returns nil,
+// and rolled back otherwise, in which case the error of fn is returned.
+// Transactions can be nested: the inner one is then a savepoint of the outer one.
+// The transaction is traced in a span, which the spans of its queries are children of.
+func (db *Database) Transaction(fn func(tx *Database) error) (err error) {
+	if db.tx != nil {
+		if _, err := db.tx.Exec("SAVEPOINT nested"); err != nil {
+			return err
+		}
+		events := len(*db.txEvents)
+		if err := fn(db); err != nil {
+			*db.txEvents = (*db.txEvents)[:events]
+			db.tx.Exec("ROLLBACK TO nested") //nolint:errcheck
+			db.tx.Exec("RELEASE nested")     //nolint:errcheck
+			return err
+		}
+		_, err := db.tx.Exec("RELEASE nested")
+		return err
+	}
+	ctx, span := db.startSpan("transaction")
+	defer func() { tracing.End(span, err) }()
+	sqlTx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	var events []CertificateEvent
+	txDB := *db
+	txDB.tx = sqlTx
+	txDB.txEvents = &events
+	txDB.ctx = ctx
+	if err := fn(&txDB); err != nil {
+		sqlTx.Rollback() //nolint:errcheck
+		return err
+	}
+	if err := sqlTx.Commit(); err != nil {
+		return err
+	}
+	db.notifier.publish(events)
+	return nil
+}
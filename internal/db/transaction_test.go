@@ -0,0 +1,108 @@
+package db_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+func TestTransaction(t *testing.T) {
+	database, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+
+	errAbort := errors.New("abort")
+	err = database.Transaction(func(tx *db.Database) error {
+		if _, err := tx.CreateCSR(AppleCSR); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Expected the error of the transaction to be returned, got %v", err)
+	}
+	if csrs, _ := database.RetrieveAllCSRs(); len(csrs) != 0 {
+		t.Fatalf("Expected the transaction to be rolled back")
+	}
+
+	err = database.Transaction(func(tx *db.Database) error {
+		id, err := tx.CreateCSR(AppleCSR)
+		if err != nil {
+			return err
+		}
+		nestedErr := tx.Transaction(func(nested *db.Database) error {
+			if _, err := nested.CreateCSR(BananaCSR); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		if !errors.Is(nestedErr, errAbort) {
+			return fmt.Errorf("unexpected nested transaction error: %v", nestedErr)
+		}
+		_, err = tx.DeleteCSR(fmt.Sprint(id))
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateCSR(StrawberryCSR)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Couldn't complete transaction: %s", err)
+	}
+	csrs, _ := database.RetrieveAllCSRs()
+	if len(csrs) != 1 || csrs[0].CSR != StrawberryCSR {
+		t.Fatalf("Expected only the changes outside of the rolled back savepoint to be committed, got %+v", csrs)
+	}
+}
+
+func TestTransactionWithConcurrentWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notary.db")
+	database, err := db.NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Couldn't complete NewDatabase: %s", err)
+	}
+	defer database.Close()
+	other, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Couldn't open database: %s", err)
+	}
+	defer other.Close()
+	if _, err := other.Exec("CREATE TABLE scratch (value INTEGER)"); err != nil {
+		t.Fatalf("Couldn't create table: %s", err)
+	}
+
+	// The other writer holds the write lock when the transaction starts, and commits while it runs.
+	otherTx, err := other.Begin()
+	if err != nil {
+		t.Fatalf("Couldn't begin transaction: %s", err)
+	}
+	if _, err := otherTx.Exec("INSERT INTO scratch VALUES (1)"); err != nil {
+		t.Fatalf("Couldn't write: %s", err)
+	}
+	committed := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		committed <- otherTx.Commit()
+	}()
+	err = database.Transaction(func(tx *db.Database) error {
+		if _, err := tx.RetrieveAllCSRs(); err != nil {
+			return err
+		}
+		time.Sleep(200 * time.Millisecond)
+		_, err := tx.CreateCSR(AppleCSR)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Expected the transaction to wait for the other writer, got %s", err)
+	}
+	if err := <-committed; err != nil {
+		t.Fatalf("Couldn't commit the other transaction: %s", err)
+	}
+}
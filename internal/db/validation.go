@@ -2,7 +2,7 @@ package db
 
 import (
 	"bytes"
-	"crypto/rsa"
+	"crypto"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -10,23 +10,44 @@ import (
 	"strings"
 )
 
+// FieldError is the validation error of a field of a value, such as a certificate profile.
+// Fields are named like the columns that store them.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
 // ValidateCertificateRequest validates the given CSR string to the following:
 // The string must be a valid PEM string, and should be of type CERTIFICATE REQUEST
 // The PEM string should be able to be parsed into a x509 Certificate Request
+// The signature of the Certificate Request must be valid
 func ValidateCertificateRequest(csr string) error {
+	_, err := parseCertificateRequest(csr)
+	return err
+}
+
+// parseCertificateRequest decodes and parses the given CSR string,
+// and verifies that it was signed by the private key matching the public key it contains.
+func parseCertificateRequest(csr string) (*x509.CertificateRequest, error) {
 	block, _ := pem.Decode([]byte(csr))
 	if block == nil {
-		return errors.New("PEM Certificate Request string not found or malformed")
+		return nil, errors.New("PEM Certificate Request string not found or malformed")
 	}
 	if block.Type != "CERTIFICATE REQUEST" {
-		return errors.New("given PEM string not a certificate request")
+		return nil, errors.New("given PEM string not a certificate request")
 	}
-	_, err := x509.ParseCertificateRequest(block.Bytes)
+	parsedCSR, err := x509.ParseCertificateRequest(block.Bytes)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// TODO: We should validate the actual certificate request parameters here too. (Has the required fields etc)
-	return nil
+	if err := parsedCSR.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+	return parsedCSR, nil
 }
 
 // ValidateCertificate validates the given Cert string to the following:
@@ -39,6 +60,19 @@ func ValidateCertificateRequest(csr string) error {
 // The public key of the certificate should match the public key of the following certificate.
 // The issuer field of the certificate should match the subject field of the following certificate.
 func ValidateCertificate(cert string) error {
+	certificates, err := parseCertificateBundle(cert)
+	if err != nil {
+		return err
+	}
+	if len(certificates) < 2 {
+		return errors.New("less than 2 certificate PEM strings were found")
+	}
+	// TODO: We should validate the actual certificate parameters here too. (Has the required fields etc)
+	return validateCertificateChain(certificates)
+}
+
+// parseCertificateBundle parses every PEM formatted certificate in the given string, in order.
+func parseCertificateBundle(cert string) ([]*x509.Certificate, error) {
 	certData := []byte(cert)
 	certificates := []*x509.Certificate{}
 
@@ -48,33 +82,32 @@ func ValidateCertificate(cert string) error {
 			break
 		}
 		if certBlock.Type != "CERTIFICATE" {
-			return errors.New("a given PEM string was not a certificate")
+			return nil, errors.New("a given PEM string was not a certificate")
 		}
 		certificate, err := x509.ParseCertificate(certBlock.Bytes)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		certificates = append(certificates, certificate)
 		certData = rest
 	}
+	return certificates, nil
+}
 
-	if len(certificates) < 2 {
-		return errors.New("less than 2 certificate PEM strings were found")
-	}
-
+// validateCertificateChain makes sure that each certificate is issued by the one that follows it.
+func validateCertificateChain(certificates []*x509.Certificate) error {
 	for i, firstCert := range certificates[:len(certificates)-1] {
 		secondCert := certificates[i+1]
 		if !secondCert.IsCA {
-			return fmt.Errorf("invalid certificate chain: certificate %d is not a certificate authority", i+1)
+			return fmt.Errorf("%w: certificate %d is not a certificate authority", ErrInvalidChain, i+1)
 		}
 		if !bytes.Equal(firstCert.RawIssuer, secondCert.RawSubject) {
-			return fmt.Errorf("invalid certificate chain: certificate %d, certificate %d: subjects do not match", i, i+1)
+			return fmt.Errorf("%w: certificate %d, certificate %d: subjects do not match", ErrInvalidChain, i, i+1)
 		}
 		if err := firstCert.CheckSignatureFrom(secondCert); err != nil {
-			return fmt.Errorf("invalid certificate chain: certificate %d, certificate %d: keys do not match: %s", i, i+1, err.Error())
+			return fmt.Errorf("%w: certificate %d, certificate %d: keys do not match: %s", ErrInvalidChain, i, i+1, err.Error())
 		}
 	}
-	// TODO: We should validate the actual certificate parameters here too. (Has the required fields etc)
 	return nil
 }
 
@@ -92,10 +125,9 @@ func CertificateMatchesCSR(cert string, csr string) error {
 	parsedCSR, _ := x509.ParseCertificateRequest(csrBlock.Bytes)
 	certBlock, _ := pem.Decode([]byte(cert))
 	parsedCERT, _ := x509.ParseCertificate(certBlock.Bytes)
-	certKey := parsedCERT.PublicKey.(*rsa.PublicKey)
-	csrKey := parsedCSR.PublicKey.(*rsa.PublicKey)
-	if !csrKey.Equal(certKey) {
-		return errors.New("certificate does not match CSR")
+	csrKey, ok := parsedCSR.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !csrKey.Equal(parsedCERT.PublicKey) {
+		return ErrCertificateMismatch
 	}
 	return nil
 }
@@ -0,0 +1,227 @@
+// Package export encodes stored certificate bundles in the formats clients consume:
+// PEM, DER and PKCS#7 for certificates, and JKS and PKCS#12 for truststores.
+package export
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Certificate formats accepted by Encode.
+const (
+	FormatPEM = "pem"
+	FormatDER = "der"
+	FormatP7B = "p7b"
+)
+
+// Truststore formats accepted by TrustStore.
+const (
+	FormatJKS    = "jks"
+	FormatPKCS12 = "p12"
+)
+
+// Chain selections accepted by SelectChain.
+const (
+	// ChainLeaf selects the issued certificate only.
+	ChainLeaf = "leaf"
+	// ChainIssuers selects the certificates that issued the leaf, without the root.
+	ChainIssuers = "chain"
+	// ChainFull selects the leaf followed by its issuers, without the root.
+	ChainFull = "fullchain"
+	// ChainRoot selects the self signed root at the end of the bundle.
+	ChainRoot = "root"
+)
+
+// DefaultTrustStorePassword is the password used for truststores when none is given.
+// It is the password Java uses for its own cacerts truststore.
+const DefaultTrustStorePassword = "changeit"
+
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	ErrUnknownChain  = errors.New("unknown chain selection")
+	ErrNoRoot        = errors.New("bundle does not contain a root certificate")
+	ErrNoIssuers     = errors.New("bundle does not contain any issuer certificates")
+	ErrDERChain      = errors.New("der format can only hold a single certificate")
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+var contentTypes = map[string]string{
+	FormatPEM:    "application/x-pem-file",
+	FormatDER:    "application/pkix-cert",
+	FormatP7B:    "application/x-pkcs7-certificates",
+	FormatJKS:    "application/x-java-keystore",
+	FormatPKCS12: "application/x-pkcs12",
+}
+
+// ContentType returns the media type of the given format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Filename returns the name a file holding the given format should be saved under.
+func Filename(name string, format string) string {
+	return name + "." + format
+}
+
+// ParseBundle parses every certificate in a PEM encoded bundle, in order.
+func ParseBundle(bundle string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("bundle does not contain any certificates")
+	}
+	return certs, nil
+}
+
+// SelectChain returns the part of a bundle that the selection refers to.
+// The bundle must start with the leaf, followed by its issuers in order.
+func SelectChain(certs []*x509.Certificate, selection string) ([]*x509.Certificate, error) {
+	issuers := certs[1:]
+	var root *x509.Certificate
+	if len(issuers) > 0 && selfSigned(issuers[len(issuers)-1]) {
+		root = issuers[len(issuers)-1]
+		issuers = issuers[:len(issuers)-1]
+	}
+	switch selection {
+	case ChainLeaf:
+		return certs[:1], nil
+	case ChainIssuers:
+		if len(issuers) == 0 {
+			return nil, ErrNoIssuers
+		}
+		return issuers, nil
+	case ChainFull:
+		return append(certs[:1:1], issuers...), nil
+	case ChainRoot:
+		if root == nil {
+			return nil, ErrNoRoot
+		}
+		return []*x509.Certificate{root}, nil
+	}
+	return nil, ErrUnknownChain
+}
+
+// Encode encodes certificates in the given certificate format.
+func Encode(certs []*x509.Certificate, format string) ([]byte, error) {
+	switch format {
+	case FormatPEM:
+		var buff bytes.Buffer
+		for _, cert := range certs {
+			if err := pem.Encode(&buff, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+				return nil, err
+			}
+		}
+		return buff.Bytes(), nil
+	case FormatDER:
+		if len(certs) != 1 {
+			return nil, ErrDERChain
+		}
+		return certs[0].Raw, nil
+	case FormatP7B:
+		return encodePKCS7(certs)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// TrustStore builds a truststore in the given format that trusts every one of the certificates,
+// protected by the given password.
+func TrustStore(certs []*x509.Certificate, format string, password string) ([]byte, error) {
+	switch format {
+	case FormatJKS:
+		ks := keystore.New(keystore.WithOrderedAliases())
+		for i, cert := range certs {
+			entry := keystore.TrustedCertificateEntry{
+				CreationTime: time.Now(),
+				Certificate:  keystore.Certificate{Type: "X509", Content: cert.Raw},
+			}
+			if err := ks.SetTrustedCertificateEntry(alias(cert, i), entry); err != nil {
+				return nil, err
+			}
+		}
+		var buff bytes.Buffer
+		if err := ks.Store(&buff, []byte(password)); err != nil {
+			return nil, err
+		}
+		return buff.Bytes(), nil
+	case FormatPKCS12:
+		return pkcs12.Modern.EncodeTrustStore(certs, password)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// alias names a truststore entry after the common name of its certificate,
+// prefixed with its position so that entries are unique.
+func alias(cert *x509.Certificate, i int) string {
+	name := strings.ToLower(strings.ReplaceAll(cert.Subject.CommonName, " ", "-"))
+	if name == "" {
+		return fmt.Sprintf("ca-%d", i)
+	}
+	return fmt.Sprintf("ca-%d-%s", i, name)
+}
+
+func selfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// encodePKCS7 builds a degenerate, certificates only, PKCS#7 SignedData structure as described in RFC 2315.
+// This is the format of .p7b files.
+func encodePKCS7(certs []*x509.Certificate) ([]byte, error) {
+	type contentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"optional"`
+	}
+	type signedData struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      contentInfo
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+	content, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      contentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos:      emptySet,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	})
+}
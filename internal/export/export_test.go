@@ -0,0 +1,189 @@
+package export_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/export"
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// generateChain returns a leaf certificate, an intermediate CA and the root CA that issued it, in that order.
+func generateChain(t *testing.T) []*x509.Certificate {
+	t.Helper()
+	issue := func(cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("couldn't generate key: %s", err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(time.Now().UnixNano()),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  isCA,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		}
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatalf("couldn't create certificate: %s", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("couldn't parse certificate: %s", err)
+		}
+		return cert, key
+	}
+	root, rootKey := issue("Test Root CA", true, nil, nil)
+	intermediate, intermediateKey := issue("Test Intermediate CA", true, root, rootKey)
+	leaf, _ := issue("service.example.com", false, intermediate, intermediateKey)
+	return []*x509.Certificate{leaf, intermediate, root}
+}
+
+func TestSelectChain(t *testing.T) {
+	certs := generateChain(t)
+	leaf, intermediate, root := certs[0], certs[1], certs[2]
+	cases := []struct {
+		selection string
+		certs     []*x509.Certificate
+		expected  []*x509.Certificate
+		err       error
+	}{
+		{export.ChainLeaf, certs, []*x509.Certificate{leaf}, nil},
+		{export.ChainIssuers, certs, []*x509.Certificate{intermediate}, nil},
+		{export.ChainFull, certs, []*x509.Certificate{leaf, intermediate}, nil},
+		{export.ChainRoot, certs, []*x509.Certificate{root}, nil},
+		{export.ChainRoot, certs[:2], nil, export.ErrNoRoot},
+		{export.ChainIssuers, []*x509.Certificate{leaf, root}, nil, export.ErrNoIssuers},
+		{export.ChainFull, []*x509.Certificate{leaf, root}, []*x509.Certificate{leaf}, nil},
+		{"everything", certs, nil, export.ErrUnknownChain},
+	}
+	for _, tc := range cases {
+		selected, err := export.SelectChain(tc.certs, tc.selection)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%s: expected error %v, got %v", tc.selection, tc.err, err)
+		}
+		if len(selected) != len(tc.expected) {
+			t.Fatalf("%s: expected %d certificates, got %d", tc.selection, len(tc.expected), len(selected))
+		}
+		for i := range selected {
+			if !selected[i].Equal(tc.expected[i]) {
+				t.Fatalf("%s: unexpected certificate at position %d: %s", tc.selection, i, selected[i].Subject)
+			}
+		}
+	}
+	if len(certs) != 3 || !certs[1].Equal(intermediate) {
+		t.Fatalf("selecting a chain modified the bundle")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	certs := generateChain(t)
+
+	pemBytes, err := export.Encode(certs, export.FormatPEM)
+	if err != nil {
+		t.Fatalf("couldn't encode pem: %s", err)
+	}
+	parsed, err := export.ParseBundle(string(pemBytes))
+	if err != nil || len(parsed) != 3 || !parsed[2].Equal(certs[2]) {
+		t.Fatalf("pem encoding didn't round trip: %v", err)
+	}
+
+	derBytes, err := export.Encode(certs[:1], export.FormatDER)
+	if err != nil || !bytes.Equal(derBytes, certs[0].Raw) {
+		t.Fatalf("unexpected der encoding: %v", err)
+	}
+	if _, err := export.Encode(certs, export.FormatDER); !errors.Is(err, export.ErrDERChain) {
+		t.Fatalf("expected encoding a chain as der to fail, got %v", err)
+	}
+
+	p7bBytes, err := export.Encode(certs, export.FormatP7B)
+	if err != nil {
+		t.Fatalf("couldn't encode p7b: %s", err)
+	}
+	var contentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(p7bBytes, &contentInfo); err != nil {
+		t.Fatalf("couldn't parse p7b: %s", err)
+	}
+	var signedData struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue `asn1:"tag:0"`
+		SignerInfos      asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		t.Fatalf("couldn't parse p7b signed data: %s", err)
+	}
+	p7bCerts, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+	if err != nil || len(p7bCerts) != 3 || !p7bCerts[1].Equal(certs[1]) {
+		t.Fatalf("p7b doesn't hold the chain: %v", err)
+	}
+
+	if _, err := export.Encode(certs, "crt"); !errors.Is(err, export.ErrUnknownFormat) {
+		t.Fatalf("expected unknown format error, got %v", err)
+	}
+}
+
+func TestTrustStore(t *testing.T) {
+	certs := generateChain(t)[1:]
+
+	jksBytes, err := export.TrustStore(certs, export.FormatJKS, export.DefaultTrustStorePassword)
+	if err != nil {
+		t.Fatalf("couldn't build jks truststore: %s", err)
+	}
+	ks := keystore.New()
+	if err := ks.Load(bytes.NewReader(jksBytes), []byte(export.DefaultTrustStorePassword)); err != nil {
+		t.Fatalf("couldn't load jks truststore: %s", err)
+	}
+	entry, err := ks.GetTrustedCertificateEntry("ca-1-test-root-ca")
+	if err != nil {
+		t.Fatalf("root certificate missing from jks truststore: %s", err)
+	}
+	if !bytes.Equal(entry.Certificate.Content, certs[1].Raw) {
+		t.Fatalf("unexpected certificate in jks truststore")
+	}
+	if len(ks.Aliases()) != 2 {
+		t.Fatalf("expected 2 entries in jks truststore, got %v", ks.Aliases())
+	}
+
+	p12Bytes, err := export.TrustStore(certs, export.FormatPKCS12, "secret")
+	if err != nil {
+		t.Fatalf("couldn't build pkcs12 truststore: %s", err)
+	}
+	trusted, err := pkcs12.DecodeTrustStore(p12Bytes, "secret")
+	if err != nil {
+		t.Fatalf("couldn't decode pkcs12 truststore: %s", err)
+	}
+	if len(trusted) != 2 || !trusted[0].Equal(certs[0]) {
+		t.Fatalf("unexpected certificates in pkcs12 truststore")
+	}
+}
+
+func TestParseBundleFails(t *testing.T) {
+	if _, err := export.ParseBundle(""); err == nil {
+		t.Fatalf("expected parsing an empty bundle to fail")
+	}
+	garbage := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")})
+	if _, err := export.ParseBundle(string(garbage)); err == nil {
+		t.Fatalf("expected parsing an invalid certificate to fail")
+	}
+}
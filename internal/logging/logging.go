@@ -0,0 +1,91 @@
+// Package logging provides the structured logs of Notary, which carry the fields of the request being handled.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Formats of the logs.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Request holds the fields of a request that are added to every log emitted with its context.
+// User is only set once the request is authenticated.
+type Request struct {
+	ID       string
+	RemoteIP string
+	User     string
+}
+
+type requestKey struct{}
+
+// WithRequest returns a context carrying the fields of the request, for the logs emitted while handling it.
+func WithRequest(ctx context.Context, request *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+// RequestFromContext returns the fields of the request carried by the context, or nil when there are none.
+func RequestFromContext(ctx context.Context) *Request {
+	request, _ := ctx.Value(requestKey{}).(*Request)
+	return request
+}
+
+// ParseLevel parses a log level: debug, info, warn or error.
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", level)
+}
+
+// NewHandler returns a handler writing the logs of the given level and above to w, in the given format,
+// and adding the fields of the request and the trace carried by the context of every log.
+func NewHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	options := &slog.HandlerOptions{Level: level}
+	if format == FormatJSON {
+		return requestHandler{slog.NewJSONHandler(w, options)}
+	}
+	return requestHandler{slog.NewTextHandler(w, options)}
+}
+
+// requestHandler adds the fields of the request carried by the context to the logs, and the IDs of its trace
+// and of its span when it is traced.
+type requestHandler struct {
+	slog.Handler
+}
+
+func (h requestHandler) Handle(ctx context.Context, record slog.Record) error {
+	if request := RequestFromContext(ctx); request != nil {
+		record.AddAttrs(slog.String("request_id", request.ID), slog.String("remote_ip", request.RemoteIP))
+		if request.User != "" {
+			record.AddAttrs(slog.String("user", request.User))
+		}
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()), slog.String("span_id", spanContext.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestHandler) WithGroup(name string) slog.Handler {
+	return requestHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,77 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/canonical/notary/internal/logging"
+)
+
+func TestRequestFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(logging.NewHandler(&buf, logging.FormatJSON, slog.LevelInfo)).With("component", "test")
+	request := &logging.Request{ID: "abc", RemoteIP: "192.0.2.1"}
+	ctx := logging.WithRequest(context.Background(), request)
+
+	logger.InfoContext(ctx, "before login")
+	request.User = "alice"
+	logger.InfoContext(ctx, "after login")
+	logger.Info("without request")
+	logger.DebugContext(ctx, "below level")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 logs, got %d: %s", len(lines), buf.String())
+	}
+	var entries []map[string]any
+	for _, line := range lines {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("couldn't parse log %q: %s", line, err)
+		}
+		if entry["component"] != "test" {
+			t.Fatalf("expected the attributes of the logger to be kept: %s", line)
+		}
+		entries = append(entries, entry)
+	}
+	if entries[0]["request_id"] != "abc" || entries[0]["remote_ip"] != "192.0.2.1" || entries[0]["user"] != nil {
+		t.Fatalf("unexpected fields before login: %v", entries[0])
+	}
+	if entries[1]["request_id"] != "abc" || entries[1]["user"] != "alice" {
+		t.Fatalf("unexpected fields after login: %v", entries[1])
+	}
+	if entries[2]["request_id"] != nil {
+		t.Fatalf("expected no request fields without a request: %v", entries[2])
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(logging.NewHandler(&buf, logging.FormatText, slog.LevelDebug))
+	ctx := logging.WithRequest(context.Background(), &logging.Request{ID: "abc", RemoteIP: "192.0.2.1"})
+	logger.DebugContext(ctx, "handled")
+	if out := buf.String(); !strings.Contains(out, "level=DEBUG") || !strings.Contains(out, "request_id=abc") {
+		t.Fatalf("unexpected text log: %s", out)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for level, expected := range map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	} {
+		got, err := logging.ParseLevel(level)
+		if err != nil || got != expected {
+			t.Fatalf("expected %s for %q, got %s, %v", expected, level, got, err)
+		}
+	}
+	if _, err := logging.ParseLevel("verbose"); err == nil {
+		t.Fatal("expected an unknown level to be refused")
+	}
+}
@@ -1,11 +1,14 @@
 package metrics
 
 import (
+	"context"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/pem"
-	"errors"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/canonical/notary/internal/db"
@@ -25,27 +28,91 @@ type PrometheusMetrics struct {
 	CertificatesExpiringIn30Days   prometheus.Gauge
 	CertificatesExpiringIn90Days   prometheus.Gauge
 	ExpiredCertificates            prometheus.Gauge
+	CertificatesIssued             prometheus.Counter
+	CertificateRequestsRejected    prometheus.Counter
+	CertificatesRevoked            prometheus.Counter
+	IssuanceDuration               prometheus.Histogram
+	// CertificateExpiry is nil unless the expiry of every certificate is exported with ExportCertificateExpiry.
+	CertificateExpiry *prometheus.GaugeVec
 
-	RequestsTotal    prometheus.CounterVec
-	RequestsDuration prometheus.HistogramVec
+	RequestsTotal         prometheus.CounterVec
+	RequestsDuration      prometheus.HistogramVec
+	RequestsInFlight      prometheus.Gauge
+	LoginFailures         *prometheus.CounterVec
+	UnauthorizedResponses *prometheus.CounterVec
+	ForbiddenResponses    *prometheus.CounterVec
+
+	db *db.Database
+
+	// expiryMu guards the series of CertificateExpiry, by request id, and the maximum number of them.
+	expiryMu     sync.Mutex
+	expirySeries map[int]expirySeries
+	expiryLimit  int
 }
 
+// expirySeries is the series of CertificateExpiry of a certificate, which has the given fingerprint.
+type expirySeries struct {
+	fingerprint string
+	labels      prometheus.Labels
+	notAfter    float64
+}
+
+// ExpiryInterval is how often the metrics about expiring certificates are updated as time passes. The other metrics
+// about certificates are updated as soon as certificates are written.
+const ExpiryInterval = 120 * time.Second
+
 // NewMetricsSubsystem returns the metrics endpoint HTTP handler and the Prometheus metrics collectors for the server and middleware.
+// The metrics about certificates are only generated once Run is called.
 func NewMetricsSubsystem(db *db.Database) *PrometheusMetrics {
 	metricsBackend := newPrometheusMetrics()
 	metricsBackend.Handler = promhttp.HandlerFor(metricsBackend.registry, promhttp.HandlerOpts{})
-	ticker := time.NewTicker(120 * time.Second)
-	go func() {
-		for ; ; <-ticker.C {
-			csrs, err := db.RetrieveAllCSRs()
-			if err != nil {
-				log.Println(errors.Join(errors.New("error generating metrics repository: "), err))
-				panic(1)
+	metricsBackend.db = db
+	db.OnCertificateEvent(metricsBackend.observe)
+	return metricsBackend
+}
+
+// ExportCertificateExpiry exports the expiry of every certificate in CertificateExpiry, labeled by the ID of its
+// request, its common name and the common name of its issuer. To limit the cardinality of the metric, only the limit
+// certificates expiring first are exported, and certificates that were renewed are left out.
+// It must be called before Run.
+func (pm *PrometheusMetrics) ExportCertificateExpiry(limit int) {
+	pm.CertificateExpiry = certificateExpiryMetric()
+	pm.registry.MustRegister(pm.CertificateExpiry)
+	pm.expiryMu.Lock()
+	defer pm.expiryMu.Unlock()
+	pm.expiryLimit = limit
+}
+
+// Run generates the metrics about certificates from the database right away, and then again every time the
+// certificates of the database change, until the context is done. At every interval, the certificates are
+// counted again by expiry, so that they move from one expiry bucket to the next as time passes.
+// An update that fails is logged, and the previous values are kept until the next one, which updates every metric.
+// The result of every update is passed to report, unless it is nil.
+func (pm *PrometheusMetrics) Run(ctx context.Context, interval time.Duration, report func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	err := pm.Update(time.Now())
+	for {
+		if err != nil {
+			slog.Error("Couldn't generate metrics", "error", err)
+		}
+		if report != nil {
+			report(err)
+		}
+		failed := err != nil
+		select {
+		case <-ctx.Done():
+			return
+		case <-pm.db.Changes():
+			err = pm.Update(time.Now())
+		case <-ticker.C:
+			if failed {
+				err = pm.Update(time.Now())
+			} else {
+				err = pm.updateExpiry(time.Now())
 			}
-			metricsBackend.GenerateMetrics(csrs)
 		}
-	}()
-	return metricsBackend
+	}
 }
 
 // newPrometheusMetrics reads the status of the database, calculates all of the values of the metrics,
@@ -62,9 +129,17 @@ func newPrometheusMetrics() *PrometheusMetrics {
 		CertificatesExpiringIn7Days:    certificatesExpiringIn7DaysMetric(),
 		CertificatesExpiringIn30Days:   certificatesExpiringIn30DaysMetric(),
 		CertificatesExpiringIn90Days:   certificatesExpiringIn90DaysMetric(),
+		CertificatesIssued:             certificatesIssuedMetric(),
+		CertificateRequestsRejected:    certificateRequestsRejectedMetric(),
+		CertificatesRevoked:            certificatesRevokedMetric(),
+		IssuanceDuration:               issuanceDurationMetric(),
 
-		RequestsTotal:    requestsTotalMetric(),
-		RequestsDuration: requestDurationMetric(),
+		RequestsTotal:         requestsTotalMetric(),
+		RequestsDuration:      requestDurationMetric(),
+		RequestsInFlight:      requestsInFlightMetric(),
+		LoginFailures:         loginFailuresMetric(),
+		UnauthorizedResponses: unauthorizedResponsesMetric(),
+		ForbiddenResponses:    forbiddenResponsesMetric(),
 	}
 	m.registry.MustRegister(m.CertificateRequests)
 	m.registry.MustRegister(m.OutstandingCertificateRequests)
@@ -74,62 +149,138 @@ func newPrometheusMetrics() *PrometheusMetrics {
 	m.registry.MustRegister(m.CertificatesExpiringIn7Days)
 	m.registry.MustRegister(m.CertificatesExpiringIn30Days)
 	m.registry.MustRegister(m.CertificatesExpiringIn90Days)
+	m.registry.MustRegister(m.CertificatesIssued)
+	m.registry.MustRegister(m.CertificateRequestsRejected)
+	m.registry.MustRegister(m.CertificatesRevoked)
+	m.registry.MustRegister(m.IssuanceDuration)
 
 	m.registry.MustRegister(m.RequestsTotal)
 	m.registry.MustRegister(m.RequestsDuration)
+	m.registry.MustRegister(m.RequestsInFlight)
+	m.registry.MustRegister(m.LoginFailures)
+	m.registry.MustRegister(m.UnauthorizedResponses)
+	m.registry.MustRegister(m.ForbiddenResponses)
 
 	m.registry.MustRegister(collectors.NewGoCollector())
 	m.registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 	return m
 }
 
-// GenerateMetrics receives the live list of csrs to calculate the most recent values for the metrics
-// defined for prometheus
-func (pm *PrometheusMetrics) GenerateMetrics(csrs []db.CertificateRequest) {
-	var csrCount float64 = float64(len(csrs))
-	var outstandingCSRCount float64
-	var certCount float64
-	var expiredCertCount float64
-	var expiringIn1DayCertCount float64
-	var expiringIn7DaysCertCount float64
-	var expiringIn30DaysCertCount float64
-	var expiringIn90DaysCertCount float64
-	for _, entry := range csrs {
-		if entry.Certificate == "" {
-			outstandingCSRCount += 1
-			continue
+// Update sets the metrics about certificates from the number of certificate requests and certificates
+// in the database, and of certificates expiring at the given time, and exports the expiry of the certificates
+// expiring first when ExportCertificateExpiry was called.
+// Imported certificates count as certificates but not as certificate requests.
+func (pm *PrometheusMetrics) Update(now time.Time) error {
+	counts, err := pm.db.CountCertificates()
+	if err != nil {
+		return err
+	}
+	if err := pm.updateExpiry(now); err != nil {
+		return err
+	}
+	if err := pm.updateCertificateExpiry(); err != nil {
+		return err
+	}
+	pm.CertificateRequests.Set(float64(counts.CertificateRequests))
+	pm.OutstandingCertificateRequests.Set(float64(counts.OutstandingCertificateRequests))
+	pm.Certificates.Set(float64(counts.Certificates))
+	return nil
+}
+
+// updateExpiry sets the metrics about expiring certificates from the number of certificates in the database
+// expiring at the given time.
+func (pm *PrometheusMetrics) updateExpiry(now time.Time) error {
+	counts, err := pm.db.CountCertificatesByExpiry(now)
+	if err != nil {
+		return err
+	}
+	pm.ExpiredCertificates.Set(float64(counts.Expired))
+	pm.CertificatesExpiringIn1Day.Set(float64(counts.Within1Day))
+	pm.CertificatesExpiringIn7Days.Set(float64(counts.Within7Days))
+	pm.CertificatesExpiringIn30Days.Set(float64(counts.Within30Days))
+	pm.CertificatesExpiringIn90Days.Set(float64(counts.Within90Days))
+	return nil
+}
+
+// updateCertificateExpiry sets CertificateExpiry from the certificates expiring first in the database, and removes
+// the series of the certificates that aren't among them anymore, when the expiry of certificates is exported.
+// Certificates are only parsed when their series is created, or when their request has a new certificate.
+func (pm *PrometheusMetrics) updateCertificateExpiry() error {
+	pm.expiryMu.Lock()
+	defer pm.expiryMu.Unlock()
+	if pm.expiryLimit == 0 {
+		return nil
+	}
+	certificates, err := pm.db.RetrieveExpiringCertificates(pm.expiryLimit)
+	if err != nil {
+		return err
+	}
+	series := make(map[int]expirySeries, len(certificates))
+	for _, csr := range certificates {
+		current, ok := pm.expirySeries[csr.ID]
+		if !ok || current.fingerprint != csr.Fingerprint {
+			current, ok = newExpirySeries(csr)
+			if !ok {
+				continue
+			}
 		}
-		if entry.Certificate == "rejected" {
-			continue
+		series[csr.ID] = current
+	}
+	for id, previous := range pm.expirySeries {
+		if current, ok := series[id]; !ok || current.fingerprint != previous.fingerprint {
+			pm.CertificateExpiry.Delete(previous.labels)
 		}
-		certCount += 1
-		expiryDate := certificateExpiryDate(entry.Certificate)
-		daysRemaining := time.Until(expiryDate).Hours() / 24
-		if daysRemaining < 0 {
-			expiredCertCount += 1
-		} else {
-			if daysRemaining < 1 {
-				expiringIn1DayCertCount += 1
-			}
-			if daysRemaining < 7 {
-				expiringIn7DaysCertCount += 1
-			}
-			if daysRemaining < 30 {
-				expiringIn30DaysCertCount += 1
-			}
-			if daysRemaining < 90 {
-				expiringIn90DaysCertCount += 1
-			}
+	}
+	for _, current := range series {
+		pm.CertificateExpiry.With(current.labels).Set(current.notAfter)
+	}
+	pm.expirySeries = series
+	return nil
+}
+
+// newExpirySeries returns the series of CertificateExpiry of the certificate of the given request,
+// and false if the certificate can't be parsed.
+func newExpirySeries(csr db.CertificateRequest) (expirySeries, bool) {
+	block, _ := pem.Decode([]byte(csr.Certificate))
+	if block == nil {
+		return expirySeries{}, false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return expirySeries{}, false
+	}
+	return expirySeries{
+		fingerprint: csr.Fingerprint,
+		labels: prometheus.Labels{
+			"request_id":  strconv.Itoa(csr.ID),
+			"common_name": nameLabel(cert.Subject),
+			"issuer":      nameLabel(cert.Issuer),
+		},
+		notAfter: float64(cert.NotAfter.Unix()),
+	}, true
+}
+
+// nameLabel returns the common name of a subject or an issuer, or its whole distinguished name if it has none.
+func nameLabel(name pkix.Name) string {
+	if name.CommonName != "" {
+		return name.CommonName
+	}
+	return name.String()
+}
+
+// observe counts the certificates issued, rejected and revoked, and the time their requests took to be issued.
+func (pm *PrometheusMetrics) observe(event db.CertificateEvent) {
+	switch event.Type {
+	case db.EventIssued:
+		pm.CertificatesIssued.Inc()
+		if !event.SubmittedAt.IsZero() {
+			pm.IssuanceDuration.Observe(event.Time.Sub(event.SubmittedAt).Seconds())
 		}
+	case db.EventRejected:
+		pm.CertificateRequestsRejected.Inc()
+	case db.EventRevoked:
+		pm.CertificatesRevoked.Inc()
 	}
-	pm.CertificateRequests.Set(csrCount)
-	pm.OutstandingCertificateRequests.Set(outstandingCSRCount)
-	pm.Certificates.Set(certCount)
-	pm.ExpiredCertificates.Set(expiredCertCount)
-	pm.CertificatesExpiringIn1Day.Set(expiringIn1DayCertCount)
-	pm.CertificatesExpiringIn7Days.Set(expiringIn7DaysCertCount)
-	pm.CertificatesExpiringIn30Days.Set(expiringIn30DaysCertCount)
-	pm.CertificatesExpiringIn90Days.Set(expiringIn90DaysCertCount)
 }
 
 func certificateRequestsMetric() prometheus.Gauge {
@@ -196,12 +347,53 @@ func certificatesExpiringIn90DaysMetric() prometheus.Gauge {
 	return metric
 }
 
+func certificatesIssuedMetric() prometheus.Counter {
+	metric := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "certificates_issued_total",
+		Help: "Total number of certificates provided to certificate requests",
+	})
+	return metric
+}
+
+func certificateRequestsRejectedMetric() prometheus.Counter {
+	metric := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "certificate_requests_rejected_total",
+		Help: "Total number of certificate requests rejected",
+	})
+	return metric
+}
+
+func certificatesRevokedMetric() prometheus.Counter {
+	metric := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "certificates_revoked_total",
+		Help: "Total number of certificates revoked from their certificate request",
+	})
+	return metric
+}
+
+func issuanceDurationMetric() prometheus.Histogram {
+	metric := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "certificate_issuance_duration_seconds",
+		Help:    "Time from the submission of certificate requests to the issuance of their certificate",
+		Buckets: []float64{1, 10, 60, 600, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600},
+	})
+	return metric
+}
+
+func certificateExpiryMetric() *prometheus.GaugeVec {
+	metric := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "certificate_expiry_timestamp_seconds",
+		Help: "Expiry of certificates, in seconds since the epoch",
+	}, []string{"request_id", "common_name", "issuer"})
+	return metric
+}
+
 func requestsTotalMetric() prometheus.CounterVec {
 	metric := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_requests_total",
 			Help: "Tracks the number of HTTP requests.",
-		}, []string{"method", "code"},
+		}, []string{"method", "route", "code"},
 	)
 	return *metric
 }
@@ -211,15 +403,40 @@ func requestDurationMetric() prometheus.HistogramVec {
 		prometheus.HistogramOpts{
 			Name:    "http_request_duration_seconds",
 			Help:    "Tracks the latencies for HTTP requests.",
-			Buckets: prometheus.ExponentialBuckets(0.1, 1.5, 5),
-		}, []string{"method", "code"},
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "code"},
 	)
 	return *metric
 }
 
-func certificateExpiryDate(certString string) time.Time {
-	certBlock, _ := pem.Decode([]byte(certString))
-	cert, _ := x509.ParseCertificate(certBlock.Bytes)
-	// TODO: cert.NotAfter can exist in a wrong cert. We should catch that at the db level validation
-	return cert.NotAfter
+func requestsInFlightMetric() prometheus.Gauge {
+	metric := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests being handled.",
+	})
+	return metric
+}
+
+func loginFailuresMetric() *prometheus.CounterVec {
+	metric := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "login_failures_total",
+		Help: "Total number of failed logins, by reason.",
+	}, []string{"reason"})
+	return metric
+}
+
+func unauthorizedResponsesMetric() *prometheus.CounterVec {
+	metric := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_unauthorized_responses_total",
+		Help: "Total number of HTTP requests refused because they aren't authenticated, by reason.",
+	}, []string{"reason"})
+	return metric
+}
+
+func forbiddenResponsesMetric() *prometheus.CounterVec {
+	metric := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_forbidden_responses_total",
+		Help: "Total number of HTTP requests refused because the user isn't allowed to make them, by reason.",
+	}, []string{"reason"})
+	return metric
 }
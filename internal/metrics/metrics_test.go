@@ -2,9 +2,12 @@ package metrics_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
 	"math/big"
@@ -17,6 +20,7 @@ import (
 
 	"github.com/canonical/notary/internal/db"
 	metrics "github.com/canonical/notary/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // TestPrometheusHandler tests that the Prometheus metrics handler responds correctly to an HTTP request.
@@ -117,8 +121,9 @@ func TestMetrics(t *testing.T) {
 	}
 	initializeTestDB(t, db)
 	m := metrics.NewMetricsSubsystem(db)
-	csrs, _ := db.RetrieveAllCSRs()
-	m.GenerateMetrics(csrs)
+	if err := m.Update(time.Now()); err != nil {
+		t.Fatalf("couldn't update metrics: %s", err)
+	}
 
 	request, _ := http.NewRequest("GET", "/", nil)
 	recorder := httptest.NewRecorder()
@@ -171,3 +176,196 @@ func TestMetrics(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestRun tests that metrics are generated right away and as soon as certificates are written, that database errors
+// don't stop the generation, and that it stops with its context.
+func TestRun(t *testing.T) {
+	db, err := db.NewDatabase(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	initializeTestDB(t, db)
+	m := metrics.NewMetricsSubsystem(db)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx, time.Hour, nil)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(m.CertificateRequests) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics weren't generated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	csr, _, _ := generateCertPair(10)
+	if _, err := db.CreateCSR(csr); err != nil {
+		t.Fatalf("couldn't create test csr: %s", err)
+	}
+	for testutil.ToFloat64(m.OutstandingCertificateRequests) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics weren't updated after a write")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Update(time.Now()); err == nil {
+		t.Fatalf("expected updating the metrics to fail once the database is closed")
+	}
+	if testutil.ToFloat64(m.CertificateRequests) != 4 {
+		t.Fatalf("expected the previous metrics to be kept when the database fails")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("metrics generation didn't stop with its context")
+	}
+}
+
+// TestLifecycleMetrics tests that certificates issued, rejected and revoked are counted, with the time their requests
+// took to be issued.
+func TestLifecycleMetrics(t *testing.T) {
+	db, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m := metrics.NewMetricsSubsystem(db)
+	initializeTestDB(t, db)
+	csr, _, _ := generateCertPair(10)
+	id, err := db.CreateCSR(csr)
+	if err != nil {
+		t.Fatalf("couldn't create test csr: %s", err)
+	}
+	if _, err := db.UpdateCSR(fmt.Sprint(id), "rejected"); err != nil {
+		t.Fatalf("couldn't reject test csr: %s", err)
+	}
+	if _, err := db.UpdateCSR("1", ""); err != nil {
+		t.Fatalf("couldn't revoke test cert: %s", err)
+	}
+
+	if issued := testutil.ToFloat64(m.CertificatesIssued); issued != 3 {
+		t.Fatalf("expected 3 issued certificates, got %v", issued)
+	}
+	if rejected := testutil.ToFloat64(m.CertificateRequestsRejected); rejected != 1 {
+		t.Fatalf("expected 1 rejected certificate request, got %v", rejected)
+	}
+	if revoked := testutil.ToFloat64(m.CertificatesRevoked); revoked != 1 {
+		t.Fatalf("expected 1 revoked certificate, got %v", revoked)
+	}
+	recorder := httptest.NewRecorder()
+	m.Handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(recorder.Body.String(), "certificate_issuance_duration_seconds_count 3") ||
+		!strings.Contains(recorder.Body.String(), `certificate_issuance_duration_seconds_bucket{le="1"} 3`) {
+		t.Fatalf("expected the issuance of 3 certificates to be observed right after their submission")
+	}
+}
+
+// TestCertificateExpiry tests that the expiry of the certificates expiring first is exported when enabled,
+// and that the series of certificates that are revoked are removed.
+func TestCertificateExpiry(t *testing.T) {
+	db, err := db.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	initializeTestDB(t, db)
+	m := metrics.NewMetricsSubsystem(db)
+	if m.CertificateExpiry != nil {
+		t.Fatalf("expected the expiry of certificates not to be exported by default")
+	}
+	m.ExportCertificateExpiry(2)
+	if err := m.Update(time.Now()); err != nil {
+		t.Fatalf("couldn't update metrics: %s", err)
+	}
+	expiry := func(id string) float64 {
+		return testutil.ToFloat64(m.CertificateExpiry.WithLabelValues(id, "", ""))
+	}
+	if count := testutil.CollectAndCount(m.CertificateExpiry); count != 2 {
+		t.Fatalf("expected the expiry of 2 certificates to be exported, got %d", count)
+	}
+	if expiresIn := time.Until(time.Unix(int64(expiry("1")), 0)); expiresIn < 4*24*time.Hour || expiresIn > 5*24*time.Hour {
+		t.Fatalf("unexpected expiry of the certificate: %s", expiresIn)
+	}
+
+	if _, err := db.UpdateCSR("1", ""); err != nil {
+		t.Fatalf("couldn't revoke test cert: %s", err)
+	}
+	if err := m.Update(time.Now()); err != nil {
+		t.Fatalf("couldn't update metrics: %s", err)
+	}
+	if count := testutil.CollectAndCount(m.CertificateExpiry); count != 2 {
+		t.Fatalf("expected the expiry of 2 certificates to be exported, got %d", count)
+	}
+	if expiry("1") != 0 || expiry("3") == 0 {
+		t.Fatalf("expected the revoked certificate to be replaced by the next one expiring")
+	}
+}
+
+// BenchmarkUpdate measures updating the metrics about certificates from a database holding 100k certificates,
+// expiring over the next year or expired in the last month, and with the expiry of 1000 of them exported.
+func BenchmarkUpdate(b *testing.B) {
+	database, err := db.NewDatabase(filepath.Join(b.TempDir(), "db.sqlite3"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer database.Close()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		b.Fatal(err)
+	}
+	err = database.Transaction(func(tx *db.Database) error {
+		for i := 0; i < 100000; i++ {
+			template := x509.Certificate{
+				SerialNumber: big.NewInt(int64(i + 1)),
+				Subject:      pkix.Name{CommonName: fmt.Sprintf("%d.example.com", i)},
+				NotBefore:    time.Now().AddDate(-1, 0, 0),
+				NotAfter:     time.Now().Add(time.Duration(i%395-30) * 24 * time.Hour),
+			}
+			der, err := x509.CreateCertificate(rand.Reader, &template, &template, public, private)
+			if err != nil {
+				return err
+			}
+			if _, _, err := tx.ImportCertificate(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	m := metrics.NewMetricsSubsystem(database)
+
+	b.Run("all", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := m.Update(time.Now()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("expiry", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := database.CountCertificatesByExpiry(time.Now()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("certificate expiry", func(b *testing.B) {
+		m := metrics.NewMetricsSubsystem(database)
+		m.ExportCertificateExpiry(1000)
+		for i := 0; i < b.N; i++ {
+			if err := m.Update(time.Now()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	if got := testutil.ToFloat64(m.Certificates); got != 100000 {
+		b.Fatalf("expected 100000 certificates, got %v", got)
+	}
+}
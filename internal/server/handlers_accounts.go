@@ -3,11 +3,9 @@ package server
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
-	"regexp"
 	"strconv"
-	"strings"
 
 	"github.com/canonical/notary/internal/db"
 )
@@ -39,30 +37,13 @@ type DeleteAccountResponse struct {
 	ID int `json:"id"`
 }
 
-func validatePassword(password string) bool {
-	if len(password) < 8 {
-		return false
-	}
-	hasCapital := regexp.MustCompile(`[A-Z]`).MatchString(password)
-	if !hasCapital {
-		return false
-	}
-	hasLower := regexp.MustCompile(`[a-z]`).MatchString(password)
-	if !hasLower {
-		return false
-	}
-	hasNumberOrSymbol := regexp.MustCompile(`[0-9!@#$%^&*()_+\-=\[\]{};':"|,.<>?~]`).MatchString(password)
-
-	return hasNumberOrSymbol
-}
-
 // ListAccounts returns all accounts from the database
 func ListAccounts(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		accounts, err := env.DB.RetrieveAllUsers()
+		accounts, err := env.DB.WithContext(r.Context()).RetrieveAllUsers()
 		if err != nil {
-			log.Println(err)
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
 		accountsResponse := make([]GetAccountResponse, len(accounts))
@@ -76,7 +57,7 @@ func ListAccounts(env *HandlerConfig) http.HandlerFunc {
 		w.WriteHeader(http.StatusOK)
 		err = writeJSON(w, accountsResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
@@ -90,21 +71,22 @@ func GetAccount(env *HandlerConfig) http.HandlerFunc {
 		var account db.User
 		var err error
 		if id == "me" {
-			claims, headerErr := getClaimsFromAuthorizationHeader(r.Header.Get("Authorization"), env.JWTSecret)
+			claims, headerErr := getClaims(r, env.JWTSecret)
 			if headerErr != nil {
-				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				deny(w, r, http.StatusUnauthorized, unauthorizedReason(headerErr), "Unauthorized")
+				return
 			}
-			account, err = env.DB.RetrieveUserByUsername(claims.Username)
+			account, err = env.DB.WithContext(r.Context()).RetrieveUserByUsername(claims.Username)
 		} else {
-			account, err = env.DB.RetrieveUser(id)
+			account, err = env.DB.WithContext(r.Context()).RetrieveUser(id)
 		}
 		if err != nil {
-			log.Println(err)
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
 			if errors.Is(err, db.ErrIdNotFound) {
-				writeError(w, http.StatusNotFound, "Not Found")
+				writeError(w, r, http.StatusNotFound, "Not Found")
 				return
 			}
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
 		accountResponse := GetAccountResponse{
@@ -115,7 +97,7 @@ func GetAccount(env *HandlerConfig) http.HandlerFunc {
 		w.WriteHeader(http.StatusOK)
 		err = writeJSON(w, accountResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
@@ -126,28 +108,24 @@ func CreateAccount(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var createAccountParams CreateAccountParams
 		if err := json.NewDecoder(r.Body).Decode(&createAccountParams); err != nil {
-			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			writeProblem(w, r, errInvalidJSON)
 			return
 		}
 		if createAccountParams.Username == "" {
-			writeError(w, http.StatusBadRequest, "Username is required")
+			writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeMissingField, "username", "Username is required"))
 			return
 		}
 		if createAccountParams.Password == "" {
-			writeError(w, http.StatusBadRequest, "Password is required")
+			writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeMissingField, "password", "Password is required"))
 			return
 		}
-		if !validatePassword(createAccountParams.Password) {
-			writeError(
-				w,
-				http.StatusBadRequest,
-				"Password must have 8 or more characters, must include at least one capital letter, one lowercase letter, and either a number or a symbol.",
-			)
+		if !db.ValidatePassword(createAccountParams.Password) {
+			writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeWeakPassword, "password", db.PasswordRequirements))
 			return
 		}
-		numUsers, err := env.DB.NumUsers()
+		numUsers, err := env.DB.WithContext(r.Context()).NumUsers()
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "Failed to retrieve accounts: "+err.Error())
+			writeError(w, r, http.StatusInternalServerError, "Failed to retrieve accounts: "+err.Error())
 			return
 		}
 
@@ -155,14 +133,14 @@ func CreateAccount(env *HandlerConfig) http.HandlerFunc {
 		if numUsers == 0 {
 			permission = AdminPermission
 		}
-		id, err := env.DB.CreateUser(createAccountParams.Username, createAccountParams.Password, permission)
+		id, err := env.DB.WithContext(r.Context()).CreateUser(createAccountParams.Username, createAccountParams.Password, permission)
 		if err != nil {
-			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-				writeError(w, http.StatusBadRequest, "account with given username already exists")
+			if errors.Is(err, db.ErrAlreadyExists) {
+				writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeAlreadyExists, "username", "account with given username already exists"))
 				return
 			}
-			log.Println(err)
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
 		accountResponse := CreateAccountResponse{
@@ -171,7 +149,7 @@ func CreateAccount(env *HandlerConfig) http.HandlerFunc {
 		w.WriteHeader(http.StatusCreated)
 		err = writeJSON(w, accountResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
@@ -184,30 +162,30 @@ func DeleteAccount(env *HandlerConfig) http.HandlerFunc {
 		id := r.PathValue("id")
 		idInt, err := strconv.ParseInt(id, 10, 64)
 		if err != nil {
-			log.Println(err)
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
-		account, err := env.DB.RetrieveUser(id)
+		account, err := env.DB.WithContext(r.Context()).RetrieveUser(id)
 		if err != nil {
 			if !errors.Is(err, db.ErrIdNotFound) {
-				log.Println(err)
-				writeError(w, http.StatusInternalServerError, "Internal Error")
+				slog.ErrorContext(r.Context(), "Request failed", "error", err)
+				writeError(w, r, http.StatusInternalServerError, "Internal Error")
 				return
 			}
 		}
 		if account.Permissions == 1 {
-			writeError(w, http.StatusBadRequest, "deleting an Admin account is not allowed.")
+			writeProblem(w, r, newProblem(http.StatusBadRequest, codeAdminAccount, "deleting an Admin account is not allowed."))
 			return
 		}
-		_, err = env.DB.DeleteUser(id)
+		_, err = env.DB.WithContext(r.Context()).DeleteUser(id)
 		if err != nil {
-			log.Println(err)
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
 			if errors.Is(err, db.ErrIdNotFound) {
-				writeError(w, http.StatusNotFound, "Not Found")
+				writeError(w, r, http.StatusNotFound, "Not Found")
 				return
 			}
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
 		deleteAccountResponse := DeleteAccountResponse{
@@ -216,7 +194,7 @@ func DeleteAccount(env *HandlerConfig) http.HandlerFunc {
 		w.WriteHeader(http.StatusAccepted)
 		err = writeJSON(w, deleteAccountResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
@@ -226,45 +204,41 @@ func ChangeAccountPassword(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
 		if id == "me" {
-			claims, err := getClaimsFromAuthorizationHeader(r.Header.Get("Authorization"), env.JWTSecret)
+			claims, err := getClaims(r, env.JWTSecret)
 			if err != nil {
-				log.Println(err)
-				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				slog.InfoContext(r.Context(), "Authentication failed", "error", err)
+				deny(w, r, http.StatusUnauthorized, unauthorizedReason(err), "Unauthorized")
 				return
 			}
-			account, err := env.DB.RetrieveUserByUsername(claims.Username)
+			account, err := env.DB.WithContext(r.Context()).RetrieveUserByUsername(claims.Username)
 			if err != nil {
-				log.Println(err)
-				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				slog.ErrorContext(r.Context(), "Request failed", "error", err)
+				deny(w, r, http.StatusUnauthorized, reasonUnknownUser, "Unauthorized")
 				return
 			}
 			id = strconv.Itoa(account.ID)
 		}
 		var changeAccountParams ChangeAccountParams
 		if err := json.NewDecoder(r.Body).Decode(&changeAccountParams); err != nil {
-			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			writeProblem(w, r, errInvalidJSON)
 			return
 		}
 		if changeAccountParams.Password == "" {
-			writeError(w, http.StatusBadRequest, "Password is required")
+			writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeMissingField, "password", "Password is required"))
 			return
 		}
-		if !validatePassword(changeAccountParams.Password) {
-			writeError(
-				w,
-				http.StatusBadRequest,
-				"Password must have 8 or more characters, must include at least one capital letter, one lowercase letter, and either a number or a symbol.",
-			)
+		if !db.ValidatePassword(changeAccountParams.Password) {
+			writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeWeakPassword, "password", db.PasswordRequirements))
 			return
 		}
-		ret, err := env.DB.UpdateUser(id, changeAccountParams.Password)
+		ret, err := env.DB.WithContext(r.Context()).UpdateUser(id, changeAccountParams.Password)
 		if err != nil {
-			log.Println(err)
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
 			if errors.Is(err, db.ErrIdNotFound) {
-				writeError(w, http.StatusNotFound, "Not Found")
+				writeError(w, r, http.StatusNotFound, "Not Found")
 				return
 			}
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
 		changeAccountResponse := ChangeAccountResponse{
@@ -273,7 +247,7 @@ func ChangeAccountPassword(env *HandlerConfig) http.HandlerFunc {
 		w.WriteHeader(http.StatusCreated)
 		err = writeJSON(w, changeAccountResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
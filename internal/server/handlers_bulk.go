@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+// maxBulkItems is the largest number of items a single bulk request can hold.
+const maxBulkItems = 1000
+
+// errBulkRolledBack aborts the transaction of an atomic bulk operation in which an item failed.
+var errBulkRolledBack = errors.New("bulk operation rolled back")
+
+type BulkCreateCertificateRequestsParams struct {
+	CertificateRequests []CreateCertificateRequestParams `json:"certificate_requests"`
+	Atomic              bool                             `json:"atomic"`
+}
+
+type BulkCertificateRequestsParams struct {
+	IDs    []int `json:"ids"`
+	Atomic bool  `json:"atomic"`
+}
+
+type BulkSignCertificateRequestsParams struct {
+	IDs       []int `json:"ids"`
+	ProfileID int   `json:"profile_id,omitempty"`
+	Atomic    bool  `json:"atomic"`
+}
+
+// BulkItemResult is the outcome of a single item of a bulk operation.
+// Status is the HTTP status the equivalent single item request would have returned, and Code and Fields
+// the code and fields of its error response, if it failed.
+type BulkItemResult struct {
+	ID     int            `json:"id,omitempty"`
+	Status int            `json:"status"`
+	Error  string         `json:"error,omitempty"`
+	Code   string         `json:"code,omitempty"`
+	Fields []ProblemField `json:"fields,omitempty"`
+}
+
+// BulkResponse holds the outcome of every item of a bulk operation, in order.
+// Committed is false when an atomic operation was rolled back because one of its items failed,
+// in which case none of the items were applied.
+type BulkResponse struct {
+	Committed bool             `json:"committed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+// BulkCreateCertificateRequests creates every certificate request in the request body
+func BulkCreateCertificateRequests(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var params BulkCreateCertificateRequestsParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeProblem(w, r, errInvalidJSON)
+			return
+		}
+		requests := params.CertificateRequests
+		if !validBulkSize(w, r, len(requests)) {
+			return
+		}
+		runBulk(w, r, accountDB(env, r), params.Atomic, len(requests), func(database *db.Database, i int) BulkItemResult {
+			id, p := createCSR(r.Context(), database, requests[i])
+			return newBulkItemResult(int(id), http.StatusCreated, p)
+		})
+	}
+}
+
+// BulkDeleteCertificateRequests deletes every certificate request whose id is in the request body
+func BulkDeleteCertificateRequests(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var params BulkCertificateRequestsParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeProblem(w, r, errInvalidJSON)
+			return
+		}
+		if !validBulkSize(w, r, len(params.IDs)) {
+			return
+		}
+		runBulk(w, r, env.DB.WithContext(r.Context()), params.Atomic, len(params.IDs), func(database *db.Database, i int) BulkItemResult {
+			_, p := deleteCSR(r.Context(), database, strconv.Itoa(params.IDs[i]))
+			return newBulkItemResult(params.IDs[i], http.StatusAccepted, p)
+		})
+	}
+}
+
+// BulkRejectCertificateRequests rejects every certificate request whose id is in the request body
+func BulkRejectCertificateRequests(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var params BulkCertificateRequestsParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeProblem(w, r, errInvalidJSON)
+			return
+		}
+		if !validBulkSize(w, r, len(params.IDs)) {
+			return
+		}
+		results, committed := runBulk(w, r, env.DB.WithContext(r.Context()), params.Atomic, len(params.IDs), func(database *db.Database, i int) BulkItemResult {
+			_, p := rejectCSR(r.Context(), database, strconv.Itoa(params.IDs[i]))
+			return newBulkItemResult(params.IDs[i], http.StatusAccepted, p)
+		})
+		notifyBulkCertificateUpdates(r.Context(), env, results, committed)
+	}
+}
+
+// BulkSignCertificateRequests signs every certificate request whose id is in the request body with the signing CA.
+// The certificate profile given in the request body is used if any, otherwise the profile selected for each request is used.
+func BulkSignCertificateRequests(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var params BulkSignCertificateRequestsParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeProblem(w, r, errInvalidJSON)
+			return
+		}
+		if !validBulkSize(w, r, len(params.IDs)) {
+			return
+		}
+		if env.signingCA() == nil {
+			writeProblem(w, r, errNoSigningCA)
+			return
+		}
+		results, committed := runBulk(w, r, env.DB.WithContext(r.Context()), params.Atomic, len(params.IDs), func(database *db.Database, i int) BulkItemResult {
+			_, p := signCSR(r.Context(), env, database, strconv.Itoa(params.IDs[i]), params.ProfileID)
+			return newBulkItemResult(params.IDs[i], http.StatusCreated, p)
+		})
+		notifyBulkCertificateUpdates(r.Context(), env, results, committed)
+	}
+}
+
+func validBulkSize(w http.ResponseWriter, r *http.Request, size int) bool {
+	if size == 0 {
+		writeProblem(w, r, newProblem(http.StatusBadRequest, codeInvalidBulkSize, "no items were given"))
+		return false
+	}
+	if size > maxBulkItems {
+		writeProblem(w, r, newProblem(http.StatusBadRequest, codeInvalidBulkSize, fmt.Sprintf("too many items: at most %d can be given", maxBulkItems)))
+		return false
+	}
+	return true
+}
+
+// newBulkItemResult returns the result of an item that succeeded with the given status, or failed with the given problem.
+func newBulkItemResult(id int, status int, p *problem) BulkItemResult {
+	if p != nil {
+		return BulkItemResult{ID: id, Status: p.status, Error: p.message, Code: p.code, Fields: p.fields}
+	}
+	return BulkItemResult{ID: id, Status: status}
+}
+
+// runBulk applies op to every item of a bulk operation and writes the results.
+// Atomic operations run in a single transaction that is rolled back if any item fails, in which case
+// every item is still attempted, so that all failures are reported at once, and the response has a 400 status.
+// Other operations apply every item on its own, and report the failed items alongside the successful ones.
+func runBulk(w http.ResponseWriter, r *http.Request, database *db.Database, atomic bool, size int, op func(database *db.Database, i int) BulkItemResult) ([]BulkItemResult, bool) {
+	results := make([]BulkItemResult, size)
+	committed := true
+	if atomic {
+		err := database.Transaction(func(tx *db.Database) error {
+			failed := false
+			for i := range results {
+				results[i] = op(tx, i)
+				failed = failed || results[i].Error != ""
+			}
+			if failed {
+				return errBulkRolledBack
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errBulkRolledBack) {
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
+			return nil, false
+		}
+		committed = err == nil
+	} else {
+		for i := range results {
+			results[i] = op(database, i)
+		}
+	}
+	status := http.StatusOK
+	if !committed {
+		status = http.StatusBadRequest
+	}
+	w.WriteHeader(status)
+	err := writeJSON(w, BulkResponse{Committed: committed, Results: results})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+	return results, committed
+}
+
+// notifyBulkCertificateUpdates sends a pebble notification for every certificate a bulk operation updated.
+func notifyBulkCertificateUpdates(ctx context.Context, env *HandlerConfig, results []BulkItemResult, committed bool) {
+	if !committed {
+		return
+	}
+	for _, result := range results {
+		if result.Error == "" {
+			notifyCertificateUpdate(ctx, env, int64(result.ID))
+		}
+	}
+}
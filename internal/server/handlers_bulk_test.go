@@ -0,0 +1,211 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+type BulkItemResult struct {
+	ID     int    `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+	Code   string `json:"code"`
+}
+
+type BulkResponseResult struct {
+	Committed bool             `json:"committed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+type BulkResponse struct {
+	Error  string             `json:"error,omitempty"`
+	Result BulkResponseResult `json:"result"`
+}
+
+func bulkRequest(url string, client *http.Client, token string, path string, params any) (int, *BulkResponse, error) {
+	reqData, err := json.Marshal(params)
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequest("POST", url+"/api/v1/certificate_requests/bulk"+path, bytes.NewReader(reqData))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	var bulkResponse BulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&bulkResponse); err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, &bulkResponse, nil
+}
+
+func expectBulkStatuses(t *testing.T, response *BulkResponse, committed bool, statuses ...int) {
+	t.Helper()
+	if response.Result.Committed != committed {
+		t.Fatalf("expected committed to be %t", committed)
+	}
+	if len(response.Result.Results) != len(statuses) {
+		t.Fatalf("expected %d results, got %+v", len(statuses), response.Result.Results)
+	}
+	for i, result := range response.Result.Results {
+		if result.Status != statuses[i] {
+			t.Fatalf("expected item %d to have status %d, got %+v", i, statuses[i], result)
+		}
+	}
+}
+
+func TestBulkCertificateRequestsEndToEnd(t *testing.T) {
+	ts, config, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+	config.SigningCA = newTestSigningCA(t)
+
+	var adminToken string
+	var nonAdminToken string
+	t.Run("prepare user accounts and tokens", prepareAccounts(ts.URL, client, &adminToken, &nonAdminToken))
+
+	first := newTestCSR(t, "first.example.com")
+	second := newTestCSR(t, "second.example.com")
+
+	t.Run("1. Bulk create - atomic with an invalid item", func(t *testing.T) {
+		params := map[string]any{
+			"certificate_requests": []CreateCertificateRequestParams{{CSR: first}, {CSR: "not a csr"}},
+			"atomic":               true,
+		}
+		statusCode, bulkResponse, err := bulkRequest(ts.URL, client, adminToken, "", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, statusCode)
+		}
+		expectBulkStatuses(t, bulkResponse, false, http.StatusCreated, http.StatusBadRequest)
+		_, listResponse, err := listCertificateRequests(ts.URL, client, adminToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listResponse.Result) != 0 {
+			t.Fatalf("expected the atomic operation to be rolled back")
+		}
+	})
+
+	t.Run("2. Bulk create - best effort", func(t *testing.T) {
+		params := map[string]any{
+			"certificate_requests": []CreateCertificateRequestParams{{CSR: first, ProfileID: 1}, {CSR: first}, {CSR: second, ProfileID: 1}},
+		}
+		statusCode, bulkResponse, err := bulkRequest(ts.URL, client, nonAdminToken, "", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		expectBulkStatuses(t, bulkResponse, true, http.StatusCreated, http.StatusBadRequest, http.StatusCreated)
+		if bulkResponse.Result.Results[1].Error != "given csr already recorded" || bulkResponse.Result.Results[1].Code != "already_exists" {
+			t.Fatalf("unexpected error: %s (%s)", bulkResponse.Result.Results[1].Error, bulkResponse.Result.Results[1].Code)
+		}
+	})
+
+	t.Run("3. Bulk sign - atomic with a missing request", func(t *testing.T) {
+		params := map[string]any{"ids": []int{1, 99}, "atomic": true}
+		statusCode, bulkResponse, err := bulkRequest(ts.URL, client, adminToken, "/sign", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, statusCode)
+		}
+		expectBulkStatuses(t, bulkResponse, false, http.StatusCreated, http.StatusNotFound)
+		_, getResponse, err := getCertificateRequest(ts.URL, client, adminToken, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if getResponse.Result.Certificate != "" {
+			t.Fatalf("expected the certificate to be rolled back")
+		}
+	})
+
+	t.Run("4. Bulk sign - atomic", func(t *testing.T) {
+		params := map[string]any{"ids": []int{1, 2}, "atomic": true}
+		statusCode, bulkResponse, err := bulkRequest(ts.URL, client, adminToken, "/sign", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		expectBulkStatuses(t, bulkResponse, true, http.StatusCreated, http.StatusCreated)
+		_, getResponse, err := getCertificateRequest(ts.URL, client, adminToken, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if getResponse.Result.Certificate == "" {
+			t.Fatalf("expected a certificate to be issued")
+		}
+	})
+
+	t.Run("5. Bulk sign - already signed", func(t *testing.T) {
+		params := map[string]any{"ids": []int{2}}
+		statusCode, bulkResponse, err := bulkRequest(ts.URL, client, adminToken, "/sign", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		expectBulkStatuses(t, bulkResponse, true, http.StatusConflict)
+		if bulkResponse.Result.Results[0].Code != "already_processed" {
+			t.Fatalf("unexpected code %q", bulkResponse.Result.Results[0].Code)
+		}
+	})
+
+	t.Run("6. Bulk reject - best effort", func(t *testing.T) {
+		params := map[string]any{"ids": []int{1, 99}}
+		statusCode, bulkResponse, err := bulkRequest(ts.URL, client, adminToken, "/reject", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		expectBulkStatuses(t, bulkResponse, true, http.StatusAccepted, http.StatusNotFound)
+	})
+
+	t.Run("7. Bulk delete - atomic", func(t *testing.T) {
+		params := map[string]any{"ids": []int{1, 2}, "atomic": true}
+		statusCode, bulkResponse, err := bulkRequest(ts.URL, client, adminToken, "/delete", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		expectBulkStatuses(t, bulkResponse, true, http.StatusAccepted, http.StatusAccepted)
+		_, listResponse, err := listCertificateRequests(ts.URL, client, adminToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listResponse.Result) != 0 {
+			t.Fatalf("expected every request to be deleted")
+		}
+	})
+
+	t.Run("8. Bulk delete - no items", func(t *testing.T) {
+		statusCode, bulkResponse, err := bulkRequest(ts.URL, client, adminToken, "/delete", map[string]any{"ids": []int{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest || bulkResponse.Error != "no items were given" {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, statusCode, bulkResponse.Error)
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+type CertificateProfileParams struct {
+	Name                   string   `json:"name"`
+	ValidityDays           int      `json:"validity_days"`
+	KeyUsage               []string `json:"key_usage"`
+	ExtKeyUsage            []string `json:"ext_key_usage"`
+	IsCA                   bool     `json:"is_ca"`
+	MaxPathLen             int      `json:"max_path_len"`
+	CertificatePolicies    []string `json:"certificate_policies"`
+	CRLDistributionPoints  []string `json:"crl_distribution_points"`
+	OCSPServers            []string `json:"ocsp_servers"`
+	IssuingCertificateURLs []string `json:"issuing_certificate_urls"`
+}
+
+type GetCertificateProfileResponse struct {
+	ID                     int      `json:"id"`
+	Name                   string   `json:"name"`
+	ValidityDays           int      `json:"validity_days"`
+	KeyUsage               []string `json:"key_usage"`
+	ExtKeyUsage            []string `json:"ext_key_usage"`
+	IsCA                   bool     `json:"is_ca"`
+	MaxPathLen             int      `json:"max_path_len"`
+	CertificatePolicies    []string `json:"certificate_policies"`
+	CRLDistributionPoints  []string `json:"crl_distribution_points"`
+	OCSPServers            []string `json:"ocsp_servers"`
+	IssuingCertificateURLs []string `json:"issuing_certificate_urls"`
+}
+
+type CreateCertificateProfileResponse struct {
+	ID int `json:"id"`
+}
+
+type UpdateCertificateProfileResponse struct {
+	ID int `json:"id"`
+}
+
+type DeleteCertificateProfileResponse struct {
+	ID int `json:"id"`
+}
+
+func (p *CertificateProfileParams) toProfile() db.CertificateProfile {
+	return db.CertificateProfile{
+		Name:                   p.Name,
+		ValidityDays:           p.ValidityDays,
+		KeyUsage:               p.KeyUsage,
+		ExtKeyUsage:            p.ExtKeyUsage,
+		IsCA:                   p.IsCA,
+		MaxPathLen:             p.MaxPathLen,
+		CertificatePolicies:    p.CertificatePolicies,
+		CRLDistributionPoints:  p.CRLDistributionPoints,
+		OCSPServers:            p.OCSPServers,
+		IssuingCertificateURLs: p.IssuingCertificateURLs,
+	}
+}
+
+func newGetCertificateProfileResponse(profile db.CertificateProfile) GetCertificateProfileResponse {
+	return GetCertificateProfileResponse{
+		ID:                     profile.ID,
+		Name:                   profile.Name,
+		ValidityDays:           profile.ValidityDays,
+		KeyUsage:               profile.KeyUsage,
+		ExtKeyUsage:            profile.ExtKeyUsage,
+		IsCA:                   profile.IsCA,
+		MaxPathLen:             profile.MaxPathLen,
+		CertificatePolicies:    profile.CertificatePolicies,
+		CRLDistributionPoints:  profile.CRLDistributionPoints,
+		OCSPServers:            profile.OCSPServers,
+		IssuingCertificateURLs: profile.IssuingCertificateURLs,
+	}
+}
+
+// decodeCertificateProfileParams reads a certificate profile from the request body and writes an error response
+// if it can't be decoded.
+func decodeCertificateProfileParams(w http.ResponseWriter, r *http.Request) (db.CertificateProfile, bool) {
+	var params CertificateProfileParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeProblem(w, r, errInvalidJSON)
+		return db.CertificateProfile{}, false
+	}
+	return params.toProfile(), true
+}
+
+// ListCertificateProfiles returns all of the certificate profiles
+func ListCertificateProfiles(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profiles, err := env.DB.WithContext(r.Context()).RetrieveAllCertificateProfiles()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
+			return
+		}
+		profilesResponse := make([]GetCertificateProfileResponse, len(profiles))
+		for i, profile := range profiles {
+			profilesResponse[i] = newGetCertificateProfileResponse(profile)
+		}
+		w.WriteHeader(http.StatusOK)
+		err = writeJSON(w, profilesResponse)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+}
+
+// GetCertificateProfile receives an id as a path parameter, and
+// returns the corresponding certificate profile
+func GetCertificateProfile(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		profile, err := env.DB.WithContext(r.Context()).RetrieveCertificateProfile(id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			if errors.Is(err, db.ErrIdNotFound) {
+				writeError(w, r, http.StatusNotFound, "Not Found")
+				return
+			}
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		err = writeJSON(w, newGetCertificateProfileResponse(profile))
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+}
+
+// CreateCertificateProfile creates a new certificate profile, and returns the id of the created row
+func CreateCertificateProfile(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profile, ok := decodeCertificateProfileParams(w, r)
+		if !ok {
+			return
+		}
+		id, err := env.DB.WithContext(r.Context()).CreateCertificateProfile(profile)
+		if err != nil {
+			if errors.Is(err, db.ErrAlreadyExists) {
+				writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeAlreadyExists, "name", "profile with given name already exists"))
+				return
+			}
+			writeProblem(w, r, dbProblem(r.Context(), err, ""))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		err = writeJSON(w, CreateCertificateProfileResponse{ID: int(id)})
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+}
+
+// UpdateCertificateProfile receives an id as a path parameter,
+// and replaces the corresponding certificate profile with the one in the request body
+func UpdateCertificateProfile(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profile, ok := decodeCertificateProfileParams(w, r)
+		if !ok {
+			return
+		}
+		id, err := env.DB.WithContext(r.Context()).UpdateCertificateProfile(r.PathValue("id"), profile)
+		if err != nil {
+			if errors.Is(err, db.ErrIdNotFound) {
+				writeError(w, r, http.StatusNotFound, "Not Found")
+				return
+			}
+			if errors.Is(err, db.ErrAlreadyExists) {
+				writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeAlreadyExists, "name", "profile with given name already exists"))
+				return
+			}
+			writeProblem(w, r, dbProblem(r.Context(), err, ""))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		err = writeJSON(w, UpdateCertificateProfileResponse{ID: int(id)})
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+}
+
+// DeleteCertificateProfile receives an id as a path parameter,
+// and deletes the corresponding certificate profile if no certificate request uses it
+func DeleteCertificateProfile(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		idInt, err := strconv.Atoi(id)
+		if err != nil {
+			writeError(w, r, http.StatusNotFound, "Not Found")
+			return
+		}
+		_, err = env.DB.WithContext(r.Context()).DeleteCertificateProfile(id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			if errors.Is(err, db.ErrIdNotFound) {
+				writeError(w, r, http.StatusNotFound, "Not Found")
+				return
+			}
+			if errors.Is(err, db.ErrProfileInUse) {
+				writeProblem(w, r, dbProblem(r.Context(), err, ""))
+				return
+			}
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		err = writeJSON(w, DeleteCertificateProfileResponse{ID: idInt})
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package server_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/ca"
+)
+
+type CertificateProfile struct {
+	ID           int      `json:"id,omitempty"`
+	Name         string   `json:"name"`
+	ValidityDays int      `json:"validity_days"`
+	KeyUsage     []string `json:"key_usage"`
+	ExtKeyUsage  []string `json:"ext_key_usage"`
+	IsCA         bool     `json:"is_ca"`
+}
+
+type ListCertificateProfilesResponse struct {
+	Error  string               `json:"error,omitempty"`
+	Result []CertificateProfile `json:"result"`
+}
+
+type GetCertificateProfileResponse struct {
+	Error  string             `json:"error,omitempty"`
+	Result CertificateProfile `json:"result"`
+}
+
+type CreateCertificateProfileResponseResult struct {
+	ID int `json:"id"`
+}
+
+type CreateCertificateProfileResponse struct {
+	Error  string                                 `json:"error,omitempty"`
+	Result CreateCertificateProfileResponseResult `json:"result"`
+}
+
+type SignCertificateResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+func listCertificateProfiles(url string, client *http.Client, token string) (int, *ListCertificateProfilesResponse, error) {
+	req, err := http.NewRequest("GET", url+"/api/v1/certificate_profiles", nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	var response ListCertificateProfilesResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, &response, nil
+}
+
+func getCertificateProfile(url string, client *http.Client, token string, id int) (int, *GetCertificateProfileResponse, error) {
+	req, err := http.NewRequest("GET", url+"/api/v1/certificate_profiles/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	var response GetCertificateProfileResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, &response, nil
+}
+
+func sendCertificateProfile(url string, client *http.Client, token string, method string, path string, profile CertificateProfile) (int, *CreateCertificateProfileResponse, error) {
+	reqData, err := json.Marshal(profile)
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequest(method, url+path, bytes.NewReader(reqData))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	var response CreateCertificateProfileResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, &response, nil
+}
+
+func deleteCertificateProfile(url string, client *http.Client, token string, id int) (int, error) {
+	req, err := http.NewRequest("DELETE", url+"/api/v1/certificate_profiles/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func signCertificate(url string, client *http.Client, token string, id int) (int, *SignCertificateResponse, error) {
+	req, err := http.NewRequest("POST", url+"/api/v1/certificate_requests/"+strconv.Itoa(id)+"/certificate/sign", nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	var response SignCertificateResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, &response, nil
+}
+
+// newTestSigningCA creates a self signed CA that can be used as the signing CA of the test server.
+func newTestSigningCA(t *testing.T) *ca.CA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Notary Test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	signingCA, err := ca.Load(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	)
+	if err != nil {
+		t.Fatalf("couldn't load test CA: %s", err)
+	}
+	return signingCA
+}
+
+func TestCertificateProfilesEndToEnd(t *testing.T) {
+	ts, config, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+
+	var adminToken string
+	var nonAdminToken string
+	t.Run("prepare user accounts and tokens", prepareAccounts(ts.URL, client, &adminToken, &nonAdminToken))
+
+	var profileID int
+	var caProfileID int
+	profile := CertificateProfile{
+		Name:         "web",
+		ValidityDays: 90,
+		KeyUsage:     []string{"digital_signature"},
+		ExtKeyUsage:  []string{"server_auth"},
+	}
+
+	t.Run("1. List certificate profiles - default profiles", func(t *testing.T) {
+		statusCode, response, err := listCertificateProfiles(ts.URL, client, nonAdminToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		if len(response.Result) != 5 {
+			t.Fatalf("expected 5 default profiles, got %d", len(response.Result))
+		}
+	})
+
+	t.Run("2. Create certificate profile - forbidden for non admin", func(t *testing.T) {
+		statusCode, _, err := sendCertificateProfile(ts.URL, client, nonAdminToken, "POST", "/api/v1/certificate_profiles", profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusForbidden {
+			t.Fatalf("expected status %d, got %d", http.StatusForbidden, statusCode)
+		}
+	})
+
+	t.Run("3. Create certificate profile - success", func(t *testing.T) {
+		statusCode, response, err := sendCertificateProfile(ts.URL, client, adminToken, "POST", "/api/v1/certificate_profiles", profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, statusCode, response.Error)
+		}
+		profileID = response.Result.ID
+	})
+
+	t.Run("4. Create certificate profile - CA profile", func(t *testing.T) {
+		caProfile := CertificateProfile{Name: "sub_ca", ValidityDays: 365, KeyUsage: []string{"cert_sign"}, IsCA: true}
+		statusCode, response, err := sendCertificateProfile(ts.URL, client, adminToken, "POST", "/api/v1/certificate_profiles", caProfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, statusCode, response.Error)
+		}
+		caProfileID = response.Result.ID
+	})
+
+	t.Run("5. Create certificate profile - invalid profile", func(t *testing.T) {
+		invalidProfile := CertificateProfile{Name: "invalid", ValidityDays: 0}
+		statusCode, response, err := sendCertificateProfile(ts.URL, client, adminToken, "POST", "/api/v1/certificate_profiles", invalidProfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, statusCode)
+		}
+		if response.Error != "profile validation failed: validity must be at least 1 day" {
+			t.Fatalf("unexpected error: %q", response.Error)
+		}
+	})
+
+	t.Run("6. Update certificate profile - success", func(t *testing.T) {
+		profile.ValidityDays = 30
+		statusCode, response, err := sendCertificateProfile(ts.URL, client, adminToken, "PUT", "/api/v1/certificate_profiles/"+strconv.Itoa(profileID), profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, statusCode, response.Error)
+		}
+		statusCode, getResponse, err := getCertificateProfile(ts.URL, client, adminToken, profileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		if getResponse.Result.ValidityDays != 30 {
+			t.Fatalf("expected validity of 30 days, got %d", getResponse.Result.ValidityDays)
+		}
+	})
+
+	t.Run("7. Sign certificate request - no signing CA", func(t *testing.T) {
+		csr, err := os.ReadFile(filepath.Join("testdata", "csr1.pem"))
+		if err != nil {
+			t.Fatalf("cannot read file: %s", err)
+		}
+		params := CreateCertificateRequestParams{CSR: string(csr), ProfileID: profileID}
+		statusCode, _, err := createCertificateRequest(ts.URL, client, adminToken, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, statusCode)
+		}
+		statusCode, _, err = signCertificate(ts.URL, client, adminToken, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, statusCode)
+		}
+	})
+
+	t.Run("8. Sign certificate request - success", func(t *testing.T) {
+		config.SigningCA = newTestSigningCA(t)
+		statusCode, response, err := signCertificate(ts.URL, client, nonAdminToken, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, statusCode, response.Error)
+		}
+		statusCode, getResponse, err := getCertificateRequest(ts.URL, client, adminToken, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		block, _ := pem.Decode([]byte(getResponse.Result.Certificate))
+		if block == nil {
+			t.Fatalf("expected a certificate to be stored")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("couldn't parse the issued certificate: %s", err)
+		}
+		if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+			t.Fatalf("the profile wasn't applied to the issued certificate")
+		}
+	})
+
+	t.Run("9. Sign certificate request - already signed", func(t *testing.T) {
+		statusCode, response, err := signCertificate(ts.URL, client, adminToken, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusConflict {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusConflict, statusCode, response.Error)
+		}
+	})
+
+	t.Run("10. Sign certificate request - CA profiles not allowed", func(t *testing.T) {
+		csr, err := os.ReadFile(filepath.Join("testdata", "csr2.pem"))
+		if err != nil {
+			t.Fatalf("cannot read file: %s", err)
+		}
+		params := CreateCertificateRequestParams{CSR: string(csr), ProfileID: caProfileID}
+		statusCode, _, err := createCertificateRequest(ts.URL, client, adminToken, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, statusCode)
+		}
+		statusCode, response, err := signCertificate(ts.URL, client, adminToken, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest || response.Error != "CA profiles are not allowed" {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, statusCode, response.Error)
+		}
+	})
+
+	t.Run("11. Delete certificate profile - in use", func(t *testing.T) {
+		statusCode, err := deleteCertificateProfile(ts.URL, client, adminToken, profileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusConflict {
+			t.Fatalf("expected status %d, got %d", http.StatusConflict, statusCode)
+		}
+	})
+
+	t.Run("12. Delete certificate profile - success", func(t *testing.T) {
+		statusCode, err := deleteCertificateProfile(ts.URL, client, adminToken, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusAccepted {
+			t.Fatalf("expected status %d, got %d", http.StatusAccepted, statusCode)
+		}
+		statusCode, _, err = getCertificateProfile(ts.URL, client, adminToken, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusNotFound {
+			t.Fatalf("expected status %d, got %d", http.StatusNotFound, statusCode)
+		}
+	})
+}
@@ -1,34 +1,55 @@
 package server
 
 import (
+	"context"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
-	"strings"
 
+	"github.com/canonical/notary/internal/ca"
 	"github.com/canonical/notary/internal/db"
+	"github.com/canonical/notary/internal/export"
 )
 
 type CreateCertificateRequestParams struct {
-	CSR string `json:"csr"`
+	CSR       string `json:"csr"`
+	ProfileID int    `json:"profile_id,omitempty"`
 }
 
 type CreateCertificateParams struct {
 	Certificate string `json:"certificate"`
 }
 
+type RenewCertificateRequestParams struct {
+	CSR string `json:"csr"`
+}
+
+type SignCertificateRequestParams struct {
+	ProfileID int `json:"profile_id,omitempty"`
+}
+
 type GetCertificateRequestResponse struct {
-	ID          int    `json:"id"`
-	CSR         string `json:"csr"`
-	Certificate string `json:"certificate"`
+	ID            int    `json:"id"`
+	CSR           string `json:"csr"`
+	Certificate   string `json:"certificate"`
+	Fingerprint   string `json:"fingerprint,omitempty"`
+	ProfileID     int    `json:"profile_id,omitempty"`
+	PredecessorID int    `json:"predecessor_id,omitempty"`
+	SuccessorID   int    `json:"successor_id,omitempty"`
 }
 
 type CreateCertificateRequestResponse struct {
 	ID int `json:"id"`
 }
 
+type RenewCertificateRequestResponse struct {
+	ID int `json:"id"`
+}
+
 type DeleteCertificateRequestResponse struct {
 	ID int `json:"id"`
 }
@@ -49,27 +70,39 @@ type RejectCertificateResponse struct {
 	ID int `json:"id"`
 }
 
+type SignCertificateResponse struct {
+	ID int `json:"id"`
+}
+
+func newGetCertificateRequestResponse(csr db.CertificateRequest) GetCertificateRequestResponse {
+	return GetCertificateRequestResponse{
+		ID:            csr.ID,
+		CSR:           csr.CSR,
+		Certificate:   csr.Certificate,
+		Fingerprint:   csr.Fingerprint,
+		ProfileID:     csr.ProfileID,
+		PredecessorID: csr.PredecessorID,
+		SuccessorID:   csr.SuccessorID,
+	}
+}
+
 // ListCertificateRequests returns all of the Certificate Requests
 func ListCertificateRequests(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		certs, err := env.DB.RetrieveAllCSRs()
+		certs, err := env.DB.WithContext(r.Context()).RetrieveAllCSRs()
 		if err != nil {
-			log.Println(err)
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
 		certificateRequestsResponse := make([]GetCertificateRequestResponse, len(certs))
 		for i, cert := range certs {
-			certificateRequestsResponse[i] = GetCertificateRequestResponse{
-				ID:          cert.ID,
-				CSR:         cert.CSR,
-				Certificate: cert.Certificate,
-			}
+			certificateRequestsResponse[i] = newGetCertificateRequestResponse(cert)
 		}
 		w.WriteHeader(http.StatusOK)
 		err = writeJSON(w, certificateRequestsResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
@@ -80,127 +113,182 @@ func CreateCertificateRequest(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var createCertificateRequestParams CreateCertificateRequestParams
 		if err := json.NewDecoder(r.Body).Decode(&createCertificateRequestParams); err != nil {
-			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			writeProblem(w, r, errInvalidJSON)
 			return
 		}
-		if createCertificateRequestParams.CSR == "" {
-			writeError(w, http.StatusBadRequest, "csr is missing")
-			return
-		}
-		id, err := env.DB.CreateCSR(createCertificateRequestParams.CSR)
-		if err != nil {
-			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-				writeError(w, http.StatusBadRequest, "given csr already recorded")
-				return
-			}
-			if strings.Contains(err.Error(), "csr validation failed") {
-				log.Println(err)
-				writeError(w, http.StatusBadRequest, "csr validation failed")
-				return
-			}
-			log.Println(err)
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+		id, p := createCSR(r.Context(), accountDB(env, r), createCertificateRequestParams)
+		if p != nil {
+			writeProblem(w, r, p)
 			return
 		}
 		certificateRequestResponse := CreateCertificateRequestResponse{
 			ID: int(id),
 		}
 		w.WriteHeader(http.StatusCreated)
-		err = writeJSON(w, certificateRequestResponse)
+		err := writeJSON(w, certificateRequestResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
 }
 
+// createCSR creates a certificate request in the given database and returns its id.
+// On failure, it returns the problem to report to the client.
+func createCSR(ctx context.Context, database *db.Database, params CreateCertificateRequestParams) (int64, *problem) {
+	if params.CSR == "" {
+		return 0, fieldProblem(http.StatusBadRequest, codeMissingField, "csr", "csr is missing")
+	}
+	id, err := database.CreateCSRWithProfile(params.CSR, params.ProfileID)
+	if err != nil {
+		if errors.Is(err, db.ErrAlreadyExists) {
+			return 0, fieldProblem(http.StatusBadRequest, codeAlreadyExists, "csr", "given csr already recorded")
+		}
+		return 0, dbProblem(ctx, err, "")
+	}
+	return id, nil
+}
+
+// accountDB returns the database bound to the context of the request and to the account that sent it, so that
+// the certificate requests created with it count against the quota of the account.
+func accountDB(env *HandlerConfig, r *http.Request) *db.Database {
+	database := env.DB.WithContext(r.Context())
+	if claims, err := getClaims(r, env.JWTSecret); err == nil {
+		return database.ForAccount(claims.ID)
+	}
+	return database
+}
+
 // GetCertificateRequest receives an id as a path parameter, and
 // returns the corresponding Certificate Request
 func GetCertificateRequest(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
-		cert, err := env.DB.RetrieveCSR(id)
+		cert, err := env.DB.WithContext(r.Context()).RetrieveCSR(id)
 		if err != nil {
-			log.Println(err)
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
 			if errors.Is(err, db.ErrIdNotFound) {
-				writeError(w, http.StatusNotFound, "Not Found")
+				writeError(w, r, http.StatusNotFound, "Not Found")
 				return
 			}
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
-		certificateRequestResponse := GetCertificateRequestResponse{
-			ID:          cert.ID,
-			CSR:         cert.CSR,
-			Certificate: cert.Certificate,
-		}
+		certificateRequestResponse := newGetCertificateRequestResponse(cert)
 		w.WriteHeader(http.StatusOK)
 		err = writeJSON(w, certificateRequestResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
 }
 
-// DeleteCertificateRequest handler receives an id as a path parameter,
-// deletes the corresponding Certificate Request, and returns a http.StatusNoContent on success
-func DeleteCertificateRequest(env *HandlerConfig) http.HandlerFunc {
+// RenewCertificateRequest handler receives an id as a path parameter, and creates a certificate request
+// that renews the corresponding one. The renewal uses the CSR in the request body, or reuses the CSR
+// of the renewed request if none is given and the CSR policy allows key reuse.
+func RenewCertificateRequest(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		id := r.PathValue("id")
-		insertId, err := env.DB.DeleteCSR(id)
+		var renewParams RenewCertificateRequestParams
+		if err := json.NewDecoder(r.Body).Decode(&renewParams); err != nil && !errors.Is(err, io.EOF) {
+			writeProblem(w, r, errInvalidJSON)
+			return
+		}
+		id, err := accountDB(env, r).RenewCSR(r.PathValue("id"), renewParams.CSR)
 		if err != nil {
-			log.Println(err)
-			if errors.Is(err, db.ErrIdNotFound) {
-				writeError(w, http.StatusNotFound, "Not Found")
+			writeProblem(w, r, dbProblem(r.Context(), err, ""))
+			return
+		}
+		renewResponse := RenewCertificateRequestResponse{
+			ID: int(id),
+		}
+		w.WriteHeader(http.StatusCreated)
+		err = writeJSON(w, renewResponse)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+}
+
+// GetCurrentCertificateRequest receives an id as a path parameter, and returns the most recent
+// certificate request with an issued certificate in the renewal lineage of the corresponding request
+func GetCurrentCertificateRequest(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		csr, err := env.DB.WithContext(r.Context()).RetrieveCurrentCSR(r.PathValue("id"))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			if errors.Is(err, db.ErrIdNotFound) || errors.Is(err, db.ErrNotIssued) {
+				writeError(w, r, http.StatusNotFound, "Not Found")
 				return
 			}
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		err = writeJSON(w, newGetCertificateRequestResponse(csr))
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+}
+
+// DeleteCertificateRequest handler receives an id as a path parameter,
+// deletes the corresponding Certificate Request, and returns a http.StatusNoContent on success
+func DeleteCertificateRequest(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		insertId, p := deleteCSR(r.Context(), env.DB.WithContext(r.Context()), r.PathValue("id"))
+		if p != nil {
+			writeProblem(w, r, p)
 			return
 		}
 		certificateRequestResponse := DeleteCertificateRequestResponse{
 			ID: int(insertId),
 		}
 		w.WriteHeader(http.StatusAccepted)
-		err = writeJSON(w, certificateRequestResponse)
+		err := writeJSON(w, certificateRequestResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
 }
 
+// deleteCSR deletes the certificate request with the given id from the given database.
+// On failure, it returns the problem to report to the client.
+func deleteCSR(ctx context.Context, database *db.Database, id string) (int64, *problem) {
+	insertId, err := database.DeleteCSR(id)
+	if err != nil {
+		return 0, dbProblem(ctx, err, "")
+	}
+	return insertId, nil
+}
+
 // CreateCertificate handler receives an id as a path parameter,
 // and attempts to add a given certificate to the corresponding certificate request
 func CreateCertificate(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var createCertificateParams CreateCertificateParams
 		if err := json.NewDecoder(r.Body).Decode(&createCertificateParams); err != nil {
-			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			writeProblem(w, r, errInvalidJSON)
 			return
 		}
 		if createCertificateParams.Certificate == "" {
-			writeError(w, http.StatusBadRequest, "certificate is missing")
+			writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeMissingField, "certificate", "certificate is missing"))
 			return
 		}
 		id := r.PathValue("id")
-		insertId, err := env.DB.UpdateCSR(id, createCertificateParams.Certificate)
+		insertId, err := env.DB.WithContext(r.Context()).UpdateCSR(id, createCertificateParams.Certificate)
 		if err != nil {
-			log.Println(err)
-			if errors.Is(err, db.ErrIdNotFound) ||
-				err.Error() == "certificate does not match CSR" ||
-				strings.Contains(err.Error(), "cert validation failed") {
-				writeError(w, http.StatusBadRequest, "Bad Request")
-				return
-			}
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			writeProblem(w, r, dbProblem(r.Context(), err, "certificate"))
 			return
 		}
 		insertIdStr := strconv.FormatInt(insertId, 10)
-		if env.SendPebbleNotifications {
-			err := SendPebbleNotification("canonical.com/notary/certificate/update", insertIdStr)
+		if env.pebbleNotifications() {
+			err := SendPebbleNotification(r.Context(), "canonical.com/notary/certificate/update", insertIdStr)
 			if err != nil {
-				log.Printf("pebble notify failed: %s. continuing silently.", err.Error())
+				slog.WarnContext(r.Context(), "Pebble notification failed, continuing silently", "error", err)
 			}
 		}
 		certificateResponse := CreateCertificateResponse{
@@ -209,7 +297,7 @@ func CreateCertificate(env *HandlerConfig) http.HandlerFunc {
 		w.WriteHeader(http.StatusCreated)
 		err = writeJSON(w, certificateResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
@@ -217,56 +305,49 @@ func CreateCertificate(env *HandlerConfig) http.HandlerFunc {
 
 func RejectCertificate(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		id := r.PathValue("id")
-		insertId, err := env.DB.UpdateCSR(id, "rejected")
-		if err != nil {
-			log.Println(err)
-			if errors.Is(err, db.ErrIdNotFound) {
-				writeError(w, http.StatusNotFound, "Not Found")
-				return
-			}
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+		insertId, p := rejectCSR(r.Context(), env.DB.WithContext(r.Context()), r.PathValue("id"))
+		if p != nil {
+			writeProblem(w, r, p)
 			return
 		}
-		insertIdStr := strconv.FormatInt(insertId, 10)
-		if env.SendPebbleNotifications {
-			err := SendPebbleNotification("canonical.com/notary/certificate/update", insertIdStr)
-			if err != nil {
-				log.Printf("pebble notify failed: %s. continuing silently.", err.Error())
-			}
-		}
+		notifyCertificateUpdate(r.Context(), env, insertId)
 		certificateResponse := RejectCertificateResponse{
 			ID: int(insertId),
 		}
 		w.WriteHeader(http.StatusAccepted)
-		err = writeJSON(w, certificateResponse)
+		err := writeJSON(w, certificateResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
 }
 
+// rejectCSR rejects the certificate request with the given id in the given database.
+// On failure, it returns the problem to report to the client.
+func rejectCSR(ctx context.Context, database *db.Database, id string) (int64, *problem) {
+	insertId, err := database.UpdateCSR(id, "rejected")
+	if err != nil {
+		return 0, dbProblem(ctx, err, "")
+	}
+	return insertId, nil
+}
+
 // DeleteCertificate handler receives an id as a path parameter,
 // and attempts to add a given certificate to the corresponding certificate request
 func DeleteCertificate(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
-		insertId, err := env.DB.UpdateCSR(id, "")
+		insertId, err := env.DB.WithContext(r.Context()).UpdateCSR(id, "")
 		if err != nil {
-			log.Println(err)
-			if errors.Is(err, db.ErrIdNotFound) {
-				writeError(w, http.StatusBadRequest, "Bad Request")
-				return
-			}
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			writeProblem(w, r, dbProblem(r.Context(), err, ""))
 			return
 		}
 		insertIdStr := strconv.FormatInt(insertId, 10)
-		if env.SendPebbleNotifications {
-			err := SendPebbleNotification("canonical.com/notary/certificate/update", insertIdStr)
+		if env.pebbleNotifications() {
+			err := SendPebbleNotification(r.Context(), "canonical.com/notary/certificate/update", insertIdStr)
 			if err != nil {
-				log.Printf("pebble notify failed: %s. continuing silently.", err.Error())
+				slog.WarnContext(r.Context(), "Pebble notification failed, continuing silently", "error", err)
 			}
 		}
 		certificateResponse := DeleteCertificateResponse{
@@ -275,8 +356,199 @@ func DeleteCertificate(env *HandlerConfig) http.HandlerFunc {
 		w.WriteHeader(http.StatusOK)
 		err = writeJSON(w, certificateResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+}
+
+// SignCertificateRequest handler receives an id as a path parameter, signs the corresponding certificate request
+// with the configured signing CA, and stores the issued certificate.
+// The certificate profile given in the request body is used if any, otherwise the profile selected for the request is used.
+func SignCertificateRequest(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var signParams SignCertificateRequestParams
+		if err := json.NewDecoder(r.Body).Decode(&signParams); err != nil && !errors.Is(err, io.EOF) {
+			writeProblem(w, r, errInvalidJSON)
+			return
+		}
+		insertId, p := signCSR(r.Context(), env, env.DB.WithContext(r.Context()), r.PathValue("id"), signParams.ProfileID)
+		if p != nil {
+			writeProblem(w, r, p)
+			return
+		}
+		notifyCertificateUpdate(r.Context(), env, insertId)
+		certificateResponse := SignCertificateResponse{
+			ID: int(insertId),
+		}
+		w.WriteHeader(http.StatusCreated)
+		err := writeJSON(w, certificateResponse)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+}
+
+// signCSR signs the certificate request with the given id with the signing CA, and stores the issued certificate
+// in the given database. The given certificate profile is used, or the one selected for the request if it is 0.
+// On failure, it returns the problem to report to the client.
+func signCSR(ctx context.Context, env *HandlerConfig, database *db.Database, id string, profileID int) (int64, *problem) {
+	signingCA := env.signingCA()
+	if signingCA == nil {
+		return 0, errNoSigningCA
+	}
+	csr, err := database.RetrieveCSR(id)
+	if err != nil {
+		return 0, dbProblem(ctx, err, "")
+	}
+	if csr.CSR == "" {
+		return 0, dbProblem(ctx, db.ErrImported, "")
+	}
+	if csr.Certificate != "" {
+		return 0, errAlreadyDone
+	}
+	if profileID == 0 {
+		profileID = csr.ProfileID
+	}
+	if profileID == 0 {
+		return 0, fieldProblem(http.StatusBadRequest, codeProfileRequired, "profile_id", "no certificate profile selected")
+	}
+	profile, err := database.RetrieveCertificateProfile(strconv.Itoa(profileID))
+	if err != nil {
+		if errors.Is(err, db.ErrIdNotFound) {
+			return 0, dbProblem(ctx, db.ErrProfileNotFound, "")
+		}
+		return 0, dbProblem(ctx, err, "")
+	}
+	certificate, err := signingCA.Sign(csr.CSR, profile)
+	if errors.Is(err, ca.ErrCAProfile) {
+		return 0, errCAProfile
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Request failed", "error", err)
+		return 0, errInternalError
+	}
+	insertId, err := database.UpdateCSR(id, certificate)
+	if err != nil {
+		return 0, dbProblem(ctx, err, "")
+	}
+	return insertId, nil
+}
+
+// notifyCertificateUpdate sends a pebble notification about the certificate of the given request if they are enabled.
+func notifyCertificateUpdate(ctx context.Context, env *HandlerConfig, id int64) {
+	if !env.pebbleNotifications() {
+		return
+	}
+	err := SendPebbleNotification(ctx, "canonical.com/notary/certificate/update", strconv.FormatInt(id, 10))
+	if err != nil {
+		slog.WarnContext(ctx, "Pebble notification failed, continuing silently", "error", err)
+	}
+}
+
+// DownloadCertificate handler receives an id as a path parameter, and returns the certificate issued for the
+// corresponding certificate request as a file. The format query parameter selects the encoding (pem, der or p7b,
+// defaulting to pem) and the chain query parameter selects which certificates of the bundle are returned
+// (leaf, chain, fullchain or root, defaulting to fullchain, or to leaf for der).
+func DownloadCertificate(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = export.FormatPEM
+		}
+		chain := r.URL.Query().Get("chain")
+		if chain == "" {
+			chain = export.ChainFull
+			if format == export.FormatDER {
+				chain = export.ChainLeaf
+			}
+		}
+		id := r.PathValue("id")
+		certs, ok := retrieveIssuedCertificates(env, w, r, id)
+		if !ok {
+			return
+		}
+		selected, err := export.SelectChain(certs, chain)
+		if err != nil {
+			if errors.Is(err, export.ErrNoRoot) || errors.Is(err, export.ErrNoIssuers) {
+				writeProblem(w, r, newProblem(http.StatusNotFound, codeNoIssuers, err.Error()))
+				return
+			}
+			writeProblem(w, r, newProblem(http.StatusBadRequest, codeInvalidFormat, err.Error()))
+			return
+		}
+		data, err := export.Encode(selected, format)
+		if err != nil {
+			writeProblem(w, r, newProblem(http.StatusBadRequest, codeInvalidFormat, err.Error()))
+			return
+		}
+		writeFile(w, r, "certificate-"+id, format, data)
+	}
+}
+
+// TrustStorePasswordHeader is the header that holds the password of a downloaded truststore. It isn't a query
+// parameter so that the password doesn't end up in access logs and browser history.
+const TrustStorePasswordHeader = "X-Truststore-Password"
+
+// DownloadTrustStore handler receives an id as a path parameter, and returns a truststore holding the CA chain
+// that issued the certificate of the corresponding certificate request. The format query parameter selects
+// the truststore type (p12 or jks, defaulting to p12) and the X-Truststore-Password header sets its password,
+// defaulting to "changeit".
+func DownloadTrustStore(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = export.FormatPKCS12
+		}
+		if r.URL.Query().Has("password") {
+			writeError(w, r, http.StatusBadRequest, "the truststore password must be given in the "+TrustStorePasswordHeader+" header")
+			return
+		}
+		password := export.DefaultTrustStorePassword
+		if values := r.Header.Values(TrustStorePasswordHeader); len(values) > 0 {
+			password = values[0]
+		}
+		id := r.PathValue("id")
+		certs, ok := retrieveIssuedCertificates(env, w, r, id)
+		if !ok {
+			return
+		}
+		if len(certs) < 2 {
+			writeProblem(w, r, newProblem(http.StatusNotFound, codeNoIssuers, export.ErrNoIssuers.Error()))
+			return
+		}
+		data, err := export.TrustStore(certs[1:], format, password)
+		if err != nil {
+			writeProblem(w, r, newProblem(http.StatusBadRequest, codeInvalidFormat, err.Error()))
 			return
 		}
+		writeFile(w, r, "truststore-"+id, format, data)
+	}
+}
+
+// retrieveIssuedCertificates returns the parsed certificate bundle issued for the certificate request with the given id.
+// If there is none, it writes the error response and returns false.
+func retrieveIssuedCertificates(env *HandlerConfig, w http.ResponseWriter, r *http.Request, id string) ([]*x509.Certificate, bool) {
+	csr, err := env.DB.WithContext(r.Context()).RetrieveCSR(id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Request failed", "error", err)
+		if errors.Is(err, db.ErrIdNotFound) {
+			writeError(w, r, http.StatusNotFound, "Not Found")
+			return nil, false
+		}
+		writeError(w, r, http.StatusInternalServerError, "Internal Error")
+		return nil, false
+	}
+	if csr.Certificate == "" || csr.Certificate == "rejected" {
+		writeProblem(w, r, newProblem(http.StatusNotFound, codeNotIssued, "certificate has not been issued"))
+		return nil, false
+	}
+	certs, err := export.ParseBundle(csr.Certificate)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Request failed", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Error")
+		return nil, false
 	}
+	return certs, true
 }
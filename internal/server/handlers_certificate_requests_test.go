@@ -2,19 +2,32 @@ package server_test
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"testing"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
 )
 
 type CertificateRequest struct {
-	ID          int    `json:"id"`
-	CSR         string `json:"csr"`
-	Certificate string `json:"certificate"`
+	ID            int    `json:"id"`
+	CSR           string `json:"csr"`
+	Certificate   string `json:"certificate"`
+	Fingerprint   string `json:"fingerprint"`
+	ProfileID     int    `json:"profile_id"`
+	PredecessorID int    `json:"predecessor_id"`
+	SuccessorID   int    `json:"successor_id"`
 }
 
 type GetCertificateRequestResponse struct {
@@ -33,7 +46,8 @@ type CreateCertificateRequestResponse struct {
 }
 
 type CreateCertificateRequestParams struct {
-	CSR string `json:"csr"`
+	CSR       string `json:"csr"`
+	ProfileID int    `json:"profile_id,omitempty"`
 }
 
 type CreateCertificateParams struct {
@@ -536,3 +550,387 @@ func TestCertificatesEndToEnd(t *testing.T) {
 		}
 	})
 }
+
+type RenewCertificateRequestParams struct {
+	CSR string `json:"csr,omitempty"`
+}
+
+func renewCertificateRequest(url string, client *http.Client, adminToken string, id int, params RenewCertificateRequestParams) (int, *CreateCertificateRequestResponse, error) {
+	reqData, err := json.Marshal(params)
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequest("POST", url+"/api/v1/certificate_requests/"+strconv.Itoa(id)+"/renew", bytes.NewReader(reqData))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	var renewResponse CreateCertificateRequestResponse
+	if err := json.NewDecoder(res.Body).Decode(&renewResponse); err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, &renewResponse, nil
+}
+
+func getCurrentCertificateRequest(url string, client *http.Client, adminToken string, id int) (int, *GetCertificateRequestResponse, error) {
+	req, err := http.NewRequest("GET", url+"/api/v1/certificate_requests/"+strconv.Itoa(id)+"/current", nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	var getCertificateRequestResponse GetCertificateRequestResponse
+	if err := json.NewDecoder(res.Body).Decode(&getCertificateRequestResponse); err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, &getCertificateRequestResponse, nil
+}
+
+// newTestCSR generates a PEM encoded CSR for the given common name with a fresh key.
+func newTestCSR(t *testing.T, commonName string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate key: %s", err)
+	}
+	template := x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	if err != nil {
+		t.Fatalf("couldn't create csr: %s", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+// This is an end-to-end test for the renewal of certificate requests.
+// The order of the tests is important, as some tests depend on the
+// state of the server after previous tests.
+func TestCertificateRenewalEndToEnd(t *testing.T) {
+	ts, config, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+	config.SigningCA = newTestSigningCA(t)
+
+	var adminToken string
+	var nonAdminToken string
+	t.Run("prepare user accounts and tokens", prepareAccounts(ts.URL, client, &adminToken, &nonAdminToken))
+
+	t.Run("1. Renew certificate request - not issued yet", func(t *testing.T) {
+		params := CreateCertificateRequestParams{CSR: newTestCSR(t, "renew.example.com"), ProfileID: 1}
+		statusCode, _, err := createCertificateRequest(ts.URL, client, adminToken, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, statusCode)
+		}
+		statusCode, _, err = renewCertificateRequest(ts.URL, client, adminToken, 1, RenewCertificateRequestParams{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, statusCode)
+		}
+	})
+
+	t.Run("2. Renew certificate request - key reuse not allowed", func(t *testing.T) {
+		statusCode, _, err := signCertificate(ts.URL, client, adminToken, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, statusCode)
+		}
+		statusCode, renewResponse, err := renewCertificateRequest(ts.URL, client, adminToken, 1, RenewCertificateRequestParams{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, statusCode)
+		}
+		if renewResponse.Error != "csr validation failed: reusing the key of the renewed request is not allowed" {
+			t.Fatalf("unexpected error: %s", renewResponse.Error)
+		}
+	})
+
+	t.Run("3. Renew certificate request - subject mismatch", func(t *testing.T) {
+		params := RenewCertificateRequestParams{CSR: newTestCSR(t, "other.example.com")}
+		statusCode, _, err := renewCertificateRequest(ts.URL, client, adminToken, 1, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, statusCode)
+		}
+	})
+
+	t.Run("4. Renew certificate request - success", func(t *testing.T) {
+		params := RenewCertificateRequestParams{CSR: newTestCSR(t, "renew.example.com")}
+		statusCode, renewResponse, err := renewCertificateRequest(ts.URL, client, nonAdminToken, 1, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, statusCode, renewResponse.Error)
+		}
+		statusCode, getResponse, err := getCertificateRequest(ts.URL, client, adminToken, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		if getResponse.Result.PredecessorID != 1 || getResponse.Result.ProfileID != 1 {
+			t.Fatalf("expected renewal to link to request 1 and carry over its profile, got %+v", getResponse.Result)
+		}
+		_, getResponse, _ = getCertificateRequest(ts.URL, client, adminToken, 1)
+		if getResponse.Result.SuccessorID != 2 {
+			t.Fatalf("expected request 1 to link to its successor, got %d", getResponse.Result.SuccessorID)
+		}
+	})
+
+	t.Run("5. Renew certificate request - already renewed", func(t *testing.T) {
+		params := RenewCertificateRequestParams{CSR: newTestCSR(t, "renew.example.com")}
+		statusCode, _, err := renewCertificateRequest(ts.URL, client, adminToken, 1, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusConflict {
+			t.Fatalf("expected status %d, got %d", http.StatusConflict, statusCode)
+		}
+	})
+
+	t.Run("6. Get current certificate - renewal pending", func(t *testing.T) {
+		statusCode, getResponse, err := getCurrentCertificateRequest(ts.URL, client, adminToken, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		if getResponse.Result.ID != 1 {
+			t.Fatalf("expected the current certificate to be the one of request 1, got %d", getResponse.Result.ID)
+		}
+	})
+
+	t.Run("7. Get current certificate - renewal issued", func(t *testing.T) {
+		statusCode, _, err := signCertificate(ts.URL, client, adminToken, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, statusCode)
+		}
+		statusCode, getResponse, err := getCurrentCertificateRequest(ts.URL, client, adminToken, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		if getResponse.Result.ID != 2 || getResponse.Result.Certificate == "" {
+			t.Fatalf("expected the current certificate to be the one of request 2, got %d", getResponse.Result.ID)
+		}
+	})
+}
+
+func downloadFile(url string, client *http.Client, adminToken string, id int, kind string, query string) (int, http.Header, []byte, error) {
+	req, err := http.NewRequest("GET", url+"/api/v1/certificate_requests/"+strconv.Itoa(id)+"/certificate/"+kind+"?"+query, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return res.StatusCode, res.Header, body, nil
+}
+
+func downloadTrustStore(url string, client *http.Client, adminToken string, id int, query string, password string) (int, http.Header, []byte, error) {
+	req, err := http.NewRequest("GET", url+"/api/v1/certificate_requests/"+strconv.Itoa(id)+"/certificate/truststore?"+query, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("X-Truststore-Password", password)
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return res.StatusCode, res.Header, body, nil
+}
+
+func TestCertificateDownloadEndToEnd(t *testing.T) {
+	ts, config, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+	config.SigningCA = newTestSigningCA(t)
+
+	var adminToken string
+	var nonAdminToken string
+	t.Run("prepare user accounts and tokens", prepareAccounts(ts.URL, client, &adminToken, &nonAdminToken))
+
+	t.Run("1. Download certificate - not issued yet", func(t *testing.T) {
+		params := CreateCertificateRequestParams{CSR: newTestCSR(t, "download.example.com"), ProfileID: 1}
+		statusCode, _, err := createCertificateRequest(ts.URL, client, adminToken, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, statusCode)
+		}
+		statusCode, _, _, err = downloadFile(ts.URL, client, adminToken, 1, "download", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusNotFound {
+			t.Fatalf("expected status %d, got %d", http.StatusNotFound, statusCode)
+		}
+	})
+
+	t.Run("2. Download certificate - default pem full chain", func(t *testing.T) {
+		statusCode, _, err := signCertificate(ts.URL, client, adminToken, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, statusCode)
+		}
+		statusCode, header, body, err := downloadFile(ts.URL, client, nonAdminToken, 1, "download", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		if header.Get("Content-Type") != "application/x-pem-file" {
+			t.Fatalf("unexpected content type: %s", header.Get("Content-Type"))
+		}
+		if header.Get("Content-Disposition") != `attachment; filename=certificate-1.pem` {
+			t.Fatalf("unexpected content disposition: %s", header.Get("Content-Disposition"))
+		}
+		block, rest := pem.Decode(body)
+		if block == nil || len(bytes.TrimSpace(rest)) != 0 {
+			t.Fatalf("expected the full chain to only hold the leaf certificate, since the signing CA is a root")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.Subject.CommonName != "download.example.com" {
+			t.Fatalf("unexpected certificate: %s", cert.Subject)
+		}
+	})
+
+	t.Run("3. Download certificate - der root", func(t *testing.T) {
+		statusCode, header, body, err := downloadFile(ts.URL, client, adminToken, 1, "download", "format=der&chain=root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		if header.Get("Content-Type") != "application/pkix-cert" {
+			t.Fatalf("unexpected content type: %s", header.Get("Content-Type"))
+		}
+		cert, err := x509.ParseCertificate(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cert.Equal(config.SigningCA.Certificate) {
+			t.Fatalf("expected the signing CA certificate, got %s", cert.Subject)
+		}
+	})
+
+	t.Run("4. Download certificate - p7b", func(t *testing.T) {
+		statusCode, header, _, err := downloadFile(ts.URL, client, adminToken, 1, "download", "format=p7b&chain=leaf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		if header.Get("Content-Type") != "application/x-pkcs7-certificates" {
+			t.Fatalf("unexpected content type: %s", header.Get("Content-Type"))
+		}
+	})
+
+	t.Run("5. Download certificate - bad selections", func(t *testing.T) {
+		cases := []struct {
+			query  string
+			status int
+		}{
+			{"format=crt", http.StatusBadRequest},
+			{"chain=everything", http.StatusBadRequest},
+			{"chain=chain", http.StatusNotFound},
+		}
+		for _, tc := range cases {
+			statusCode, _, _, err := downloadFile(ts.URL, client, adminToken, 1, "download", tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if statusCode != tc.status {
+				t.Fatalf("%s: expected status %d, got %d", tc.query, tc.status, statusCode)
+			}
+		}
+	})
+
+	t.Run("6. Download truststore", func(t *testing.T) {
+		statusCode, header, body, err := downloadTrustStore(ts.URL, client, adminToken, 1, "format=jks", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		if header.Get("Content-Type") != "application/x-java-keystore" {
+			t.Fatalf("unexpected content type: %s", header.Get("Content-Type"))
+		}
+		if header.Get("Content-Disposition") != `attachment; filename=truststore-1.jks` {
+			t.Fatalf("unexpected content disposition: %s", header.Get("Content-Disposition"))
+		}
+		ks := keystore.New()
+		if err := ks.Load(bytes.NewReader(body), []byte("secret")); err != nil {
+			t.Fatalf("expected a truststore protected by the given password: %s", err)
+		}
+		statusCode, _, _, err = downloadFile(ts.URL, client, adminToken, 1, "truststore", "format=jks&password=secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected a password in the query to be refused, got status %d", statusCode)
+		}
+		statusCode, _, _, err = downloadFile(ts.URL, client, adminToken, 1, "truststore", "format=pem")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, statusCode)
+		}
+	})
+}
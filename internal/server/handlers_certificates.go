@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+// Statuses of a certificate in an import.
+const (
+	ImportStatusImported  = "imported"
+	ImportStatusDuplicate = "duplicate"
+	ImportStatusInvalid   = "invalid"
+)
+
+type ImportCertificatesParams struct {
+	Certificates string `json:"certificates"`
+}
+
+// ImportCertificateResult is the outcome of the import of a certificate. Invalid certificates have the error
+// they failed validation with, and its code.
+type ImportCertificateResult struct {
+	ID     int    `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// ImportCertificates handler receives PEM data holding one or more certificates that were issued outside of Notary,
+// each optionally followed by its issuers, and records them so that they are listed and monitored.
+// It returns the outcome for every certificate, in order. Certificates that are already known are not imported again.
+func ImportCertificates(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var importParams ImportCertificatesParams
+		if err := json.NewDecoder(r.Body).Decode(&importParams); err != nil {
+			writeProblem(w, r, errInvalidJSON)
+			return
+		}
+		bundles := db.SplitCertificateBundles(importParams.Certificates)
+		if len(bundles) == 0 {
+			writeError(w, r, http.StatusBadRequest, "no certificates were found")
+			return
+		}
+		results := make([]ImportCertificateResult, len(bundles))
+		for i, bundle := range bundles {
+			result, err := importCertificate(env.DB.WithContext(r.Context()), bundle)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Request failed", "error", err)
+				writeError(w, r, http.StatusInternalServerError, "Internal Error")
+				return
+			}
+			results[i] = result
+		}
+		w.WriteHeader(http.StatusOK)
+		err := writeJSON(w, results)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+}
+
+// importCertificate imports a single certificate bundle and describes the outcome.
+// Certificates that fail validation are reported in the result, other failures are returned.
+func importCertificate(database *db.Database, bundle string) (ImportCertificateResult, error) {
+	id, created, err := database.ImportCertificate(bundle)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidChain) {
+			return ImportCertificateResult{Status: ImportStatusInvalid, Error: err.Error(), Code: codeInvalidChain}, nil
+		}
+		if errors.Is(err, db.ErrInvalidCertificate) {
+			return ImportCertificateResult{Status: ImportStatusInvalid, Error: err.Error(), Code: codeInvalidCert}, nil
+		}
+		return ImportCertificateResult{}, err
+	}
+	if !created {
+		return ImportCertificateResult{ID: int(id), Status: ImportStatusDuplicate}, nil
+	}
+	return ImportCertificateResult{ID: int(id), Status: ImportStatusImported}, nil
+}
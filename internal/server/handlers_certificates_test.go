@@ -0,0 +1,127 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+type ImportCertificatesParams struct {
+	Certificates string `json:"certificates"`
+}
+
+type ImportCertificateResult struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+type ImportCertificatesResponse struct {
+	Error  string                    `json:"error,omitempty"`
+	Result []ImportCertificateResult `json:"result"`
+}
+
+func importCertificates(url string, client *http.Client, token string, params ImportCertificatesParams) (int, *ImportCertificatesResponse, error) {
+	reqData, err := json.Marshal(params)
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequest("POST", url+"/api/v1/certificates/import", bytes.NewReader(reqData))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	var importResponse ImportCertificatesResponse
+	if err := json.NewDecoder(res.Body).Decode(&importResponse); err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, &importResponse, nil
+}
+
+func TestImportCertificatesEndToEnd(t *testing.T) {
+	ts, _, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+	signingCA := newTestSigningCA(t)
+	profile := db.DefaultCertificateProfiles()[0]
+	first, err := signingCA.Sign(newTestCSR(t, "first.example.com"), profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := signingCA.Sign(newTestCSR(t, "second.example.com"), profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var adminToken string
+	var nonAdminToken string
+	t.Run("prepare user accounts and tokens", prepareAccounts(ts.URL, client, &adminToken, &nonAdminToken))
+
+	t.Run("1. Import certificates - no certificates", func(t *testing.T) {
+		statusCode, _, err := importCertificates(ts.URL, client, adminToken, ImportCertificatesParams{Certificates: newTestCSR(t, "csr.example.com")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, statusCode)
+		}
+	})
+
+	t.Run("2. Import certificates - bundle with duplicates", func(t *testing.T) {
+		params := ImportCertificatesParams{Certificates: first + "\n" + second + "\n" + first}
+		statusCode, importResponse, err := importCertificates(ts.URL, client, nonAdminToken, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		expected := []ImportCertificateResult{{ID: 1, Status: "imported"}, {ID: 2, Status: "imported"}, {ID: 1, Status: "duplicate"}}
+		if len(importResponse.Result) != len(expected) {
+			t.Fatalf("expected %d results, got %+v", len(expected), importResponse.Result)
+		}
+		for i, result := range importResponse.Result {
+			if result != expected[i] {
+				t.Fatalf("expected result %+v, got %+v", expected[i], result)
+			}
+		}
+	})
+
+	t.Run("3. Import certificates - imported certificates are listed", func(t *testing.T) {
+		statusCode, listResponse, err := listCertificateRequests(ts.URL, client, adminToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, statusCode)
+		}
+		if len(listResponse.Result) != 2 {
+			t.Fatalf("expected 2 certificates, got %d", len(listResponse.Result))
+		}
+		for _, entry := range listResponse.Result {
+			if entry.CSR != "" || entry.Certificate == "" || len(entry.Fingerprint) != 64 {
+				t.Fatalf("unexpected imported entry: %+v", entry)
+			}
+		}
+	})
+
+	t.Run("4. Import certificates - imported certificates can't be rejected", func(t *testing.T) {
+		statusCode, err := rejectCertificate(ts.URL, client, adminToken, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, statusCode)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/canonical/notary/internal/db"
+)
+
+// readinessTimeout bounds the time the database checks of a readiness probe can take.
+const readinessTimeout = 2 * time.Second
+
+const (
+	checkOK     = "ok"
+	checkBusy   = "busy"
+	checkFailed = "failed"
+)
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type ReadinessCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Ready  bool                      `json:"ready"`
+	Checks map[string]ReadinessCheck `json:"checks"`
+}
+
+// GetHealth reports that the process is alive and serving requests. It doesn't check its dependencies,
+// so that an orchestrator doesn't restart Notary when only the database is unavailable.
+func GetHealth(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := writeJSON(w, HealthResponse{Status: checkOK}); err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+		}
+	}
+}
+
+// GetReadiness checks that Notary can serve requests: the database can be read and written, its schema is
+// up to date, the signing CA is valid when one is configured, and the last run of every background job succeeded.
+// It returns the result of every check, with a 503 status when any of them failed. A database whose write lock is
+// held by another writer is reported as busy, which doesn't fail the probe. The errors of the failed checks are logged,
+// and only returned when detailed is set, since the public port serves the checks without authentication.
+func GetReadiness(env *HandlerConfig, detailed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		checks := map[string]error{
+			"database": env.DB.Ping(ctx),
+			"schema":   checkSchemaVersion(env.DB),
+		}
+		if signingCA := env.signingCA(); signingCA != nil {
+			checks["signing_ca"] = checkValidity(signingCA.Certificate.NotBefore, signingCA.Certificate.NotAfter)
+		}
+		if env.jobs != nil {
+			for name, err := range env.jobs.results() {
+				checks[name] = err
+			}
+		}
+
+		response := ReadinessResponse{Ready: true, Checks: map[string]ReadinessCheck{}}
+		for name, err := range checks {
+			if errors.Is(err, db.ErrBusy) {
+				response.Checks[name] = ReadinessCheck{Status: checkBusy}
+				continue
+			}
+			if err != nil {
+				slog.WarnContext(r.Context(), "Readiness check failed", "check", name, "error", err)
+				response.Ready = false
+				check := ReadinessCheck{Status: checkFailed}
+				if detailed {
+					check.Error = err.Error()
+				}
+				response.Checks[name] = check
+				continue
+			}
+			response.Checks[name] = ReadinessCheck{Status: checkOK}
+		}
+		status := http.StatusOK
+		if !response.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := writeJSON(w, response); err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+		}
+	}
+}
+
+func checkSchemaVersion(database *db.Database) error {
+	version, err := database.Version()
+	if err != nil {
+		return err
+	}
+	if version != db.SchemaVersion {
+		return fmt.Errorf("schema version %d isn't the current version %d", version, db.SchemaVersion)
+	}
+	return nil
+}
+
+func checkValidity(notBefore time.Time, notAfter time.Time) error {
+	now := time.Now()
+	if now.Before(notBefore) {
+		return fmt.Errorf("the certificate isn't valid before %s", notBefore.Format(time.RFC3339))
+	}
+	if now.After(notAfter) {
+		return fmt.Errorf("the certificate expired on %s", notAfter.Format(time.RFC3339))
+	}
+	return nil
+}
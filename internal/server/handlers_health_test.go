@@ -0,0 +1,216 @@
+package server_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/config"
+	"github.com/canonical/notary/internal/db"
+	"github.com/canonical/notary/internal/server"
+)
+
+type ReadinessCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type GetReadinessResponse struct {
+	Result struct {
+		Ready  bool                      `json:"ready"`
+		Checks map[string]ReadinessCheck `json:"checks"`
+	} `json:"result"`
+}
+
+func getReadiness(url string, client *http.Client) (int, *GetReadinessResponse, error) {
+	res, err := client.Get(url + "/readyz")
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	var readinessResponse GetReadinessResponse
+	if err := json.NewDecoder(res.Body).Decode(&readinessResponse); err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, &readinessResponse, nil
+}
+
+func TestHealth(t *testing.T) {
+	ts, config, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+
+	t.Run("healthy", func(t *testing.T) {
+		res, err := client.Get(ts.URL + "/healthz")
+		if err != nil {
+			t.Fatalf("couldn't get health: %s", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+		}
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		statusCode, readinessResponse, err := getReadiness(ts.URL, client)
+		if err != nil {
+			t.Fatalf("couldn't get readiness: %s", err)
+		}
+		if statusCode != http.StatusOK || !readinessResponse.Result.Ready {
+			t.Fatalf("expected to be ready, got %d: %+v", statusCode, readinessResponse.Result)
+		}
+		for _, name := range []string{"database", "schema"} {
+			if readinessResponse.Result.Checks[name].Status != "ok" {
+				t.Fatalf("expected the %s check to pass, got %+v", name, readinessResponse.Result.Checks)
+			}
+		}
+	})
+
+	t.Run("not ready without a database", func(t *testing.T) {
+		if err := config.DB.Close(); err != nil {
+			t.Fatalf("couldn't close database: %s", err)
+		}
+		statusCode, readinessResponse, err := getReadiness(ts.URL, client)
+		if err != nil {
+			t.Fatalf("couldn't get readiness: %s", err)
+		}
+		if statusCode != http.StatusServiceUnavailable || readinessResponse.Result.Ready {
+			t.Fatalf("expected not to be ready, got %d", statusCode)
+		}
+		if check := readinessResponse.Result.Checks["database"]; check.Status != "failed" || check.Error != "" {
+			t.Fatalf("expected the database check to fail without its error on the public port, got %+v", check)
+		}
+
+		recorder := httptest.NewRecorder()
+		server.GetReadiness(config, true)(recorder, httptest.NewRequest("GET", "/readyz", nil))
+		var detailedResponse GetReadinessResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&detailedResponse); err != nil {
+			t.Fatalf("couldn't decode readiness: %s", err)
+		}
+		if check := detailedResponse.Result.Checks["database"]; check.Status != "failed" || check.Error == "" {
+			t.Fatalf("expected the detailed database check to fail with an error, got %+v", check)
+		}
+
+		res, err := client.Get(ts.URL + "/healthz")
+		if err != nil {
+			t.Fatalf("couldn't get health: %s", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected to stay healthy without a database, got %d", res.StatusCode)
+		}
+	})
+}
+
+func TestReadinessReportsJobs(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	cert, key := newTestKeyPair(t, "notary.example.com")
+	if err := os.WriteFile(certPath, cert, 0o600); err != nil {
+		t.Fatalf("couldn't write certificate: %s", err)
+	}
+	if err := os.WriteFile(keyPath, key, 0o600); err != nil {
+		t.Fatalf("couldn't write key: %s", err)
+	}
+	s, err := server.New(config.Config{
+		Port:     8000,
+		Cert:     cert,
+		Key:      key,
+		CertPath: certPath,
+		KeyPath:  keyPath,
+		DBPath:   filepath.Join(dir, "certs.db"),
+	})
+	if err != nil {
+		t.Fatalf("couldn't create server: %s", err)
+	}
+	defer s.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.WatchCertificate(ctx, 10*time.Millisecond)
+
+	readiness := func() (int, *GetReadinessResponse) {
+		recorder := httptest.NewRecorder()
+		s.Handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+		var readinessResponse GetReadinessResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&readinessResponse); err != nil {
+			t.Fatalf("couldn't decode readiness: %s", err)
+		}
+		return recorder.Code, &readinessResponse
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		statusCode, readinessResponse := readiness()
+		if readinessResponse.Result.Checks["certificate_watch"].Status == "ok" {
+			if statusCode != http.StatusOK {
+				t.Fatalf("expected to be ready, got %d: %+v", statusCode, readinessResponse.Result)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the certificate watch wasn't reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := os.WriteFile(keyPath, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("couldn't write key: %s", err)
+	}
+	for {
+		statusCode, readinessResponse := readiness()
+		if check := readinessResponse.Result.Checks["certificate_watch"]; check.Status == "failed" {
+			if statusCode != http.StatusServiceUnavailable {
+				t.Fatalf("expected a failed job to make the server not ready, got %d", statusCode)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the failed certificate reload wasn't reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadinessWithBusyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "certs.db")
+	database, err := db.NewDatabase(path)
+	if err != nil {
+		t.Fatalf("couldn't create database: %s", err)
+	}
+	defer database.Close()
+	other, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("couldn't open database: %s", err)
+	}
+	defer other.Close()
+	otherTx, err := other.Begin()
+	if err != nil {
+		t.Fatalf("couldn't begin transaction: %s", err)
+	}
+	defer otherTx.Rollback() //nolint:errcheck
+	if _, err := otherTx.Exec("PRAGMA user_version = 42"); err != nil {
+		t.Fatalf("couldn't write: %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.GetReadiness(&server.HandlerConfig{DB: database}, true)(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	var readinessResponse GetReadinessResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&readinessResponse); err != nil {
+		t.Fatalf("couldn't decode readiness: %s", err)
+	}
+	if recorder.Code != http.StatusOK || !readinessResponse.Result.Ready {
+		t.Fatalf("expected a busy database not to fail the probe, got %d: %+v", recorder.Code, readinessResponse.Result)
+	}
+	if check := readinessResponse.Result.Checks["database"]; check.Status != "busy" || check.Error != "" {
+		t.Fatalf("expected the database check to be busy, got %+v", check)
+	}
+}
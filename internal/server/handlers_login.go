@@ -1,13 +1,16 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/canonical/notary/internal/db"
+	"github.com/canonical/notary/internal/logging"
+	"github.com/canonical/notary/internal/tracing"
 	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -54,35 +57,38 @@ func Login(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var loginParams LoginParams
 		if err := json.NewDecoder(r.Body).Decode(&loginParams); err != nil {
-			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			writeProblem(w, r, errInvalidJSON)
 			return
 		}
 		if loginParams.Username == "" {
-			writeError(w, http.StatusBadRequest, "Username is required")
+			writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeMissingField, "username", "Username is required"))
 			return
 		}
 		if loginParams.Password == "" {
-			writeError(w, http.StatusBadRequest, "Password is required")
+			writeProblem(w, r, fieldProblem(http.StatusBadRequest, codeMissingField, "password", "Password is required"))
 			return
 		}
-		userAccount, err := env.DB.RetrieveUserByUsername(loginParams.Username)
+		userAccount, err := env.DB.WithContext(r.Context()).RetrieveUserByUsername(loginParams.Username)
 		if err != nil {
-			log.Println(err)
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
 			if errors.Is(err, db.ErrIdNotFound) {
-				writeError(w, http.StatusUnauthorized, "The username or password is incorrect. Try again.")
+				failLogin(w, r, reasonUnknownUser)
 				return
 			}
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
-		if err := bcrypt.CompareHashAndPassword([]byte(userAccount.Password), []byte(loginParams.Password)); err != nil {
-			writeError(w, http.StatusUnauthorized, "The username or password is incorrect. Try again.")
+		if err := verifyPassword(r.Context(), userAccount.Password, loginParams.Password); err != nil {
+			failLogin(w, r, reasonWrongPassword)
 			return
 		}
+		if request := logging.RequestFromContext(r.Context()); request != nil {
+			request.User = userAccount.Username
+		}
 		jwt, err := generateJWT(userAccount.ID, userAccount.Username, env.JWTSecret, userAccount.Permissions)
 		if err != nil {
-			log.Println(err)
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -91,8 +97,17 @@ func Login(env *HandlerConfig) http.HandlerFunc {
 		}
 		err = writeJSON(w, loginResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
 }
+
+// verifyPassword checks the password against the hash of the password of the account, in its own span,
+// as hashing is slow on purpose.
+func verifyPassword(ctx context.Context, hash string, password string) error {
+	_, span := tracing.Tracer(tracerName).Start(ctx, "verify password")
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	tracing.End(span, err)
+	return err
+}
@@ -15,9 +15,9 @@ type StatusResponse struct {
 // initialized means the first user has been created
 func GetStatus(env *HandlerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		numUsers, err := env.DB.NumUsers()
+		numUsers, err := env.DB.WithContext(r.Context()).NumUsers()
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "couldn't generate status")
+			writeError(w, r, http.StatusInternalServerError, "couldn't generate status")
 			return
 		}
 		statusResponse := StatusResponse{
@@ -27,7 +27,7 @@ func GetStatus(env *HandlerConfig) http.HandlerFunc {
 		w.WriteHeader(http.StatusOK)
 		err = writeJSON(w, statusResponse)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
 	}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/canonical/notary/internal/metrics"
+)
+
+// ListenAndServe listens on the public port with TLS, and on the metrics listener and the admin socket when they
+// are configured, and starts the background jobs of the server. It returns once one of the listeners fails,
+// after closing the server, or after Shutdown is called, with http.ErrServerClosed.
+func (s *Server) ListenAndServe() error {
+	// The listeners opened so far are closed when a later one fails.
+	var listeners []net.Listener
+	closeListeners := func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}
+	publicListener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	listeners = append(listeners, publicListener)
+	serves := []func() error{func() error { return s.Server.ServeTLS(publicListener, "", "") }}
+	if s.metricsServer != nil {
+		metricsListener, err := net.Listen("tcp", s.metricsServer.Addr)
+		if err != nil {
+			closeListeners()
+			return fmt.Errorf("couldn't listen for metrics: %w", err)
+		}
+		listeners = append(listeners, metricsListener)
+		serves = append(serves, func() error {
+			if s.metricsServer.TLSConfig != nil {
+				return s.metricsServer.ServeTLS(metricsListener, "", "")
+			}
+			return s.metricsServer.Serve(metricsListener)
+		})
+	}
+	if s.adminServer != nil {
+		adminListener, err := listenAdminSocket(s.adminServer.Addr)
+		if err != nil {
+			closeListeners()
+			return fmt.Errorf("couldn't listen on the admin socket: %w", err)
+		}
+		serves = append(serves, func() error { return s.adminServer.Serve(adminListener) })
+	}
+	s.startJobs()
+
+	errs := make(chan error, len(serves))
+	for _, serve := range serves {
+		go func() { errs <- serve() }()
+	}
+	err = <-errs
+	if !errors.Is(err, http.ErrServerClosed) {
+		s.Close()
+	}
+	for range len(serves) - 1 {
+		<-errs
+	}
+	return err
+}
+
+// startJobs starts the background jobs of the server, unless the server was already shut down.
+func (s *Server) startJobs() {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	if s.jobsStopped {
+		return
+	}
+	jobs := map[string]func(ctx context.Context){
+		metricsJob: func(ctx context.Context) {
+			s.metrics.Run(ctx, metrics.ExpiryInterval, s.env.jobs.reporter(metricsJob))
+		},
+		certificateWatchJob:   func(ctx context.Context) { s.WatchCertificate(ctx, CertificateWatchInterval) },
+		certificateRenewalJob: func(ctx context.Context) { s.RenewBootstrappedCertificate(ctx, BootstrapRenewalInterval) },
+	}
+	if s.conf.BackupDirectory != "" {
+		jobs[backupsJob] = func(ctx context.Context) {
+			s.env.DB.RunScheduledBackups(ctx, s.conf.BackupDirectory, s.conf.BackupInterval, s.conf.BackupRetention, s.env.jobs.reporter(backupsJob))
+		}
+	}
+	for name, job := range jobs {
+		s.env.jobs.reporter(name)(nil)
+		s.jobs.Add(1)
+		go func() {
+			defer s.jobs.Done()
+			job(s.jobsCtx)
+		}()
+	}
+}
+
+// Shutdown stops the server in order: it stops accepting connections on every listener, waits for the requests
+// in progress to finish, stops the background jobs, waiting for a job in progress such as a backup, and closes
+// the database. Requests that are still in progress when the context is done are interrupted, and the context error
+// is returned once the server is stopped.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, server := range s.servers() {
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Warn("Interrupting the requests in progress", "error", err)
+			errs = append(errs, err, server.Close())
+		}
+	}
+	errs = append(errs, s.stop())
+	return errors.Join(errs...)
+}
+
+// Close stops the server immediately: it closes every listener and connection, then stops the background jobs
+// and closes the database like Shutdown.
+func (s *Server) Close() error {
+	var errs []error
+	for _, server := range s.servers() {
+		errs = append(errs, server.Close())
+	}
+	errs = append(errs, s.stop())
+	return errors.Join(errs...)
+}
+
+// Names of the background jobs, which are reported by the readiness checks.
+const (
+	metricsJob            = "metrics"
+	backupsJob            = "backups"
+	certificateWatchJob   = "certificate_watch"
+	certificateRenewalJob = "certificate_renewal"
+)
+
+// jobStatuses records the result of the last run of every background job that was started, for the readiness checks.
+type jobStatuses struct {
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+func newJobStatuses() *jobStatuses {
+	return &jobStatuses{errs: map[string]error{}}
+}
+
+// reporter returns a function recording the result of a run of the named job.
+func (j *jobStatuses) reporter(name string) func(error) {
+	return func(err error) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.errs[name] = err
+	}
+}
+
+// results returns the result of the last run of every job that was started.
+func (j *jobStatuses) results() map[string]error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return maps.Clone(j.errs)
+}
+
+// stop stops the background jobs, waits for them to return and closes the database.
+func (s *Server) stop() error {
+	s.jobsMu.Lock()
+	s.jobsStopped = true
+	s.stopJobs()
+	s.jobsMu.Unlock()
+	s.jobs.Wait()
+	return s.env.DB.Close()
+}
+
+func (s *Server) servers() []*http.Server {
+	servers := []*http.Server{s.Server}
+	if s.metricsServer != nil {
+		servers = append(servers, s.metricsServer)
+	}
+	if s.adminServer != nil {
+		servers = append(servers, s.adminServer)
+	}
+	return servers
+}
@@ -0,0 +1,126 @@
+package server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/config"
+	"github.com/canonical/notary/internal/server"
+)
+
+// checkGoroutines fails the test if goroutines started after it is called are still running once the test
+// and its other cleanups are done.
+func checkGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(2 * time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				stacks := make([]byte, 1<<20)
+				stacks = stacks[:runtime.Stack(stacks, true)]
+				t.Fatalf("%d goroutines leaked:\n%s", runtime.NumGoroutine()-before, stacks)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func newLifecycleTestServer(t *testing.T) (*server.Server, string) {
+	dir := t.TempDir()
+	cert, key := newTestKeyPair(t, "notary.example.com")
+	port := freePort(t)
+	s, err := server.New(config.Config{
+		Port:            port,
+		BindAddress:     "127.0.0.1",
+		Cert:            cert,
+		Key:             key,
+		DBPath:          filepath.Join(dir, "certs.db"),
+		MetricsPort:     freePort(t),
+		AdminSocketPath: filepath.Join(dir, "admin.sock"),
+		BackupDirectory: filepath.Join(dir, "backups"),
+		BackupInterval:  time.Hour,
+		BackupRetention: 1,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create server: %s", err)
+	}
+	return s, net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+}
+
+func waitForServer(t *testing.T, client *http.Client, url string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, _, err := get(client, url); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the server didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	checkGoroutines(t)
+	s, address := newLifecycleTestServer(t)
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServe() }()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	defer client.CloseIdleConnections()
+	waitForServer(t, client, "https://"+address+"/status")
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("couldn't shut down: %s", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("expected the server to be closed, got %v", err)
+	}
+	if _, _, err := get(client, "https://"+address+"/status"); err == nil {
+		t.Fatalf("expected the server to stop accepting connections")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	checkGoroutines(t)
+	s, address := newLifecycleTestServer(t)
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServe() }()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	defer client.CloseIdleConnections()
+	waitForServer(t, client, "https://"+address+"/status")
+
+	// A connection that never sends a request keeps the server from draining before the timeout.
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("couldn't connect: %s", err)
+	}
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the shutdown to time out, got %v", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("expected the server to be closed, got %v", err)
+	}
+}
+
+func TestShutdownBeforeServing(t *testing.T) {
+	checkGoroutines(t)
+	s, _ := newLifecycleTestServer(t)
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("couldn't shut down: %s", err)
+	}
+	if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("expected a server that was shut down not to serve, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/canonical/notary/internal/config"
+	"github.com/canonical/notary/internal/metrics"
+)
+
+// newMetricsServer returns the server of the metrics listener, which also serves the health and readiness checks
+// for probes that can't reach the public port. It uses mutual TLS, with the certificate of the server, when a CA
+// for client certificates is configured, and plain HTTP otherwise.
+func (s *Server) newMetricsServer(conf config.Config, m *metrics.PrometheusMetrics) (*http.Server, error) {
+	router := s.routes.newMux("")
+	router.Handle("/metrics", m.Handler)
+	router.HandleFunc("GET /healthz", GetHealth(s.env))
+	router.HandleFunc("GET /readyz", GetReadiness(s.env, true))
+	metricsServer := &http.Server{
+		Addr:           net.JoinHostPort(conf.MetricsBindAddress, strconv.Itoa(conf.MetricsPort)),
+		ReadTimeout:    conf.ReadTimeout,
+		WriteTimeout:   conf.WriteTimeout,
+		IdleTimeout:    idleTimeout(conf),
+		Handler:        requestMiddlewareStack(router),
+		MaxHeaderBytes: conf.MaxHeaderBytes,
+	}
+	if conf.MetricsClientCA == nil {
+		return metricsServer, nil
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(conf.MetricsClientCA) {
+		return nil, errors.New("couldn't load the CA of the metrics clients")
+	}
+	metricsServer.TLSConfig = &tls.Config{
+		GetCertificate:   s.getCertificate,
+		ClientAuth:       tls.RequireAndVerifyClientCert,
+		ClientCAs:        clientCAs,
+		MinVersion:       conf.TLSMinVersion,
+		CipherSuites:     conf.TLSCipherSuites,
+		CurvePreferences: conf.TLSCurvePreferences,
+	}
+	return metricsServer, nil
+}
+
+// listenAdminSocket listens on the unix socket at the given path, which only its owner can open.
+// A socket left behind by a server that didn't stop cleanly is replaced, but not one that is still in use.
+func listenAdminSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	// The socket is created with the permissions the umask allows, so the umask is narrowed while listening
+	// rather than changing them afterwards, which would leave the socket open to others in the meantime.
+	// The umask is process-wide, but no other files are created before the server starts its jobs.
+	umask := syscall.Umask(0o177)
+	defer syscall.Umask(umask)
+	return net.Listen("unix", path)
+}
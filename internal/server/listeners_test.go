@@ -0,0 +1,184 @@
+package server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/config"
+	"github.com/canonical/notary/internal/server"
+)
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("couldn't find a free port: %s", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func get(client *http.Client, url string) (int, string, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	return res.StatusCode, string(body), err
+}
+
+func TestSeparateListeners(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := newTestKeyPair(t, "notary.example.com")
+	clientCert, clientKey := newTestKeyPair(t, "prometheus")
+	port, metricsPort := freePort(t), freePort(t)
+	socketPath := filepath.Join(dir, "admin.sock")
+	s, err := server.New(config.Config{
+		Port:               port,
+		BindAddress:        "127.0.0.1",
+		Cert:               cert,
+		Key:                key,
+		DBPath:             filepath.Join(dir, "certs.db"),
+		MetricsPort:        metricsPort,
+		MetricsBindAddress: "127.0.0.1",
+		MetricsClientCA:    clientCert,
+		AdminSocketPath:    socketPath,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create server: %s", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServe() }()
+
+	publicURL := "https://127.0.0.1:" + strconv.Itoa(port)
+	metricsURL := "https://127.0.0.1:" + strconv.Itoa(metricsPort) + "/metrics"
+	insecure := &tls.Config{InsecureSkipVerify: true}
+	publicClient := &http.Client{Transport: &http.Transport{TLSClientConfig: insecure}}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, _, err := get(publicClient, publicURL+"/status"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the server didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Run("metrics aren't served on the public port", func(t *testing.T) {
+		_, body, err := get(publicClient, publicURL+"/metrics")
+		if err != nil {
+			t.Fatalf("couldn't get metrics: %s", err)
+		}
+		if strings.Contains(body, "# HELP") {
+			t.Fatalf("expected metrics to only be served on the metrics listener")
+		}
+	})
+
+	t.Run("metrics require a client certificate", func(t *testing.T) {
+		if _, _, err := get(publicClient, metricsURL); err == nil {
+			t.Fatalf("expected metrics to be refused without a client certificate")
+		}
+		clientCertificate, err := tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			t.Fatalf("couldn't load client certificate: %s", err)
+		}
+		metricsClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       []tls.Certificate{clientCertificate},
+		}}}
+		statusCode, body, err := get(metricsClient, metricsURL)
+		if err != nil {
+			t.Fatalf("couldn't get metrics: %s", err)
+		}
+		if statusCode != http.StatusOK || !strings.Contains(body, "# HELP") {
+			t.Fatalf("expected metrics, got %d: %s", statusCode, body)
+		}
+		statusCode, body, err = get(metricsClient, strings.TrimSuffix(metricsURL, "/metrics")+"/readyz")
+		if err != nil {
+			t.Fatalf("couldn't get readiness: %s", err)
+		}
+		if statusCode != http.StatusOK || !strings.Contains(body, `"metrics":{"status":"ok"}`) {
+			t.Fatalf("expected readiness to be served with metrics, got %d: %s", statusCode, body)
+		}
+	})
+
+	t.Run("the admin socket doesn't require a login", func(t *testing.T) {
+		statusCode, _, err := get(publicClient, publicURL+"/api/v1/accounts")
+		if err != nil {
+			t.Fatalf("couldn't list accounts: %s", err)
+		}
+		if statusCode != http.StatusUnauthorized {
+			t.Fatalf("expected the public port to require a login, got %d", statusCode)
+		}
+		socketClient := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		}}
+		statusCode, body, err := get(socketClient, "http://notary/api/v1/accounts")
+		if err != nil {
+			t.Fatalf("couldn't list accounts: %s", err)
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected the admin socket to grant admin access, got %d: %s", statusCode, body)
+		}
+		info, err := os.Stat(socketPath)
+		if err != nil || info.Mode().Perm() != 0o600 {
+			t.Fatalf("expected the admin socket to only be usable by its owner, got %v", info.Mode())
+		}
+	})
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("couldn't shut down: %s", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("expected the server to be closed, got %s", err)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the admin socket to be removed")
+	}
+}
+
+func TestListenAndServeFails(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := newTestKeyPair(t, "notary.example.com")
+	socketPath := filepath.Join(dir, "admin.sock")
+	if err := os.WriteFile(socketPath, nil, 0o600); err != nil {
+		t.Fatalf("couldn't write file: %s", err)
+	}
+	port, metricsPort := freePort(t), freePort(t)
+	s, err := server.New(config.Config{
+		Port:               port,
+		BindAddress:        "127.0.0.1",
+		Cert:               cert,
+		Key:                key,
+		DBPath:             filepath.Join(dir, "certs.db"),
+		MetricsPort:        metricsPort,
+		MetricsBindAddress: "127.0.0.1",
+		AdminSocketPath:    socketPath,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create server: %s", err)
+	}
+	if err := s.ListenAndServe(); err == nil || !strings.Contains(err.Error(), "isn't a socket") {
+		t.Fatalf("expected a file in place of the admin socket to be an error, got %v", err)
+	}
+	for _, p := range []int{port, metricsPort} {
+		listener, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(p))
+		if err != nil {
+			t.Fatalf("expected the listeners to be closed after the failure, got %s", err)
+		}
+		listener.Close()
+	}
+}
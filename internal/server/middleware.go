@@ -1,45 +1,58 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/canonical/notary/internal/db"
+	"github.com/canonical/notary/internal/logging"
 	"github.com/canonical/notary/internal/metrics"
 	"github.com/golang-jwt/jwt"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	UserPermission  = 0
-	AdminPermission = 1
+	UserPermission  = db.UserPermission
+	AdminPermission = db.AdminPermission
 )
 
 type middleware func(http.Handler) http.Handler
 
-// The middlewareContext type helps middleware receive and pass along information through the middleware chain.
-type middlewareContext struct {
-	responseStatusCode int
-	jwtSecret          []byte
-}
+// requestIDHeader is the header that carries the ID of a request, both in the request and in its response.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID matches the request IDs accepted from clients and proxies. Other IDs are replaced, so that
+// they can't forge log lines.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// localAdminUser is the user logged for the requests received on the admin socket.
+const localAdminUser = "admin_socket"
 
 // The statusRecorder struct wraps the http.ResponseWriter struct, and extracts the status
-// code of the response writer for the middleware to read
+// code of the response writer and the size of its body for the middleware to read
 type statusRecorder struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int
 }
 
 // newResponseWriter returns a new ResponseWriterCloner struct
 // it returns http.StatusOK by default because the http.ResponseWriter defaults to that header
 // if the WriteHeader() function is never called.
 func newResponseWriter(w http.ResponseWriter) *statusRecorder {
-	return &statusRecorder{w, http.StatusOK}
+	return &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
 }
 
 // WriteHeader overrides the ResponseWriter method to duplicate the status code into the wrapper struct
@@ -48,6 +61,13 @@ func (rwc *statusRecorder) WriteHeader(code int) {
 	rwc.ResponseWriter.WriteHeader(code)
 }
 
+// Write overrides the ResponseWriter method to count the bytes of the body
+func (rwc *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rwc.ResponseWriter.Write(b)
+	rwc.bytes += n
+	return n, err
+}
+
 // createMiddlewareStack chains the given middleware functions to wrap the api.
 // Each middleware functions calls next.ServeHTTP in order to resume the chain of execution.
 // The order the middleware functions are given to createMiddlewareStack matters.
@@ -63,35 +83,196 @@ func createMiddlewareStack(middleware ...middleware) middleware {
 	}
 }
 
-// The Metrics middleware captures any request relevant to a metric and records it for prometheus.
+// Reasons of the requests refused because of their credentials or permissions, and of failed logins,
+// by which they are counted in the metrics.
+const (
+	reasonMissingToken   = "missing_token"
+	reasonMalformedToken = "malformed_token"
+	reasonExpiredToken   = "expired_token"
+	reasonInvalidToken   = "invalid_token"
+	reasonAdminRequired  = "admin_required"
+	reasonUserRequired   = "user_required"
+	reasonNotOwner       = "not_owner"
+	reasonUnknownUser    = "unknown_user"
+	reasonWrongPassword  = "wrong_password"
+)
+
+// requestMetrics holds what is learned about a request while it is handled, for its metrics.
+// The route is the pattern of the handler of the request. A request refused because of its credentials or
+// permissions has the status and the reason it was denied with, and a failed login has the reason it failed.
+type requestMetrics struct {
+	route        string
+	denialStatus int
+	denialReason string
+	loginFailure string
+}
+
+type requestMetricsKey struct{}
+
+func requestMetricsFromContext(ctx context.Context) *requestMetrics {
+	m, _ := ctx.Value(requestMetricsKey{}).(*requestMetrics)
+	return m
+}
+
+// deny refuses the request with the given status, which is 401 or 403, and records the reason for the metrics.
+func deny(w http.ResponseWriter, r *http.Request, status int, reason string, message string) {
+	if m := requestMetricsFromContext(r.Context()); m != nil {
+		m.denialStatus = status
+		m.denialReason = reason
+	}
+	writeError(w, r, status, message)
+}
+
+// failLogin refuses a login with a 401 status, and records the reason for the metrics.
+func failLogin(w http.ResponseWriter, r *http.Request, reason string) {
+	if m := requestMetricsFromContext(r.Context()); m != nil {
+		m.loginFailure = reason
+	}
+	writeProblem(w, r, newProblem(http.StatusUnauthorized, codeBadCredentials, "The username or password is incorrect. Try again."))
+}
+
+// The Metrics middleware counts every request and its duration, by method, route and status code, and the requests
+// in flight. It also counts failed logins, and requests refused because of their credentials or permissions, by reason.
+// The route is the pattern of the handler of the request, such as /api/v1/certificate_requests/{id},
+// so that the number of series doesn't grow with the paths that are requested.
 func metricsMiddleware(metrics *metrics.PrometheusMetrics) middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			base := promhttp.InstrumentHandlerCounter(
-				&metrics.RequestsTotal,
-				promhttp.InstrumentHandlerDuration(
-					&metrics.RequestsDuration,
-					next,
-				),
-			)
-			base.ServeHTTP(w, r)
+			metrics.RequestsInFlight.Inc()
+			defer metrics.RequestsInFlight.Dec()
+			start := time.Now()
+			m := &requestMetrics{}
+			recorder := newResponseWriter(w)
+			next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestMetricsKey{}, m)))
+
+			method := methodLabel(r.Method)
+			code := strconv.Itoa(recorder.statusCode)
+			metrics.RequestsTotal.WithLabelValues(method, m.route, code).Inc()
+			metrics.RequestsDuration.WithLabelValues(method, m.route, code).Observe(time.Since(start).Seconds())
+			if m.loginFailure != "" {
+				metrics.LoginFailures.WithLabelValues(m.loginFailure).Inc()
+			}
+			switch m.denialStatus {
+			case http.StatusUnauthorized:
+				metrics.UnauthorizedResponses.WithLabelValues(m.denialReason).Inc()
+			case http.StatusForbidden:
+				metrics.ForbiddenResponses.WithLabelValues(m.denialReason).Inc()
+			}
+		})
+	}
+}
+
+// methodLabel returns the method of a request for its metrics, which is "other" for methods that aren't standard,
+// so that clients can't create any number of series.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// The request middleware gives every request an ID, which is taken from its X-Request-ID header when it has a
+// valid one so that a request can be followed across proxies, and returns it in the X-Request-ID header of the response.
+// The ID and the remote IP of the request are added to every log emitted while handling it.
+func requestMiddleware() middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if !validRequestID.MatchString(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(requestIDHeader, id)
+			remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				remoteIP = r.RemoteAddr
+			}
+			ctx := logging.WithRequest(r.Context(), &logging.Request{ID: id, RemoteIP: remoteIP})
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// The Logging middleware captures any http request coming through and the response status code, and logs it.
-func loggingMiddleware(ctx *middlewareContext) middleware {
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand doesn't fail on the platforms Notary runs on.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// The tracing middleware traces every request in a span, which continues the W3C trace context of the request
+// when it has one. Requests for static files, probes and metrics scrapes aren't traced.
+func tracingMiddleware() middleware {
+	return func(next http.Handler) http.Handler {
+		return otelhttp.NewHandler(next, "notary",
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method }),
+			otelhttp.WithFilter(func(r *http.Request) bool { return !staticPath(r.URL.Path) && !probePath(r.URL.Path) }),
+		)
+	}
+}
+
+// The route middleware names the span of the request after the route of the mux that matches it, prefixed with
+// the path the mux is mounted at, such as GET /api/v1/certificate_requests/{id}, rather than after its path,
+// so that the spans of a route are grouped together. The route is also recorded for the metrics of the request.
+func routeMiddleware(prefix string, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			_, path, found := strings.Cut(pattern, " ")
+			if !found {
+				path = pattern
+			}
+			route := prefix + path
+			if span := trace.SpanFromContext(r.Context()); span.IsRecording() {
+				span.SetName(r.Method + " " + route)
+				span.SetAttributes(semconv.HTTPRoute(route))
+			}
+			if m := requestMetricsFromContext(r.Context()); m != nil {
+				m.route = route
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// staticPath reports whether the path is one of the static files of the frontend.
+func staticPath(path string) bool {
+	return strings.HasPrefix(path, "/_next")
+}
+
+// probePath reports whether the path is one of the health checks or the metrics, which probes and scrapers
+// request too often for every request to be worth logging or tracing.
+func probePath(path string) bool {
+	return path == "/healthz" || path == "/readyz" || path == "/metrics"
+}
+
+// The Logging middleware captures any http request coming through and logs it once handled, with the
+// status code, the size of the body and the duration of the response. Requests for static files aren't logged,
+// and probes and metrics scrapes are only logged at the debug level.
+func loggingMiddleware() middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
 			clonedWriter := newResponseWriter(w)
 			next.ServeHTTP(clonedWriter, r)
 
-			// Suppress logging for static files
-			if !strings.HasPrefix(r.URL.Path, "/_next") {
-				log.Println(r.Method, r.URL.Path, clonedWriter.statusCode, http.StatusText(clonedWriter.statusCode))
+			if staticPath(r.URL.Path) {
+				return
 			}
-
-			ctx.responseStatusCode = clonedWriter.statusCode
+			level := slog.LevelInfo
+			switch {
+			case clonedWriter.statusCode >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case probePath(r.URL.Path):
+				level = slog.LevelDebug
+			}
+			slog.LogAttrs(r.Context(), level, "Request handled",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", clonedWriter.statusCode),
+				slog.Int("bytes", clonedWriter.bytes),
+				slog.Duration("duration", time.Since(start)),
+			)
 		})
 	}
 }
@@ -99,15 +280,15 @@ func loggingMiddleware(ctx *middlewareContext) middleware {
 // The adminOnly middleware checks if the user has admin permissions before allowing access to the handler.
 func adminOnly(jwtSecret []byte, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		claims, err := getClaimsFromAuthorizationHeader(r.Header.Get("Authorization"), jwtSecret)
+		claims, err := getClaims(r, jwtSecret)
 		if err != nil {
-			log.Println(err)
-			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			slog.InfoContext(r.Context(), "Authentication failed", "error", err)
+			deny(w, r, http.StatusUnauthorized, unauthorizedReason(err), "Unauthorized")
 			return
 		}
 
 		if claims.Permissions != AdminPermission {
-			writeError(w, http.StatusForbidden, "forbidden: admin access required")
+			deny(w, r, http.StatusForbidden, reasonAdminRequired, "forbidden: admin access required")
 			return
 		}
 
@@ -118,14 +299,14 @@ func adminOnly(jwtSecret []byte, handler func(http.ResponseWriter, *http.Request
 // The adminOrUser middleware checks if the user has admin or user permissions before allowing access to the handler.
 func adminOrUser(jwtSecret []byte, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		claims, err := getClaimsFromAuthorizationHeader(r.Header.Get("Authorization"), jwtSecret)
+		claims, err := getClaims(r, jwtSecret)
 		if err != nil {
-			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			deny(w, r, http.StatusUnauthorized, unauthorizedReason(err), "Unauthorized")
 			return
 		}
 
 		if claims.Permissions != AdminPermission && claims.Permissions != UserPermission {
-			writeError(w, http.StatusForbidden, "forbidden: admin or user access required")
+			deny(w, r, http.StatusForbidden, reasonUserRequired, "forbidden: admin or user access required")
 			return
 		}
 
@@ -136,16 +317,16 @@ func adminOrUser(jwtSecret []byte, handler func(http.ResponseWriter, *http.Reque
 // The adminOrMe middleware checks if the user has admin permissions or if the user is the same user before allowing access to the handler.
 func adminOrMe(jwtSecret []byte, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		claims, err := getClaimsFromAuthorizationHeader(r.Header.Get("Authorization"), jwtSecret)
+		claims, err := getClaims(r, jwtSecret)
 		if err != nil {
-			log.Println(err)
-			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			slog.InfoContext(r.Context(), "Authentication failed", "error", err)
+			deny(w, r, http.StatusUnauthorized, unauthorizedReason(err), "Unauthorized")
 			return
 		}
 
 		if claims.Permissions != AdminPermission {
 			if r.PathValue("id") != "me" && strconv.Itoa(claims.ID) != r.PathValue("id") {
-				writeError(w, http.StatusForbidden, "forbidden: admin access required")
+				deny(w, r, http.StatusForbidden, reasonNotOwner, "forbidden: admin access required")
 				return
 			}
 		}
@@ -157,23 +338,23 @@ func adminOrMe(jwtSecret []byte, handler func(http.ResponseWriter, *http.Request
 // The adminOrFirstUser middleware checks if the user has admin permissions or if the user is the first user before allowing access to the handler.
 func adminOrFirstUser(jwtSecret []byte, db *db.Database, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		numUsers, err := db.NumUsers()
+		numUsers, err := db.WithContext(r.Context()).NumUsers()
 		if err != nil {
-			log.Println(err)
-			writeError(w, http.StatusInternalServerError, "Internal Error")
+			slog.ErrorContext(r.Context(), "Request failed", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
 			return
 		}
 
 		if numUsers > 0 {
-			claims, err := getClaimsFromAuthorizationHeader(r.Header.Get("Authorization"), jwtSecret)
+			claims, err := getClaims(r, jwtSecret)
 			if err != nil {
-				log.Println(err)
-				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				slog.InfoContext(r.Context(), "Authentication failed", "error", err)
+				deny(w, r, http.StatusUnauthorized, unauthorizedReason(err), "Unauthorized")
 				return
 			}
 
 			if claims.Permissions != AdminPermission && numUsers > 0 {
-				writeError(w, http.StatusForbidden, "forbidden: admin access required")
+				deny(w, r, http.StatusForbidden, reasonAdminRequired, "forbidden: admin access required")
 				return
 			}
 		}
@@ -181,21 +362,71 @@ func adminOrFirstUser(jwtSecret []byte, db *db.Database, handler func(http.Respo
 	}
 }
 
+// localAdminKey marks the context of the requests received on the admin socket.
+type localAdminKey struct{}
+
+// localAdmin grants admin permissions to every request, for the admin socket. Only local users that are
+// allowed to open the socket can reach it, so its permissions are what protects it instead of a login.
+func localAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), localAdminKey{}, true)))
+	})
+}
+
+// getClaims returns the claims of the bearer token of the request, or those of an admin for requests received
+// on the admin socket. The user is then added to the logs of the request.
+func getClaims(r *http.Request, jwtSecret []byte) (*jwtNotaryClaims, error) {
+	request := logging.RequestFromContext(r.Context())
+	if local, _ := r.Context().Value(localAdminKey{}).(bool); local {
+		if request != nil {
+			request.User = localAdminUser
+		}
+		return &jwtNotaryClaims{Permissions: AdminPermission}, nil
+	}
+	claims, err := getClaimsFromAuthorizationHeader(r.Header.Get("Authorization"), jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	if request != nil {
+		request.User = claims.Username
+	}
+	return claims, nil
+}
+
+var (
+	errMissingAuthorization   = errors.New("authorization header not found")
+	errMalformedAuthorization = errors.New("authorization header couldn't be processed. The expected format is 'Bearer <token>'")
+)
+
 func getClaimsFromAuthorizationHeader(header string, jwtSecret []byte) (*jwtNotaryClaims, error) {
 	if header == "" {
-		return nil, fmt.Errorf("authorization header not found")
+		return nil, errMissingAuthorization
 	}
 	bearerToken := strings.Split(header, " ")
 	if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
-		return nil, fmt.Errorf("authorization header couldn't be processed. The expected format is 'Bearer <token>'")
+		return nil, errMalformedAuthorization
 	}
 	claims, err := getClaimsFromJWT(bearerToken[1], jwtSecret)
 	if err != nil {
-		return nil, fmt.Errorf("token is not valid: %s", err)
+		return nil, fmt.Errorf("token is not valid: %w", err)
 	}
 	return claims, nil
 }
 
+// unauthorizedReason returns the reason a request whose claims couldn't be read is refused, for the metrics.
+func unauthorizedReason(err error) string {
+	var validationErr *jwt.ValidationError
+	switch {
+	case errors.Is(err, errMissingAuthorization):
+		return reasonMissingToken
+	case errors.Is(err, errMalformedAuthorization):
+		return reasonMalformedToken
+	case errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0:
+		return reasonExpiredToken
+	}
+	return reasonInvalidToken
+}
+
 // AllowRequest looks at the user data to determine the following things:
 // The first question is "Is this user trying to access a path that's restricted?"
 //
@@ -0,0 +1,204 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/canonical/notary/internal/logging"
+)
+
+// syncBuffer is a buffer the logs of the server can be written to while the test reads them.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// entries returns the JSON logs written to the buffer.
+func (b *syncBuffer) entries(t *testing.T) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var entries []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+	for scanner.Scan() {
+		var entry map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("couldn't parse log %q: %s", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// captureLogs sends the logs of the test to the returned buffer, in JSON, until the end of the test.
+func captureLogs(t *testing.T) *syncBuffer {
+	logs := &syncBuffer{}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(logs, logging.FormatJSON, slog.LevelDebug)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return logs
+}
+
+func getWithRequestID(t *testing.T, client *http.Client, url string, token string, requestID string) *http.Response {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestRequestID(t *testing.T) {
+	ts, _, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+
+	t.Run("propagated", func(t *testing.T) {
+		res := getWithRequestID(t, client, ts.URL+"/healthz", "", "3f0c6a1e-trace.42")
+		if id := res.Header.Get("X-Request-ID"); id != "3f0c6a1e-trace.42" {
+			t.Fatalf("expected the request ID to be propagated, got %q", id)
+		}
+	})
+
+	t.Run("generated", func(t *testing.T) {
+		first := getWithRequestID(t, client, ts.URL+"/healthz", "", "").Header.Get("X-Request-ID")
+		second := getWithRequestID(t, client, ts.URL+"/api/v1/accounts", "", "").Header.Get("X-Request-ID")
+		if first == "" || second == "" || first == second {
+			t.Fatalf("expected unique request IDs, got %q and %q", first, second)
+		}
+	})
+
+	t.Run("invalid replaced", func(t *testing.T) {
+		for _, invalid := range []string{`id msg="forged"`, strings.Repeat("a", 129)} {
+			res := getWithRequestID(t, client, ts.URL+"/healthz", "", invalid)
+			if id := res.Header.Get("X-Request-ID"); id == "" || id == invalid {
+				t.Fatalf("expected the invalid request ID to be replaced, got %q", id)
+			}
+		}
+	})
+}
+
+func TestRequestLogs(t *testing.T) {
+	ts, _, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+	var adminToken, nonAdminToken string
+	t.Run("prepare accounts", prepareAccounts(ts.URL, client, &adminToken, &nonAdminToken))
+	logs := captureLogs(t)
+
+	getWithRequestID(t, client, ts.URL+"/api/v1/accounts/me", nonAdminToken, "request-1")
+	getWithRequestID(t, client, ts.URL+"/api/v1/accounts", nonAdminToken, "request-2")
+
+	var handled, forbidden map[string]any
+	for _, entry := range logs.entries(t) {
+		switch {
+		case entry["request_id"] == "request-1" && entry["msg"] == "Request handled":
+			handled = entry
+		case entry["request_id"] == "request-2" && entry["msg"] == "Error response":
+			forbidden = entry
+		}
+	}
+	if handled == nil {
+		t.Fatalf("expected the request to be logged, got %v", logs.entries(t))
+	}
+	if handled["user"] != "testuser" || handled["remote_ip"] != "127.0.0.1" || handled["method"] != "GET" ||
+		handled["path"] != "/api/v1/accounts/me" || handled["status"] != float64(http.StatusOK) {
+		t.Fatalf("unexpected request fields: %v", handled)
+	}
+	if bytes, _ := handled["bytes"].(float64); bytes == 0 {
+		t.Fatalf("expected the size of the response to be logged: %v", handled)
+	}
+	if _, ok := handled["duration"]; !ok {
+		t.Fatalf("expected the duration of the request to be logged: %v", handled)
+	}
+	if forbidden == nil || forbidden["user"] != "testuser" || forbidden["status"] != float64(http.StatusForbidden) {
+		t.Fatalf("expected the error of the request to be logged with its fields, got %v", forbidden)
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	ts, _, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+	var adminToken, nonAdminToken string
+	t.Run("prepare accounts", prepareAccounts(ts.URL, client, &adminToken, &nonAdminToken))
+
+	if statusCode, _, err := getAccount(ts.URL, client, adminToken, 1); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("couldn't get account: %d, %v", statusCode, err)
+	}
+	if statusCode, _, err := login(ts.URL, client, &LoginParams{Username: "testadmin", Password: "wrong"}); err != nil || statusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the login to fail: %d, %v", statusCode, err)
+	}
+	if statusCode, _, err := login(ts.URL, client, &LoginParams{Username: "nobody", Password: "wrong"}); err != nil || statusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the login to fail: %d, %v", statusCode, err)
+	}
+	if res := getWithRequestID(t, client, ts.URL+"/api/v1/accounts", "", ""); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the request to be unauthorized, got %d", res.StatusCode)
+	}
+	if res := getWithRequestID(t, client, ts.URL+"/api/v1/accounts", "not a token", ""); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the request to be unauthorized, got %d", res.StatusCode)
+	}
+	if res := getWithRequestID(t, client, ts.URL+"/api/v1/accounts", nonAdminToken, ""); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected the request to be forbidden, got %d", res.StatusCode)
+	}
+
+	res, err := client.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body strings.Builder
+	if _, err := io.Copy(&body, res.Body); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`http_requests_total{code="200",method="GET",route="/api/v1/accounts/{id}"} 1`,
+		`http_requests_total{code="401",method="POST",route="/login"} 2`,
+		`http_request_duration_seconds_bucket{code="200",method="GET",route="/api/v1/accounts/{id}",le="0.005"}`,
+		`login_failures_total{reason="wrong_password"} 1`,
+		`login_failures_total{reason="unknown_user"} 1`,
+		`http_unauthorized_responses_total{reason="missing_token"} 1`,
+		`http_unauthorized_responses_total{reason="malformed_token"} 1`,
+		`http_forbidden_responses_total{reason="admin_required"} 1`,
+		// The request for the metrics themselves is in flight while they are gathered.
+		`http_requests_in_flight 1`,
+	} {
+		if !strings.Contains(body.String(), expected) {
+			t.Errorf("expected the metrics to contain %s", expected)
+		}
+	}
+	if strings.Contains(body.String(), `route="/api/v1/accounts/1"`) {
+		t.Errorf("expected requests to be labelled by their route rather than their path")
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/canonical/notary/version"
+)
+
+// openAPIVersion is the version of the OpenAPI specification the document of the API follows.
+const openAPIVersion = "3.1.0"
+
+// apiOperation documents a route of the router in the OpenAPI document. The schemas of the body of the request and
+// of the result of the response are derived from the Go types of request and response, which are nil when there is
+// none. Operations that respond with something else than JSON, such as files, set its content type instead. Public
+// operations don't need a token.
+type apiOperation struct {
+	method   string
+	path     string
+	summary  string
+	public   bool
+	query    []apiParameter
+	headers  []apiParameter
+	request  any
+	status   int
+	response any
+	// contentType is the type of the content of the response when it isn't JSON.
+	contentType string
+}
+
+type apiParameter struct {
+	name        string
+	description string
+}
+
+// apiOperations documents every route of the router. A route that isn't documented here fails the tests.
+var apiOperations = []apiOperation{
+	{method: "GET", path: "/api/v1/certificate_requests", summary: "Get all certificate requests", status: http.StatusOK, response: []GetCertificateRequestResponse{}},
+	{method: "POST", path: "/api/v1/certificate_requests", summary: "Create a new certificate request", request: CreateCertificateRequestParams{}, status: http.StatusCreated, response: CreateCertificateRequestResponse{}},
+	{method: "POST", path: "/api/v1/certificate_requests/bulk", summary: "Create many certificate requests", request: BulkCreateCertificateRequestsParams{}, status: http.StatusOK, response: BulkResponse{}},
+	{method: "POST", path: "/api/v1/certificate_requests/bulk/delete", summary: "Delete many certificate requests", request: BulkCertificateRequestsParams{}, status: http.StatusOK, response: BulkResponse{}},
+	{method: "POST", path: "/api/v1/certificate_requests/bulk/reject", summary: "Reject many certificate requests", request: BulkCertificateRequestsParams{}, status: http.StatusOK, response: BulkResponse{}},
+	{method: "POST", path: "/api/v1/certificate_requests/bulk/sign", summary: "Sign many certificate requests with the signing CA", request: BulkSignCertificateRequestsParams{}, status: http.StatusOK, response: BulkResponse{}},
+	{method: "GET", path: "/api/v1/certificate_requests/{id}", summary: "Get a certificate request by id", status: http.StatusOK, response: GetCertificateRequestResponse{}},
+	{method: "DELETE", path: "/api/v1/certificate_requests/{id}", summary: "Delete a certificate request by id", status: http.StatusAccepted, response: DeleteCertificateRequestResponse{}},
+	{method: "POST", path: "/api/v1/certificate_requests/{id}/renew", summary: "Renew the certificate of a certificate request", request: RenewCertificateRequestParams{}, status: http.StatusCreated, response: RenewCertificateRequestResponse{}},
+	{method: "GET", path: "/api/v1/certificate_requests/{id}/current", summary: "Get the latest issued request of a renewal lineage", status: http.StatusOK, response: GetCertificateRequestResponse{}},
+	{method: "POST", path: "/api/v1/certificate_requests/{id}/certificate", summary: "Create a certificate for a certificate request", request: CreateCertificateParams{}, status: http.StatusCreated, response: CreateCertificateResponse{}},
+	{method: "POST", path: "/api/v1/certificate_requests/{id}/certificate/reject", summary: "Reject a certificate request", status: http.StatusAccepted, response: RejectCertificateResponse{}},
+	{method: "DELETE", path: "/api/v1/certificate_requests/{id}/certificate", summary: "Delete the certificate of a certificate request", status: http.StatusOK, response: DeleteCertificateResponse{}},
+	{method: "POST", path: "/api/v1/certificate_requests/{id}/certificate/sign", summary: "Sign a certificate request with the signing CA", request: SignCertificateRequestParams{}, status: http.StatusCreated, response: SignCertificateResponse{}},
+	{method: "GET", path: "/api/v1/certificate_requests/{id}/certificate/download", summary: "Download the issued certificate", status: http.StatusOK, contentType: "application/octet-stream", query: []apiParameter{
+		{"format", "Encoding of the certificates: pem, der or p7b. Defaults to pem."},
+		{"chain", "Certificates of the bundle to download: leaf, chain, fullchain or root. Defaults to fullchain, or to leaf for der."},
+	}},
+	{method: "GET", path: "/api/v1/certificate_requests/{id}/certificate/truststore", summary: "Download a truststore of the issuing CA chain", status: http.StatusOK, contentType: "application/octet-stream", query: []apiParameter{
+		{"format", "Type of the truststore: p12 or jks. Defaults to p12."},
+	}, headers: []apiParameter{
+		{TrustStorePasswordHeader, "Password of the truststore. Defaults to changeit."},
+	}},
+	{method: "POST", path: "/api/v1/certificates/import", summary: "Import certificates issued outside of Notary", request: ImportCertificatesParams{}, status: http.StatusOK, response: []ImportCertificateResult{}},
+	{method: "GET", path: "/api/v1/certificate_profiles", summary: "Get all certificate profiles", status: http.StatusOK, response: []GetCertificateProfileResponse{}},
+	{method: "POST", path: "/api/v1/certificate_profiles", summary: "Create a new certificate profile", request: CertificateProfileParams{}, status: http.StatusCreated, response: CreateCertificateProfileResponse{}},
+	{method: "GET", path: "/api/v1/certificate_profiles/{id}", summary: "Get a certificate profile by id", status: http.StatusOK, response: GetCertificateProfileResponse{}},
+	{method: "PUT", path: "/api/v1/certificate_profiles/{id}", summary: "Replace a certificate profile by id", request: CertificateProfileParams{}, status: http.StatusOK, response: UpdateCertificateProfileResponse{}},
+	{method: "DELETE", path: "/api/v1/certificate_profiles/{id}", summary: "Delete a certificate profile by id", status: http.StatusAccepted, response: DeleteCertificateProfileResponse{}},
+	{method: "GET", path: "/api/v1/accounts", summary: "Get all user accounts", status: http.StatusOK, response: []GetAccountResponse{}},
+	{method: "POST", path: "/api/v1/accounts", summary: "Create a new user account. The first account can be created without a token.", request: CreateAccountParams{}, status: http.StatusCreated, response: CreateAccountResponse{}},
+	{method: "GET", path: "/api/v1/accounts/{id}", summary: "Get a user account by id, or the account of the token with me", status: http.StatusOK, response: GetAccountResponse{}},
+	{method: "DELETE", path: "/api/v1/accounts/{id}", summary: "Delete a user account by id", status: http.StatusAccepted, response: DeleteAccountResponse{}},
+	{method: "POST", path: "/api/v1/accounts/{id}/change_password", summary: "Change the password of a user account by id, or of the account of the token with me", request: ChangeAccountParams{}, status: http.StatusCreated, response: ChangeAccountResponse{}},
+	{method: "GET", path: "/api/v1/openapi.json", summary: "Get the OpenAPI document of the API", public: true, status: http.StatusOK},
+	{method: "POST", path: "/login", summary: "Log in and get a token", public: true, request: LoginParams{}, status: http.StatusOK, response: LoginResponse{}},
+	{method: "GET", path: "/status", summary: "Get the status of the Notary service", public: true, status: http.StatusOK, response: StatusResponse{}},
+	{method: "GET", path: "/healthz", summary: "Check that the Notary process is alive", public: true, status: http.StatusOK, response: HealthResponse{}},
+	{method: "GET", path: "/readyz", summary: "Check that Notary can serve requests. Responds with a 503 status when it can't.", public: true, status: http.StatusOK, response: ReadinessResponse{}},
+	{method: "GET", path: "/metrics", summary: "Get Prometheus metrics", public: true, status: http.StatusOK, contentType: "text/plain"},
+}
+
+// openAPIDocument returns the OpenAPI document of the API, which is built once from apiOperations.
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	schemas := map[string]any{}
+	paths := map[string]any{}
+	for _, op := range apiOperations {
+		operations, ok := paths[op.path].(map[string]any)
+		if !ok {
+			operations = map[string]any{}
+			paths[op.path] = operations
+		}
+		operations[strings.ToLower(op.method)] = op.document(schemas)
+	}
+	return json.Marshal(map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "Notary",
+			"version": version.GetVersion(),
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	})
+})
+
+// document returns the OpenAPI operation object of the operation, adding the schemas it refers to.
+// JSON results are wrapped in the result member of the response, as written by writeJSON.
+func (op apiOperation) document(schemas map[string]any) map[string]any {
+	var parameters []any
+	for _, segment := range strings.Split(op.path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			parameters = append(parameters, map[string]any{
+				"name": strings.Trim(segment, "{}"), "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+	}
+	for _, param := range op.query {
+		parameters = append(parameters, map[string]any{
+			"name": param.name, "in": "query", "description": param.description, "schema": map[string]any{"type": "string"},
+		})
+	}
+	for _, param := range op.headers {
+		parameters = append(parameters, map[string]any{
+			"name": param.name, "in": "header", "description": param.description, "schema": map[string]any{"type": "string"},
+		})
+	}
+	success := map[string]any{"description": http.StatusText(op.status)}
+	switch {
+	case op.contentType != "":
+		success["content"] = map[string]any{op.contentType: map[string]any{}}
+	case op.response != nil:
+		result := map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"result": openAPISchema(reflect.TypeOf(op.response), schemas, true)},
+		}
+		success["content"] = map[string]any{"application/json": map[string]any{"schema": result}}
+	default:
+		success["content"] = map[string]any{"application/json": map[string]any{}}
+	}
+	document := map[string]any{
+		"summary": op.summary,
+		"responses": map[string]any{
+			strconv.Itoa(op.status): success,
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{problemContentType: map[string]any{"schema": openAPISchema(reflect.TypeOf(ProblemResponse{}), schemas, true)}},
+			},
+		},
+	}
+	if len(parameters) > 0 {
+		document["parameters"] = parameters
+	}
+	if op.request != nil {
+		document["requestBody"] = map[string]any{
+			"content": map[string]any{"application/json": map[string]any{"schema": openAPISchema(reflect.TypeOf(op.request), schemas, false)}},
+		}
+	}
+	if op.public {
+		document["security"] = []any{}
+	} else {
+		document["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+	}
+	return document
+}
+
+// openAPISchema returns the JSON schema of the values of the given type, as encoded by encoding/json. Structs are added
+// to the schemas under the name of their type, and referred to. The fields of response structs that aren't omitted
+// when empty are required, while no field of request structs is, as the fields that are missing are left empty.
+func openAPISchema(t reflect.Type, schemas map[string]any, response bool) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return openAPISchema(t.Elem(), schemas, response)
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": openAPISchema(t.Elem(), schemas, response)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": openAPISchema(t.Elem(), schemas, response)}
+	case reflect.Struct:
+		if _, ok := schemas[t.Name()]; ok {
+			return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		}
+		properties := map[string]any{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = openAPISchema(field.Type, schemas, response)
+			if response && !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		if t.Name() == "" {
+			return schema
+		}
+		schemas[t.Name()] = schema
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+// GetOpenAPIDocument returns the OpenAPI document of the API, which describes every route of the router.
+func GetOpenAPIDocument(env *HandlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		document, err := openAPIDocument()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't build the OpenAPI document", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(document); err != nil {
+			slog.ErrorContext(r.Context(), "Error writing response", "error", err)
+		}
+	}
+}
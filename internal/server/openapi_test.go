@@ -0,0 +1,105 @@
+package server_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/canonical/notary/internal/config"
+	"github.com/canonical/notary/internal/server"
+)
+
+type openAPIDocument struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+}
+
+// registeredRoutes returns the patterns of the routes of a server whose metrics are served on a separate listener,
+// as registered at runtime. The patterns that mount a whole subtree, such as the API and the frontend, are left out.
+func registeredRoutes(t *testing.T) []string {
+	cert, key := newTestKeyPair(t, "notary.example.com")
+	s, err := server.New(config.Config{
+		Port:        8000,
+		Cert:        cert,
+		Key:         key,
+		DBPath:      filepath.Join(t.TempDir(), "certs.db"),
+		MetricsPort: 9000,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create server: %s", err)
+	}
+	defer s.Close()
+	var routes []string
+	for _, route := range s.Routes() {
+		if !strings.HasSuffix(route, "/") {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	ts, _, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+
+	statusCode, body, err := get(ts.Client(), ts.URL+"/api/v1/openapi.json")
+	if err != nil || statusCode != 200 {
+		t.Fatalf("expected the document to be served without a token, got %d, %v", statusCode, err)
+	}
+	var document openAPIDocument
+	if err := json.Unmarshal([]byte(body), &document); err != nil {
+		t.Fatalf("couldn't decode document: %s", err)
+	}
+	if document.OpenAPI != "3.1.0" {
+		t.Fatalf("unexpected OpenAPI version %q", document.OpenAPI)
+	}
+
+	routes := registeredRoutes(t)
+	if !slices.Contains(routes, "/metrics") || !slices.Contains(routes, "GET /api/v1/openapi.json") {
+		t.Fatalf("expected to find the routes of the router and of the metrics listener, got %v", routes)
+	}
+	documented := 0
+	for _, operations := range document.Paths {
+		documented += len(operations)
+	}
+	if documented != len(routes) {
+		t.Errorf("expected the %d routes of the router to be documented, got %d operations", len(routes), documented)
+	}
+	for _, route := range routes {
+		method, path, found := strings.Cut(route, " ")
+		if !found {
+			path = method
+			method = ""
+		}
+		operations, ok := document.Paths[path]
+		if !ok {
+			t.Errorf("route %q isn't documented", route)
+			continue
+		}
+		if _, ok := operations[strings.ToLower(method)]; method != "" && !ok {
+			t.Errorf("route %q isn't documented", route)
+		}
+	}
+
+	for _, ref := range strings.Split(body, `"$ref":"`)[1:] {
+		name := strings.TrimPrefix(ref[:strings.Index(ref, `"`)], "#/components/schemas/")
+		if _, ok := document.Components.Schemas[name]; !ok {
+			t.Errorf("schema %q is referred to but not defined", name)
+		}
+	}
+	var request map[string]any
+	if err := json.Unmarshal(document.Components.Schemas["CreateCertificateRequestParams"], &request); err != nil {
+		t.Fatalf("expected the schema of the request body to be derived from its type: %s", err)
+	}
+	if properties, _ := request["properties"].(map[string]any); properties["csr"] == nil {
+		t.Fatalf("expected the csr field in the schema of the request, got %v", request)
+	}
+}
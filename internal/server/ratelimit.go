@@ -0,0 +1,173 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/canonical/notary/internal/config"
+)
+
+// rateLimits holds the limiters of the groups of routes, each of which is nil when its group isn't limited.
+// Login requests are limited by the login limiter, requests that submit certificate requests by the submissions
+// limiter, and every request of the API, including submissions, by the api limiter.
+type rateLimits struct {
+	login       *rateLimiter
+	submissions *rateLimiter
+	api         *rateLimiter
+}
+
+func newRateLimits(conf config.Config) rateLimits {
+	return rateLimits{
+		login:       newRateLimiter(conf.RateLimitLogin, conf.TrustedProxies),
+		submissions: newRateLimiter(conf.RateLimitSubmissions, conf.TrustedProxies),
+		api:         newRateLimiter(conf.RateLimitAPI, conf.TrustedProxies),
+	}
+}
+
+// rateLimiter keeps a token bucket for every client: a client can send up to burst requests at once, and
+// its bucket is refilled at the rate of the limiter.
+type rateLimiter struct {
+	// rate is the number of tokens added to a bucket every second.
+	rate           float64
+	burst          float64
+	trustedProxies []netip.Prefix
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter of the given rate, or nil when the rate is 0.
+func newRateLimiter(limit config.RateLimit, trustedProxies []netip.Prefix) *rateLimiter {
+	if limit.RequestsPerMinute == 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:           float64(limit.RequestsPerMinute) / 60,
+		burst:          float64(limit.Burst),
+		trustedProxies: trustedProxies,
+		buckets:        map[string]*tokenBucket{},
+	}
+}
+
+// allow takes a token from the bucket of the client with the given key, and reports whether there was one.
+// When there wasn't, it also returns how long the client has to wait for the next one.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets the buckets that have been refilled since they were last used, as they are the same as new ones,
+// so that the clients that stopped sending requests don't pile up. It only looks at the buckets once per the time
+// it takes to refill one.
+func (l *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rateLimited refuses the requests of a client beyond the rate of the limiter with a 429 status, and tells it when
+// to retry in the Retry-After header. Clients are identified by their account when the request has a valid token,
+// and by their IP address otherwise. Requests received on the admin socket aren't limited, and neither is anything
+// when the limiter is nil.
+func rateLimited(limiter *rateLimiter, jwtSecret []byte, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	if limiter == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if local, _ := r.Context().Value(localAdminKey{}).(bool); local {
+			handler(w, r)
+			return
+		}
+		allowed, wait := limiter.allow(limiter.clientKey(r, jwtSecret), time.Now())
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, r, http.StatusTooManyRequests, "Too many requests. Try again later.")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// clientKey returns the key of the bucket of the client that sent the request.
+func (l *rateLimiter) clientKey(r *http.Request, jwtSecret []byte) string {
+	if claims, err := getClaimsFromAuthorizationHeader(r.Header.Get("Authorization"), jwtSecret); err == nil {
+		return "account:" + strconv.Itoa(claims.ID)
+	}
+	return "ip:" + clientIP(r, l.trustedProxies)
+}
+
+// clientIP returns the IP address of the client that sent the request. When the request comes from a trusted proxy,
+// the client is the last address of the X-Forwarded-For header that isn't a trusted proxy, as the addresses before it
+// could have been set by the client itself, or the address of the X-Real-IP header when there is no X-Forwarded-For.
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if !trusted(addr, trustedProxies) {
+		return addr.String()
+	}
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	if len(forwarded) == 0 {
+		if realIP, err := netip.ParseAddr(r.Header.Get("X-Real-IP")); err == nil {
+			return realIP.Unmap().String()
+		}
+	}
+	for i := len(forwarded) - 1; i >= 0 && trusted(addr, trustedProxies); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+	}
+	return addr.String()
+}
+
+func trusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/config"
+	"github.com/canonical/notary/internal/server"
+)
+
+// newTestServer serves the handler of a server created with the given config, completed with a TLS certificate
+// and a database, until the end of the test.
+func newTestServer(t *testing.T, conf config.Config) *httptest.Server {
+	conf.Cert, conf.Key = newTestKeyPair(t, "notary.example.com")
+	conf.Port = 8000
+	conf.DBPath = filepath.Join(t.TempDir(), "certs.db")
+	s, err := server.New(conf)
+	if err != nil {
+		t.Fatalf("couldn't create server: %s", err)
+	}
+	ts := httptest.NewTLSServer(s.Handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func loginFrom(t *testing.T, ts *httptest.Server, forwardedFor string) *http.Response {
+	body, err := json.Marshal(LoginParams{Username: "testadmin", Password: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", ts.URL+"/login", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	ts := newTestServer(t, config.Config{
+		RateLimitLogin: config.RateLimit{RequestsPerMinute: 6, Burst: 2},
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+	})
+
+	for i := 0; i < 2; i++ {
+		if res := loginFrom(t, ts, "203.0.113.1"); res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected the login to be attempted, got %d", res.StatusCode)
+		}
+	}
+	res := loginFrom(t, ts, "203.0.113.1")
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") != "10" {
+		t.Fatalf("expected the login to be limited with a Retry-After of 10s, got %d and %q", res.StatusCode, res.Header.Get("Retry-After"))
+	}
+	if res := loginFrom(t, ts, "198.51.100.1, 203.0.113.1"); res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected the addresses set by the client before the proxy not to be trusted, got %d", res.StatusCode)
+	}
+	if res := loginFrom(t, ts, "203.0.113.2"); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected every client to be limited separately, got %d", res.StatusCode)
+	}
+	if res, _, err := get(ts.Client(), ts.URL+"/status"); err != nil || res != http.StatusOK {
+		t.Fatalf("expected the other routes not to be limited, got %d, %v", res, err)
+	}
+}
+
+func TestSubmissionRateLimitAndQuota(t *testing.T) {
+	ts := newTestServer(t, config.Config{
+		RateLimitSubmissions:          config.RateLimit{RequestsPerMinute: 600, Burst: 1},
+		MaxPendingCertificateRequests: 1,
+	})
+	client := ts.Client()
+	var adminToken, nonAdminToken string
+	t.Run("prepare accounts", prepareAccounts(ts.URL, client, &adminToken, &nonAdminToken))
+
+	submit := func(token string, commonName string) int {
+		statusCode, _, err := createCertificateRequest(ts.URL, client, token, CreateCertificateRequestParams{CSR: newTestCSR(t, commonName)})
+		if err != nil {
+			t.Fatalf("couldn't create certificate request: %s", err)
+		}
+		return statusCode
+	}
+	if statusCode := submit(nonAdminToken, "first.example.com"); statusCode != http.StatusCreated {
+		t.Fatalf("expected the certificate request to be created, got %d", statusCode)
+	}
+	if statusCode := submit(nonAdminToken, "second.example.com"); statusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected the submission to be limited, got %d", statusCode)
+	}
+	if statusCode := submit(adminToken, "admin.example.com"); statusCode != http.StatusCreated {
+		t.Fatalf("expected every account to be limited separately, got %d", statusCode)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	body, err := json.Marshal(CreateCertificateRequestParams{CSR: newTestCSR(t, "second.example.com")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", ts.URL+"/api/v1/certificate_requests", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+nonAdminToken)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var response struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") != "" || response.Error != "account has reached its quota of pending certificate requests" {
+		t.Fatalf("expected the quota of the account to be exceeded, got %d: %s", res.StatusCode, response.Error)
+	}
+}
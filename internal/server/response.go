@@ -1,9 +1,16 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"mime"
 	"net/http"
+	"strconv"
+
+	"github.com/canonical/notary/internal/db"
+	"github.com/canonical/notary/internal/export"
 )
 
 // writeJSON is a helper function that writes a JSON response to the http.ResponseWriter
@@ -23,22 +30,202 @@ func writeJSON(w http.ResponseWriter, v any) error {
 	return nil
 }
 
-// writeError is a helper function that logs any error and writes it back as an http response
-func writeError(w http.ResponseWriter, status int, message string) {
-	type errorResponse struct {
-		Error string `json:"error"`
+// problemContentType is the media type of error responses, which are problem details objects as described by RFC 7807.
+const problemContentType = "application/problem+json"
+
+// Codes identify the cause of an error response, so that clients can react to it without parsing its message.
+// They are stable: new codes can be added, but existing ones are neither renamed nor reused for other causes.
+const (
+	codeBadRequest      = "bad_request"
+	codeUnauthorized    = "unauthorized"
+	codeForbidden       = "forbidden"
+	codeNotFound        = "not_found"
+	codeConflict        = "conflict"
+	codeRateLimited     = "rate_limited"
+	codeInternalError   = "internal_error"
+	codeUnavailable     = "unavailable"
+	codeInvalidJSON     = "invalid_json"
+	codeMissingField    = "missing_field"
+	codeWeakPassword    = "weak_password"
+	codeBadCredentials  = "invalid_credentials"
+	codeAlreadyExists   = "already_exists"
+	codeAdminAccount    = "admin_account"
+	codeInvalidCSR      = "invalid_csr"
+	codeInvalidCert     = "invalid_certificate"
+	codeInvalidChain    = "invalid_chain"
+	codeCertMismatch    = "certificate_mismatch"
+	codeNotIssued       = "not_issued"
+	codeAlreadyRenewed  = "already_renewed"
+	codeAlreadyDone     = "already_processed"
+	codeImported        = "imported_certificate"
+	codeQuotaExceeded   = "quota_exceeded"
+	codeInvalidProfile  = "invalid_profile"
+	codeProfileNotFound = "profile_not_found"
+	codeProfileRequired = "profile_required"
+	codeProfileInUse    = "profile_in_use"
+	codeCAProfile       = "ca_profile_not_allowed"
+	codeNoSigningCA     = "signing_unavailable"
+	codeInvalidBulkSize = "invalid_bulk_size"
+	codeInvalidFormat   = "invalid_format"
+	codeNoIssuers       = "no_issuers"
+)
+
+// statusCodes are the codes of the errors that have no more specific cause than their status.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          codeBadRequest,
+	http.StatusUnauthorized:        codeUnauthorized,
+	http.StatusForbidden:           codeForbidden,
+	http.StatusNotFound:            codeNotFound,
+	http.StatusConflict:            codeConflict,
+	http.StatusTooManyRequests:     codeRateLimited,
+	http.StatusInternalServerError: codeInternalError,
+	http.StatusServiceUnavailable:  codeUnavailable,
+}
+
+// ProblemField is a problem with a single field of the request body.
+type ProblemField struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// ProblemResponse is the body of error responses. Code identifies the cause of the error, and Fields the
+// fields of the request body that caused it, if any. Error repeats Detail for the clients written before
+// error responses were problem details objects.
+type ProblemResponse struct {
+	Type   string         `json:"type"`
+	Title  string         `json:"title"`
+	Status int            `json:"status"`
+	Detail string         `json:"detail"`
+	Code   string         `json:"code"`
+	Fields []ProblemField `json:"fields,omitempty"`
+	Error  string         `json:"error"`
+}
+
+// problem is an error to report to the client, with the status and code of its response.
+type problem struct {
+	status  int
+	code    string
+	message string
+	fields  []ProblemField
+}
+
+func (p *problem) Error() string {
+	return p.message
+}
+
+// newProblem returns a problem with the given status, code and message.
+// An empty code is replaced by the code of the status.
+func newProblem(status int, code string, message string) *problem {
+	if code == "" {
+		code = statusCodes[status]
+		if code == "" {
+			code = codeBadRequest
+			if status >= http.StatusInternalServerError {
+				code = codeInternalError
+			}
+		}
+	}
+	return &problem{status: status, code: code, message: message}
+}
+
+// fieldProblem returns a problem caused by a single field of the request body, if field isn't empty.
+func fieldProblem(status int, code string, field string, message string) *problem {
+	p := newProblem(status, code, message)
+	if field != "" {
+		p.fields = []ProblemField{{Field: field, Detail: message}}
+	}
+	return p
+}
+
+var (
+	errInvalidJSON   = newProblem(http.StatusBadRequest, codeInvalidJSON, "Invalid JSON format")
+	errNotFound      = newProblem(http.StatusNotFound, codeNotFound, "Not Found")
+	errInternalError = newProblem(http.StatusInternalServerError, codeInternalError, "Internal Error")
+	errNoSigningCA   = newProblem(http.StatusBadRequest, codeNoSigningCA, "signing is not available: no signing CA is configured")
+	errCAProfile     = newProblem(http.StatusBadRequest, codeCAProfile, "CA profiles are not allowed")
+	errAlreadyDone   = newProblem(http.StatusConflict, codeAlreadyDone, "certificate request already has a certificate or was rejected")
+)
+
+// dbProblem returns the problem to report for an error of the database, whose message is only reported when it
+// is caused by the request. The field is the field of the request body that holds the CSR or the certificate
+// the error is about, if any.
+func dbProblem(ctx context.Context, err error, field string) *problem {
+	var fieldErr *db.FieldError
+	switch {
+	case errors.Is(err, db.ErrIdNotFound):
+		return errNotFound
+	case errors.Is(err, db.ErrQuotaExceeded):
+		return newProblem(http.StatusTooManyRequests, codeQuotaExceeded, err.Error())
+	case errors.Is(err, db.ErrAlreadyRenewed):
+		return newProblem(http.StatusConflict, codeAlreadyRenewed, "certificate request was already renewed")
+	case errors.Is(err, db.ErrProfileInUse):
+		return newProblem(http.StatusConflict, codeProfileInUse, "profile is in use by certificate requests")
+	case errors.Is(err, db.ErrProfileNotFound):
+		return fieldProblem(http.StatusBadRequest, codeProfileNotFound, "profile_id", "certificate profile not found")
+	case errors.Is(err, db.ErrNotIssued):
+		return newProblem(http.StatusBadRequest, codeNotIssued, "certificate request has no issued certificate to renew")
+	case errors.Is(err, db.ErrImported):
+		return newProblem(http.StatusBadRequest, codeImported, err.Error())
+	case errors.Is(err, db.ErrInvalidProfile) && errors.As(err, &fieldErr):
+		return fieldProblem(http.StatusBadRequest, codeInvalidProfile, fieldErr.Field, err.Error())
+	case errors.Is(err, db.ErrInvalidProfile):
+		return newProblem(http.StatusBadRequest, codeInvalidProfile, err.Error())
+	case errors.Is(err, db.ErrInvalidCSR):
+		return fieldProblem(http.StatusBadRequest, codeInvalidCSR, "csr", err.Error())
+	case errors.Is(err, db.ErrCertificateMismatch):
+		return fieldProblem(http.StatusBadRequest, codeCertMismatch, field, err.Error())
+	case errors.Is(err, db.ErrInvalidChain):
+		return fieldProblem(http.StatusBadRequest, codeInvalidChain, field, err.Error())
+	case errors.Is(err, db.ErrInvalidCertificate):
+		return fieldProblem(http.StatusBadRequest, codeInvalidCert, field, err.Error())
+	}
+	slog.ErrorContext(ctx, "Request failed", "error", err)
+	return errInternalError
+}
+
+// writeError is a helper function that logs any error, with the fields of the request, and writes it back as an http response
+// with the code of its status
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeProblem(w, r, newProblem(status, "", message))
+}
+
+// writeProblem logs a problem, with the fields of the request, and writes it back as a problem details response
+func writeProblem(w http.ResponseWriter, r *http.Request, p *problem) {
+	level := slog.LevelInfo
+	if p.status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	slog.Log(r.Context(), level, "Error response", "status", p.status, "code", p.code, "message", p.message)
+	resp := ProblemResponse{
+		Type:   "about:blank",
+		Title:  http.StatusText(p.status),
+		Status: p.status,
+		Detail: p.message,
+		Code:   p.code,
+		Fields: p.fields,
+		Error:  p.message,
 	}
-	log.Println(message)
-	resp := errorResponse{Error: message}
 	respBytes, err := json.Marshal(&resp)
 	if err != nil {
-		log.Printf("Error marshalling error response: %v", err)
+		slog.ErrorContext(r.Context(), "Error marshalling error response", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(status)
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.status)
 	_, err = w.Write(respBytes)
 	if err != nil {
-		log.Printf("Error writing error response: %v", err)
+		slog.ErrorContext(r.Context(), "Error writing error response", "error", err)
+	}
+}
+
+// writeFile is a helper function that writes data in the given export format as a file attachment
+func writeFile(w http.ResponseWriter, r *http.Request, name string, format string, data []byte) {
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": export.Filename(name, format)}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing file response", "error", err)
 	}
 }
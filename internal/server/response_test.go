@@ -0,0 +1,122 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type ProblemField struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+type ProblemResponse struct {
+	Type   string         `json:"type"`
+	Title  string         `json:"title"`
+	Status int            `json:"status"`
+	Detail string         `json:"detail"`
+	Code   string         `json:"code"`
+	Fields []ProblemField `json:"fields"`
+	Error  string         `json:"error"`
+}
+
+func TestProblemResponses(t *testing.T) {
+	ts, _, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+
+	var adminToken string
+	var nonAdminToken string
+	t.Run("prepare user accounts and tokens", prepareAccounts(ts.URL, client, &adminToken, &nonAdminToken))
+
+	readFile := func(name string) string {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("cannot read file: %s", err)
+		}
+		return string(data)
+	}
+	csr1, cert2, issuerCert := readFile("csr1.pem"), readFile("csr2_cert.pem"), readFile("issuer_cert.pem")
+	body := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if statusCode, _, err := createCertificateRequest(ts.URL, client, adminToken, CreateCertificateRequestParams{CSR: csr1}); err != nil || statusCode != http.StatusCreated {
+		t.Fatalf("couldn't create certificate request: %d, %v", statusCode, err)
+	}
+
+	cases := []struct {
+		desc   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		code   string
+		field  string
+	}{
+		{"invalid JSON", "POST", "/api/v1/certificate_requests", adminToken, "{", http.StatusBadRequest, "invalid_json", ""},
+		{"missing CSR", "POST", "/api/v1/certificate_requests", adminToken, body(CreateCertificateRequestParams{}), http.StatusBadRequest, "missing_field", "csr"},
+		{"invalid CSR", "POST", "/api/v1/certificate_requests", adminToken, body(CreateCertificateRequestParams{CSR: "invalid"}), http.StatusBadRequest, "invalid_csr", "csr"},
+		{"duplicate CSR", "POST", "/api/v1/certificate_requests", adminToken, body(CreateCertificateRequestParams{CSR: csr1}), http.StatusBadRequest, "already_exists", "csr"},
+		{"mismatched certificate", "POST", "/api/v1/certificate_requests/1/certificate", adminToken, body(CreateCertificateParams{Certificate: cert2 + "\n" + issuerCert}), http.StatusBadRequest, "certificate_mismatch", "certificate"},
+		{"invalid chain", "POST", "/api/v1/certificate_requests/1/certificate", adminToken, body(CreateCertificateParams{Certificate: issuerCert + "\n" + cert2}), http.StatusBadRequest, "invalid_chain", "certificate"},
+		{"unknown certificate request", "DELETE", "/api/v1/certificate_requests/100/certificate", adminToken, "", http.StatusNotFound, "not_found", ""},
+		{"invalid profile", "POST", "/api/v1/certificate_profiles", adminToken, `{"name": "p"}`, http.StatusBadRequest, "invalid_profile", "validity_days"},
+		{"weak password", "POST", "/api/v1/accounts", adminToken, body(CreateAccountParams{Username: "weak", Password: "weak"}), http.StatusBadRequest, "weak_password", "password"},
+		{"admin required", "GET", "/api/v1/accounts", nonAdminToken, "", http.StatusForbidden, "forbidden", ""},
+		{"missing token", "GET", "/api/v1/accounts", "", "", http.StatusUnauthorized, "unauthorized", ""},
+		{"wrong password", "POST", "/login", "", body(LoginParams{Username: "testadmin", Password: "wrong"}), http.StatusUnauthorized, "invalid_credentials", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			req, err := http.NewRequest(c.method, ts.URL+c.path, strings.NewReader(c.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.token != "" {
+				req.Header.Set("Authorization", "Bearer "+c.token)
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.status {
+				t.Fatalf("expected status %d, got %d", c.status, res.StatusCode)
+			}
+			if contentType := res.Header.Get("Content-Type"); contentType != "application/problem+json" {
+				t.Fatalf("expected a problem details response, got %q", contentType)
+			}
+			var problem ProblemResponse
+			if err := json.NewDecoder(res.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Code != c.code {
+				t.Fatalf("expected code %q, got %q", c.code, problem.Code)
+			}
+			if problem.Status != c.status || problem.Title != http.StatusText(c.status) || problem.Type != "about:blank" {
+				t.Fatalf("unexpected problem details %+v", problem)
+			}
+			if problem.Detail == "" || problem.Error != problem.Detail {
+				t.Fatalf("expected the error to repeat the detail %q, got %q", problem.Detail, problem.Error)
+			}
+			if c.field == "" && len(problem.Fields) != 0 {
+				t.Fatalf("expected no fields, got %+v", problem.Fields)
+			}
+			if c.field != "" && (len(problem.Fields) != 1 || problem.Fields[0].Field != c.field) {
+				t.Fatalf("expected field %q, got %+v", c.field, problem.Fields)
+			}
+		})
+	}
+}
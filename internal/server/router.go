@@ -2,6 +2,7 @@ package server
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/canonical/notary/internal/metrics"
 )
@@ -10,14 +11,39 @@ import (
 // access to it, and takes an http.Handler that will be used to handle metrics.
 // then builds and returns it for a server to consume
 func NewHandler(config *HandlerConfig) http.Handler {
-	apiV1Router := http.NewServeMux()
+	return newRouter(config, metrics.NewMetricsSubsystem(config.DB), true, nil)
+}
+
+// newRouter returns the handler of the API and of the frontend. The metrics endpoint is only mounted when
+// serveMetrics is set, as metrics can be served on a separate listener instead. The patterns of the routes are
+// recorded in routes unless it is nil.
+func newRouter(config *HandlerConfig, m *metrics.PrometheusMetrics, serveMetrics bool, routes *routeRecorder) http.Handler {
+	limits := config.rateLimits
+	apiV1Router := routes.newMux("/api/v1")
 	apiV1Router.HandleFunc("GET /certificate_requests", adminOrUser(config.JWTSecret, ListCertificateRequests(config)))
-	apiV1Router.HandleFunc("POST /certificate_requests", adminOrUser(config.JWTSecret, CreateCertificateRequest(config)))
+	apiV1Router.HandleFunc("POST /certificate_requests", rateLimited(limits.submissions, config.JWTSecret, adminOrUser(config.JWTSecret, CreateCertificateRequest(config))))
+	apiV1Router.HandleFunc("POST /certificate_requests/bulk", rateLimited(limits.submissions, config.JWTSecret, adminOrUser(config.JWTSecret, BulkCreateCertificateRequests(config))))
+	apiV1Router.HandleFunc("POST /certificate_requests/bulk/delete", adminOrUser(config.JWTSecret, BulkDeleteCertificateRequests(config)))
+	apiV1Router.HandleFunc("POST /certificate_requests/bulk/reject", adminOrUser(config.JWTSecret, BulkRejectCertificateRequests(config)))
+	apiV1Router.HandleFunc("POST /certificate_requests/bulk/sign", adminOrUser(config.JWTSecret, BulkSignCertificateRequests(config)))
 	apiV1Router.HandleFunc("GET /certificate_requests/{id}", adminOrUser(config.JWTSecret, GetCertificateRequest(config)))
 	apiV1Router.HandleFunc("DELETE /certificate_requests/{id}", adminOrUser(config.JWTSecret, DeleteCertificateRequest(config)))
+	apiV1Router.HandleFunc("POST /certificate_requests/{id}/renew", rateLimited(limits.submissions, config.JWTSecret, adminOrUser(config.JWTSecret, RenewCertificateRequest(config))))
+	apiV1Router.HandleFunc("GET /certificate_requests/{id}/current", adminOrUser(config.JWTSecret, GetCurrentCertificateRequest(config)))
 	apiV1Router.HandleFunc("POST /certificate_requests/{id}/certificate", adminOrUser(config.JWTSecret, CreateCertificate(config)))
 	apiV1Router.HandleFunc("POST /certificate_requests/{id}/certificate/reject", adminOrUser(config.JWTSecret, RejectCertificate(config)))
 	apiV1Router.HandleFunc("DELETE /certificate_requests/{id}/certificate", adminOrUser(config.JWTSecret, DeleteCertificate(config)))
+	apiV1Router.HandleFunc("POST /certificate_requests/{id}/certificate/sign", adminOrUser(config.JWTSecret, SignCertificateRequest(config)))
+	apiV1Router.HandleFunc("GET /certificate_requests/{id}/certificate/download", adminOrUser(config.JWTSecret, DownloadCertificate(config)))
+	apiV1Router.HandleFunc("GET /certificate_requests/{id}/certificate/truststore", adminOrUser(config.JWTSecret, DownloadTrustStore(config)))
+
+	apiV1Router.HandleFunc("POST /certificates/import", adminOrUser(config.JWTSecret, ImportCertificates(config)))
+
+	apiV1Router.HandleFunc("GET /certificate_profiles", adminOrUser(config.JWTSecret, ListCertificateProfiles(config)))
+	apiV1Router.HandleFunc("POST /certificate_profiles", adminOnly(config.JWTSecret, CreateCertificateProfile(config)))
+	apiV1Router.HandleFunc("GET /certificate_profiles/{id}", adminOrUser(config.JWTSecret, GetCertificateProfile(config)))
+	apiV1Router.HandleFunc("PUT /certificate_profiles/{id}", adminOnly(config.JWTSecret, UpdateCertificateProfile(config)))
+	apiV1Router.HandleFunc("DELETE /certificate_profiles/{id}", adminOnly(config.JWTSecret, DeleteCertificateProfile(config)))
 
 	apiV1Router.HandleFunc("GET /accounts", adminOnly(config.JWTSecret, ListAccounts(config)))
 	apiV1Router.HandleFunc("POST /accounts", adminOrFirstUser(config.JWTSecret, config.DB, CreateAccount(config)))
@@ -25,25 +51,68 @@ func NewHandler(config *HandlerConfig) http.Handler {
 	apiV1Router.HandleFunc("DELETE /accounts/{id}", adminOnly(config.JWTSecret, DeleteAccount(config)))
 	apiV1Router.HandleFunc("POST /accounts/{id}/change_password", adminOrMe(config.JWTSecret, ChangeAccountPassword(config)))
 
-	m := metrics.NewMetricsSubsystem(config.DB)
+	apiV1Router.HandleFunc("GET /openapi.json", GetOpenAPIDocument(config))
+
 	frontendHandler := newFrontendFileServer()
-	ctx := middlewareContext{
-		jwtSecret: config.JWTSecret,
-	}
-	apiMiddlewareStack := createMiddlewareStack(
-		metricsMiddleware(m),
-		loggingMiddleware(&ctx),
-	)
-	metricsMiddlewareStack := createMiddlewareStack(
-		metricsMiddleware(m),
-	)
-
-	router := http.NewServeMux()
-	router.HandleFunc("POST /login", Login(config))
+
+	router := routes.newMux("")
+	router.HandleFunc("POST /login", rateLimited(limits.login, config.JWTSecret, Login(config)))
 	router.HandleFunc("GET /status", GetStatus(config))
-	router.Handle("/metrics", m.Handler)
-	router.Handle("/api/v1/", http.StripPrefix("/api/v1", apiMiddlewareStack(apiV1Router)))
-	router.Handle("/", metricsMiddlewareStack(frontendHandler))
+	router.HandleFunc("GET /healthz", GetHealth(config))
+	router.HandleFunc("GET /readyz", GetReadiness(config, false))
+	if serveMetrics {
+		router.Handle("/metrics", m.Handler)
+	}
+	router.HandleFunc("/api/v1/", rateLimited(limits.api, config.JWTSecret, http.StripPrefix("/api/v1", routeMiddleware("/api/v1", apiV1Router.ServeMux)).ServeHTTP))
+	router.Handle("/", frontendHandler)
+
+	return requestMiddlewareStack(metricsMiddleware(m)(routeMiddleware("", router.ServeMux)))
+}
+
+// requestMiddlewareStack traces every request, gives it an ID and logs it once handled.
+var requestMiddlewareStack = createMiddlewareStack(
+	tracingMiddleware(),
+	requestMiddleware(),
+	loggingMiddleware(),
+)
 
-	return router
+// routeRecorder records the patterns of the routes registered on the muxes it creates, so that the routes of a
+// server can be listed whichever listener serves them.
+type routeRecorder struct {
+	patterns []string
+}
+
+// newMux returns a mux whose routes are recorded with the given prefix, which is where the mux is mounted.
+// A nil recorder creates a mux that records nothing.
+func (r *routeRecorder) newMux(prefix string) recordingMux {
+	return recordingMux{ServeMux: http.NewServeMux(), recorder: r, prefix: prefix}
+}
+
+// recordingMux is a ServeMux that records the patterns registered on it.
+type recordingMux struct {
+	*http.ServeMux
+	recorder *routeRecorder
+	prefix   string
+}
+
+func (m recordingMux) Handle(pattern string, handler http.Handler) {
+	m.record(pattern)
+	m.ServeMux.Handle(pattern, handler)
+}
+
+func (m recordingMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.record(pattern)
+	m.ServeMux.HandleFunc(pattern, handler)
+}
+
+func (m recordingMux) record(pattern string) {
+	if m.recorder == nil {
+		return
+	}
+	if method, path, found := strings.Cut(pattern, " "); found {
+		pattern = method + " " + m.prefix + path
+	} else {
+		pattern = m.prefix + pattern
+	}
+	m.recorder.patterns = append(m.recorder.patterns, pattern)
 }
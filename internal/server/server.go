@@ -2,23 +2,104 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/canonical/notary/internal/ca"
+	"github.com/canonical/notary/internal/config"
 	"github.com/canonical/notary/internal/db"
+	"github.com/canonical/notary/internal/metrics"
+	"github.com/canonical/notary/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// CertificateWatchInterval is how often the files of the TLS certificate of the server are checked for changes.
+const CertificateWatchInterval = 10 * time.Second
+
+// BootstrapRenewalInterval is how often a serving certificate issued by the internal CA is checked for renewal.
+const BootstrapRenewalInterval = time.Hour
+
 type HandlerConfig struct {
 	DB                      *db.Database
 	SendPebbleNotifications bool
 	JWTSecret               []byte
+	SigningCA               *ca.CA
+
+	// jobs records the health of the background jobs of the server. It is nil when the handlers aren't
+	// served by a Server, and then no job is reported.
+	jobs *jobStatuses
+	// rateLimits limits the requests of every client to the groups of routes. Nothing is limited when the handlers
+	// aren't served by a Server.
+	rateLimits rateLimits
+
+	// mu guards the fields that are replaced when the config of a running server is reloaded.
+	mu sync.RWMutex
+}
+
+func (env *HandlerConfig) signingCA() *ca.CA {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	return env.SigningCA
+}
+
+func (env *HandlerConfig) pebbleNotifications() bool {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	return env.SendPebbleNotifications
+}
+
+// Server is the Notary HTTP server. Its TLS certificate and the reloadable fields of its config
+// can be replaced while it runs, without dropping connections.
+type Server struct {
+	*http.Server
+	// metricsServer and adminServer are the optional metrics listener and admin socket, which are nil when
+	// they aren't configured.
+	metricsServer *http.Server
+	adminServer   *http.Server
+	metrics       *metrics.PrometheusMetrics
+	// routes records the routes of the public port and of the metrics listener.
+	routes *routeRecorder
+
+	env         *HandlerConfig
+	conf        config.Config
+	certificate atomic.Pointer[tls.Certificate]
+	// reloadMu serializes reloads, so that a certificate change and a config reload don't interleave.
+	reloadMu sync.Mutex
+
+	// The background jobs are started by ListenAndServe and run until jobsCtx is cancelled by stopJobs.
+	// jobsMu keeps jobs from being started once they were stopped.
+	jobsCtx     context.Context
+	stopJobs    context.CancelFunc
+	jobsMu      sync.Mutex
+	jobsStopped bool
+	jobs        sync.WaitGroup
 }
 
-func SendPebbleNotification(key, request_id string) error {
+// tracerName is the name of the tracer of the spans of the server, other than those of HTTP requests.
+const tracerName = "github.com/canonical/notary/internal/server"
+
+// SendPebbleNotification sends a pebble notice with the given key about the given certificate request.
+// The notification is traced as a child of the span of the context.
+func SendPebbleNotification(ctx context.Context, key, request_id string) (err error) {
+	_, span := tracing.Tracer(tracerName).Start(ctx, "pebble notify", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("notary.notice.key", key), attribute.String("notary.certificate_request.id", request_id)))
+	defer func() { tracing.End(span, err) }()
 	cmd := exec.Command("pebble", "notify", key, fmt.Sprintf("request_id=%s", request_id))
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("couldn't execute a pebble notify: %w", err)
@@ -35,37 +116,342 @@ func generateJWTSecret() ([]byte, error) {
 }
 
 // New creates an environment and an http server with handlers that Go can start listening to
-func New(port int, cert []byte, key []byte, dbPath string, pebbleNotificationsEnabled bool) (*http.Server, error) {
-	serverCerts, err := tls.X509KeyPair(cert, key)
+func New(conf config.Config) (*Server, error) {
+	if err := bootstrapCertificate(&conf, time.Now()); err != nil {
+		return nil, err
+	}
+	serverCerts, err := tls.X509KeyPair(conf.Cert, conf.Key)
 	if err != nil {
 		return nil, err
 	}
-	db, err := db.NewDatabase(dbPath)
+	db, err := db.NewDatabase(conf.DBPath)
 	if err != nil {
 		return nil, err
 	}
-
-	jwtSecret, err := generateJWTSecret()
+	if err := db.SetCSRPolicy(conf.CSRPolicy); err != nil {
+		return nil, err
+	}
+	signingCA, err := loadSigningCA(conf)
 	if err != nil {
 		return nil, err
 	}
+
+	jwtSecret := conf.JWTSecret
+	if jwtSecret == nil {
+		jwtSecret, err = generateJWTSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
 	env := &HandlerConfig{}
 	env.DB = db
-	env.SendPebbleNotifications = pebbleNotificationsEnabled
+	env.SendPebbleNotifications = conf.PebbleNotificationsEnabled
 	env.JWTSecret = jwtSecret
-	router := NewHandler(env)
-
-	s := &http.Server{
-		Addr: fmt.Sprintf(":%d", port),
+	env.SigningCA = signingCA
+	env.jobs = newJobStatuses()
+	env.rateLimits = newRateLimits(conf)
+	db.SetPendingRequestQuota(conf.MaxPendingCertificateRequests)
+	m := metrics.NewMetricsSubsystem(db)
+	if conf.MetricsCertificateExpiryLimit != 0 {
+		m.ExportCertificateExpiry(conf.MetricsCertificateExpiryLimit)
+	}
+	s := &Server{env: env, conf: conf, metrics: m, routes: &routeRecorder{}}
+	router := newRouter(env, m, conf.MetricsPort == 0, s.routes)
+	s.jobsCtx, s.stopJobs = context.WithCancel(context.Background())
+	s.certificate.Store(&serverCerts)
+	s.Server = &http.Server{
+		Addr: net.JoinHostPort(conf.BindAddress, strconv.Itoa(conf.Port)),
 
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
+		ReadTimeout:    conf.ReadTimeout,
+		WriteTimeout:   conf.WriteTimeout,
+		IdleTimeout:    idleTimeout(conf),
 		Handler:        router,
-		MaxHeaderBytes: 1 << 20,
+		MaxHeaderBytes: conf.MaxHeaderBytes,
 		TLSConfig: &tls.Config{
-			Certificates: []tls.Certificate{serverCerts},
+			GetCertificate:   s.getCertificate,
+			MinVersion:       conf.TLSMinVersion,
+			CipherSuites:     conf.TLSCipherSuites,
+			CurvePreferences: conf.TLSCurvePreferences,
+			NextProtos:       conf.TLSNextProtos,
 		},
 	}
+	if !slices.Contains(conf.TLSNextProtos, "h2") {
+		// A non-nil map keeps net/http from enabling HTTP/2.
+		s.Server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	if conf.MetricsPort != 0 {
+		s.metricsServer, err = s.newMetricsServer(conf, m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.AdminSocketPath != "" {
+		s.adminServer = &http.Server{
+			Addr:           conf.AdminSocketPath,
+			ReadTimeout:    conf.ReadTimeout,
+			WriteTimeout:   conf.WriteTimeout,
+			IdleTimeout:    idleTimeout(conf),
+			Handler:        localAdmin(newRouter(env, m, true, nil)),
+			MaxHeaderBytes: conf.MaxHeaderBytes,
+		}
+	}
 
 	return s, nil
 }
+
+// idleTimeout returns the idle timeout of the http server, for which net/http uses the read timeout when it is 0,
+// while 0 disables the timeout in the config.
+func idleTimeout(conf config.Config) time.Duration {
+	if conf.IdleTimeout == 0 {
+		return -1
+	}
+	return conf.IdleTimeout
+}
+
+func loadSigningCA(conf config.Config) (*ca.CA, error) {
+	if conf.SigningCACert == nil {
+		return nil, nil
+	}
+	signingCA, err := ca.Load(conf.SigningCACert, conf.SigningCAKey)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load signing CA: %w", err)
+	}
+	signingCA.AllowCAProfiles = conf.AllowCAProfiles
+	return signingCA, nil
+}
+
+// getCertificate returns the current TLS certificate of the server for every handshake,
+// so that new connections use a reloaded certificate while existing ones are kept.
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.certificate.Load(), nil
+}
+
+// Routes returns the patterns of the routes served on the public port and on the metrics listener, sorted and
+// without duplicates. The patterns that mount a whole subtree, such as the API and the frontend, end with a slash.
+func (s *Server) Routes() []string {
+	routes := slices.Clone(s.routes.patterns)
+	slices.Sort(routes)
+	return slices.Compact(routes)
+}
+
+// Reload applies a new config to the running server: its TLS certificate, CSR policy, signing CA,
+// allow_ca_profiles, pebble_notifications and quotas. Everything is validated before anything is applied,
+// so that an invalid config leaves the server unchanged. Changes to the other fields need a restart,
+// and are only logged.
+func (s *Server) Reload(conf config.Config) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	if err := bootstrapCertificate(&conf, time.Now()); err != nil {
+		return err
+	}
+	certificate, err := tls.X509KeyPair(conf.Cert, conf.Key)
+	if err != nil {
+		return fmt.Errorf("invalid TLS certificate: %w", err)
+	}
+	if err := conf.CSRPolicy.Validate(); err != nil {
+		return fmt.Errorf("invalid csr policy: %w", err)
+	}
+	signingCA, err := loadSigningCA(conf)
+	if err != nil {
+		return err
+	}
+	for _, field := range s.restartRequiredChanges(conf) {
+		slog.Warn("Config changes are only applied after a restart", "field", field)
+	}
+
+	s.certificate.Store(&certificate)
+	if err := s.env.DB.SetCSRPolicy(conf.CSRPolicy); err != nil {
+		return err
+	}
+	s.env.DB.SetPendingRequestQuota(conf.MaxPendingCertificateRequests)
+	s.env.mu.Lock()
+	s.env.SigningCA = signingCA
+	s.env.SendPebbleNotifications = conf.PebbleNotificationsEnabled
+	s.env.mu.Unlock()
+	s.conf.Cert, s.conf.Key = conf.Cert, conf.Key
+	s.conf.CertPath, s.conf.KeyPath = conf.CertPath, conf.KeyPath
+	s.conf.TLSBootstrapDirectory, s.conf.TLSBootstrapHostnames = conf.TLSBootstrapDirectory, conf.TLSBootstrapHostnames
+	return nil
+}
+
+// restartRequiredChanges lists the fields of the config that differ from the running one but can't be reloaded.
+func (s *Server) restartRequiredChanges(conf config.Config) []string {
+	var fields []string
+	if conf.Port != s.conf.Port {
+		fields = append(fields, "port")
+	}
+	if conf.BindAddress != s.conf.BindAddress {
+		fields = append(fields, "bind_address")
+	}
+	if conf.TLSMinVersion != s.conf.TLSMinVersion || !slices.Equal(conf.TLSCipherSuites, s.conf.TLSCipherSuites) ||
+		!slices.Equal(conf.TLSCurvePreferences, s.conf.TLSCurvePreferences) || !slices.Equal(conf.TLSNextProtos, s.conf.TLSNextProtos) {
+		fields = append(fields, "tls")
+	}
+	if conf.ReadTimeout != s.conf.ReadTimeout || conf.WriteTimeout != s.conf.WriteTimeout ||
+		conf.IdleTimeout != s.conf.IdleTimeout || conf.MaxHeaderBytes != s.conf.MaxHeaderBytes {
+		fields = append(fields, "http")
+	}
+	if conf.MetricsPort != s.conf.MetricsPort || conf.MetricsBindAddress != s.conf.MetricsBindAddress ||
+		!bytes.Equal(conf.MetricsClientCA, s.conf.MetricsClientCA) || conf.MetricsCertificateExpiryLimit != s.conf.MetricsCertificateExpiryLimit {
+		fields = append(fields, "metrics")
+	}
+	if conf.AdminSocketPath != s.conf.AdminSocketPath {
+		fields = append(fields, "admin_socket")
+	}
+	if conf.DBPath != s.conf.DBPath {
+		fields = append(fields, "db_path")
+	}
+	if conf.BackupDirectory != s.conf.BackupDirectory || conf.BackupInterval != s.conf.BackupInterval ||
+		conf.BackupRetention != s.conf.BackupRetention {
+		fields = append(fields, "backup")
+	}
+	if !bytes.Equal(conf.JWTSecret, s.conf.JWTSecret) {
+		fields = append(fields, "jwt_secret")
+	}
+	if conf.ShutdownTimeout != s.conf.ShutdownTimeout {
+		fields = append(fields, "shutdown_timeout")
+	}
+	if conf.LogFormat != s.conf.LogFormat {
+		fields = append(fields, "logging.format")
+	}
+	if conf.TracingEndpoint != s.conf.TracingEndpoint {
+		fields = append(fields, "tracing")
+	}
+	if conf.RateLimitLogin != s.conf.RateLimitLogin || conf.RateLimitSubmissions != s.conf.RateLimitSubmissions ||
+		conf.RateLimitAPI != s.conf.RateLimitAPI || !slices.Equal(conf.TrustedProxies, s.conf.TrustedProxies) {
+		fields = append(fields, "rate_limit")
+	}
+	return fields
+}
+
+// WatchCertificate checks the certificate and key files of the server at every interval, and reloads
+// the TLS certificate when they change. A new pair that isn't valid, such as when only one of the files
+// was replaced yet, is logged once and the current certificate is kept. It runs until the context is done.
+func (s *Server) WatchCertificate(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var failedCert, failedKey []byte
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.reloadMu.Lock()
+		certPath, keyPath := s.conf.CertPath, s.conf.KeyPath
+		s.reloadMu.Unlock()
+		if certPath == "" || keyPath == "" {
+			continue
+		}
+		cert, certErr := os.ReadFile(certPath)
+		key, keyErr := os.ReadFile(keyPath)
+		if err := errors.Join(certErr, keyErr); err != nil {
+			slog.Error("Couldn't read TLS certificate", "error", err)
+			s.env.jobs.reporter(certificateWatchJob)(err)
+			continue
+		}
+		s.reloadMu.Lock()
+		unchanged := bytes.Equal(cert, s.conf.Cert) && bytes.Equal(key, s.conf.Key)
+		s.reloadMu.Unlock()
+		if unchanged {
+			s.env.jobs.reporter(certificateWatchJob)(nil)
+			continue
+		}
+		if bytes.Equal(cert, failedCert) && bytes.Equal(key, failedKey) {
+			continue
+		}
+		if err := s.reloadCertificate(cert, key); err != nil {
+			slog.Error("Couldn't reload TLS certificate, keeping the current one", "error", err)
+			s.env.jobs.reporter(certificateWatchJob)(err)
+			failedCert, failedKey = cert, key
+			continue
+		}
+		s.env.jobs.reporter(certificateWatchJob)(nil)
+		slog.Info("Reloaded TLS certificate")
+	}
+}
+
+// RenewBootstrappedCertificate checks the serving certificate issued by the internal CA at every interval,
+// and renews it before it expires. It does nothing when the TLS certificate of the server is provided
+// in the config. It runs until the context is done.
+func (s *Server) RenewBootstrappedCertificate(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			err := s.renewBootstrappedCertificate(now)
+			if err != nil {
+				slog.Error("Couldn't renew the serving certificate", "error", err)
+			}
+			s.env.jobs.reporter(certificateRenewalJob)(err)
+		}
+	}
+}
+
+// bootstrapCertificate issues the serving certificate from the internal CA if the config uses tls_bootstrap,
+// and reads it into the config. It's done here rather than when validating the config, so that the offline
+// commands don't write any files.
+func bootstrapCertificate(conf *config.Config, now time.Time) error {
+	if conf.TLSBootstrapDirectory == "" {
+		return nil
+	}
+	certPath, keyPath, issued, err := ca.Bootstrap(conf.TLSBootstrapDirectory, conf.TLSBootstrapHostnames, now)
+	if err != nil {
+		return fmt.Errorf("couldn't bootstrap a serving certificate: %w", err)
+	}
+	if issued {
+		slog.Info("Issued a serving certificate from the internal CA", "hostnames", strings.Join(conf.TLSBootstrapHostnames, ", "), "directory", conf.TLSBootstrapDirectory)
+	}
+	cert, err := os.ReadFile(certPath)
+	if err != nil {
+		return err
+	}
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+	conf.Cert, conf.Key, conf.CertPath, conf.KeyPath = cert, key, certPath, keyPath
+	return nil
+}
+
+func (s *Server) renewBootstrappedCertificate(now time.Time) error {
+	s.reloadMu.Lock()
+	directory, hostnames := s.conf.TLSBootstrapDirectory, s.conf.TLSBootstrapHostnames
+	s.reloadMu.Unlock()
+	if directory == "" {
+		return nil
+	}
+	certPath, keyPath, issued, err := ca.Bootstrap(directory, hostnames, now)
+	if err != nil || !issued {
+		return err
+	}
+	cert, err := os.ReadFile(certPath)
+	if err != nil {
+		return err
+	}
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+	if err := s.reloadCertificate(cert, key); err != nil {
+		return err
+	}
+	slog.Info("Renewed the serving certificate")
+	return nil
+}
+
+// reloadCertificate replaces the TLS certificate of the server if the given pair is valid.
+func (s *Server) reloadCertificate(cert []byte, key []byte) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	certificate, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return err
+	}
+	s.certificate.Store(&certificate)
+	s.conf.Cert, s.conf.Key = cert, key
+	return nil
+}
@@ -1,10 +1,24 @@
 package server_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/canonical/notary/internal/ca"
+	"github.com/canonical/notary/internal/config"
 	"github.com/canonical/notary/internal/server"
 )
 
@@ -19,11 +33,16 @@ func TestNewSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatalf("cannot read file: %s", err)
 	}
-	s, err := server.New(8000, []byte(cert), []byte(key), "certs.db", false)
+	s, err := server.New(config.Config{
+		Port:   8000,
+		Cert:   cert,
+		Key:    key,
+		DBPath: filepath.Join(t.TempDir(), "certs.db"),
+	})
 	if err != nil {
 		t.Errorf("Error occured: %s", err)
 	}
-	if s.TLSConfig.Certificates == nil {
+	if s.TLSConfig.GetCertificate == nil {
 		t.Errorf("No certificates were configured for server")
 	}
 }
@@ -34,8 +53,245 @@ func TestInvalidKeyFailure(t *testing.T) {
 	if err != nil {
 		t.Fatalf("cannot read file: %s", err)
 	}
-	_, err = server.New(8000, []byte(cert), []byte{}, "certs.db", false)
+	_, err = server.New(config.Config{
+		Port:   8000,
+		Cert:   cert,
+		Key:    []byte{},
+		DBPath: filepath.Join(t.TempDir(), "certs.db"),
+	})
 	if err == nil {
 		t.Errorf("No error was thrown for invalid key")
 	}
 }
+
+func newTestKeyPair(t *testing.T, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate key: %s", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("couldn't create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("couldn't marshal key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func servedCommonName(t *testing.T, s *server.Server) string {
+	certificate, err := s.TLSConfig.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("couldn't get certificate: %s", err)
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatalf("couldn't parse certificate: %s", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestReload(t *testing.T) {
+	cert, key := newTestKeyPair(t, "first.example.com")
+	conf := config.Config{
+		Port:   8000,
+		Cert:   cert,
+		Key:    key,
+		DBPath: filepath.Join(t.TempDir(), "certs.db"),
+	}
+	s, err := server.New(conf)
+	if err != nil {
+		t.Fatalf("couldn't create server: %s", err)
+	}
+	if cn := servedCommonName(t, s); cn != "first.example.com" {
+		t.Fatalf("expected the first certificate to be served, got %s", cn)
+	}
+
+	conf.Cert, conf.Key = newTestKeyPair(t, "second.example.com")
+	conf.AllowCAProfiles = true
+	if err := s.Reload(conf); err != nil {
+		t.Fatalf("couldn't reload: %s", err)
+	}
+	if cn := servedCommonName(t, s); cn != "second.example.com" {
+		t.Fatalf("expected the reloaded certificate to be served, got %s", cn)
+	}
+
+	invalid := conf
+	invalid.Cert, _ = newTestKeyPair(t, "third.example.com")
+	if err := s.Reload(invalid); err == nil {
+		t.Fatalf("expected a certificate that doesn't match its key to be refused")
+	}
+	invalid = conf
+	invalid.Cert, invalid.Key = newTestKeyPair(t, "third.example.com")
+	invalid.CSRPolicy.AllowedCurves = []string{"curve25519"}
+	if err := s.Reload(invalid); err == nil {
+		t.Fatalf("expected an invalid csr policy to be refused")
+	}
+	if cn := servedCommonName(t, s); cn != "second.example.com" {
+		t.Fatalf("expected a refused reload to keep the current certificate, got %s", cn)
+	}
+}
+
+func TestWatchCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	cert, key := newTestKeyPair(t, "first.example.com")
+	if err := os.WriteFile(certPath, cert, 0o600); err != nil {
+		t.Fatalf("couldn't write certificate: %s", err)
+	}
+	if err := os.WriteFile(keyPath, key, 0o600); err != nil {
+		t.Fatalf("couldn't write key: %s", err)
+	}
+	s, err := server.New(config.Config{
+		Port:     8000,
+		Cert:     cert,
+		Key:      key,
+		CertPath: certPath,
+		KeyPath:  keyPath,
+		DBPath:   filepath.Join(dir, "certs.db"),
+	})
+	if err != nil {
+		t.Fatalf("couldn't create server: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.WatchCertificate(ctx, 10*time.Millisecond)
+
+	newCert, newKey := newTestKeyPair(t, "second.example.com")
+	if err := os.WriteFile(certPath, newCert, 0o600); err != nil {
+		t.Fatalf("couldn't write certificate: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if cn := servedCommonName(t, s); cn != "first.example.com" {
+		t.Fatalf("expected a certificate without its key to be ignored, got %s", cn)
+	}
+	if err := os.WriteFile(keyPath, newKey, 0o600); err != nil {
+		t.Fatalf("couldn't write key: %s", err)
+	}
+	waitForCommonName(t, s, "second.example.com")
+
+	// A reload that moves the files makes the watcher follow the new ones.
+	movedDir := t.TempDir()
+	conf := config.Config{
+		Port:     8000,
+		CertPath: filepath.Join(movedDir, "cert.pem"),
+		KeyPath:  filepath.Join(movedDir, "key.pem"),
+		DBPath:   filepath.Join(dir, "certs.db"),
+	}
+	conf.Cert, conf.Key = newTestKeyPair(t, "third.example.com")
+	if err := s.Reload(conf); err != nil {
+		t.Fatalf("couldn't reload: %s", err)
+	}
+	lastCert, lastKey := newTestKeyPair(t, "fourth.example.com")
+	if err := os.WriteFile(conf.CertPath, lastCert, 0o600); err != nil {
+		t.Fatalf("couldn't write certificate: %s", err)
+	}
+	if err := os.WriteFile(conf.KeyPath, lastKey, 0o600); err != nil {
+		t.Fatalf("couldn't write key: %s", err)
+	}
+	waitForCommonName(t, s, "fourth.example.com")
+}
+
+func waitForCommonName(t *testing.T, s *server.Server, commonName string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for servedCommonName(t, s) != commonName {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to be served, got %s", commonName, servedCommonName(t, s))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRenewBootstrappedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	hostnames := []string{"notary.example.com"}
+	s, err := server.New(config.Config{
+		Port:                  8000,
+		DBPath:                filepath.Join(dir, "certs.db"),
+		TLSBootstrapDirectory: dir,
+		TLSBootstrapHostnames: hostnames,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create server: %s", err)
+	}
+	served, _ := s.TLSConfig.GetCertificate(nil)
+	first := served.Certificate[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.RenewBootstrappedCertificate(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	// The renewal must be stopped before the directory it writes to is removed.
+	defer func() {
+		cancel()
+		<-done
+	}()
+	if err := os.Remove(filepath.Join(dir, ca.BootstrapCertFile)); err != nil {
+		t.Fatalf("couldn't remove certificate: %s", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		served, _ := s.TLSConfig.GetCertificate(nil)
+		if !bytes.Equal(served.Certificate[0], first) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the serving certificate wasn't issued again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cn := servedCommonName(t, s); cn != "notary.example.com" {
+		t.Fatalf("unexpected common name %s", cn)
+	}
+}
+
+func TestListenerSettings(t *testing.T) {
+	cert, key := newTestKeyPair(t, "notary.example.com")
+	s, err := server.New(config.Config{
+		Port:           0,
+		BindAddress:    "127.0.0.1",
+		Cert:           cert,
+		Key:            key,
+		DBPath:         filepath.Join(t.TempDir(), "certs.db"),
+		TLSMinVersion:  tls.VersionTLS13,
+		TLSNextProtos:  []string{"http/1.1"},
+		ReadTimeout:    5 * time.Second,
+		MaxHeaderBytes: 4096,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create server: %s", err)
+	}
+	if s.Addr != "127.0.0.1:0" || s.ReadTimeout != 5*time.Second || s.WriteTimeout != 0 || s.IdleTimeout >= 0 || s.MaxHeaderBytes != 4096 {
+		t.Fatalf("unexpected listener settings: %s, %s, %s, %s, %d", s.Addr, s.ReadTimeout, s.WriteTimeout, s.IdleTimeout, s.MaxHeaderBytes)
+	}
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		t.Fatalf("couldn't listen: %s", err)
+	}
+	go s.ServeTLS(ln, "", "")
+	defer s.Close()
+
+	if conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}); err == nil {
+		conn.Close()
+		t.Fatalf("expected a TLS 1.2 handshake to fail")
+	}
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2", "http/1.1"}})
+	if err != nil {
+		t.Fatalf("couldn't connect: %s", err)
+	}
+	defer conn.Close()
+	if protocol := conn.ConnectionState().NegotiatedProtocol; protocol != "http/1.1" {
+		t.Fatalf("expected HTTP/2 to be disabled, negotiated %q", protocol)
+	}
+}
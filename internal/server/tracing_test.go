@@ -0,0 +1,116 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/canonical/notary/internal/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordSpans records the spans ended during the test in memory. It must be called before the server is
+// created, as the server gets its tracer when it is created.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracing.Install(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background()) //nolint:errcheck
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+	return exporter
+}
+
+// waitForSpan returns the span with the given name, waiting for it as the span of a request only ends after
+// its response is sent.
+func waitForSpan(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, span := range exporter.GetSpans() {
+			if span.Name == name {
+				return span
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("span %q wasn't recorded", name)
+	return tracetest.SpanStub{}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := recordSpans(t)
+	ts, _, err := setupServer()
+	if err != nil {
+		t.Fatalf("couldn't create test server: %s", err)
+	}
+	defer ts.Close()
+	client := ts.Client()
+	var adminToken, nonAdminToken string
+	t.Run("prepare accounts", prepareAccounts(ts.URL, client, &adminToken, &nonAdminToken))
+
+	t.Run("login", func(t *testing.T) {
+		request := waitForSpan(t, exporter, "POST /login")
+		verify := waitForSpan(t, exporter, "verify password")
+		if verify.Parent.SpanID() != request.SpanContext.SpanID() {
+			t.Fatalf("expected the password to be verified in the span of the request")
+		}
+		hash := waitForSpan(t, exporter, "hash password")
+		if create := waitForSpan(t, exporter, "POST /api/v1/accounts"); hash.Parent.TraceID() != create.SpanContext.TraceID() {
+			t.Fatalf("expected the password to be hashed in the trace of the request")
+		}
+	})
+
+	t.Run("propagated trace context", func(t *testing.T) {
+		exporter.Reset()
+		req, err := http.NewRequest("GET", ts.URL+"/api/v1/accounts/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		request := waitForSpan(t, exporter, "GET /api/v1/accounts/{id}")
+		if request.SpanContext.TraceID().String() != "0af7651916cd43dd8448eb211c80319c" || request.Parent.SpanID().String() != "b7ad6b7169203331" {
+			t.Fatalf("expected the trace context of the request to be continued, got %s", request.SpanContext.TraceID())
+		}
+		var route string
+		for _, attr := range request.Attributes {
+			if attr.Key == semconv.HTTPRouteKey {
+				route = attr.Value.AsString()
+			}
+		}
+		if route != "/api/v1/accounts/{id}" {
+			t.Fatalf("expected the route of the request to be recorded, got %q", route)
+		}
+		query := waitForSpan(t, exporter, "SELECT")
+		if query.Parent.SpanID() != request.SpanContext.SpanID() {
+			t.Fatalf("expected the query to be traced as a child of the request")
+		}
+	})
+
+	t.Run("probes not traced", func(t *testing.T) {
+		exporter.Reset()
+		res, err := client.Get(ts.URL + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		time.Sleep(50 * time.Millisecond)
+		for _, span := range exporter.GetSpans() {
+			if span.SpanKind.String() == "server" {
+				t.Fatalf("expected probes not to be traced, got %s", span.Name)
+			}
+		}
+	})
+}
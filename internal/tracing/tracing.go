@@ -0,0 +1,74 @@
+// Package tracing exports the traces of Notary with OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/canonical/notary/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the name of the service in the exported traces, unless OTEL_SERVICE_NAME is set.
+const ServiceName = "notary"
+
+// Tracer returns the tracer of the given instrumented package, from the global tracer provider.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Setup exports the traces of Notary over OTLP/HTTP to the given endpoint, such as
+// http://localhost:4318/v1/traces, and propagates the W3C trace context of incoming requests.
+// The standard OTEL_ environment variables of the exporter, the sampler and the resource also apply.
+// It does nothing when the endpoint is empty. The returned function flushes the spans that weren't exported
+// yet and stops exporting.
+func Setup(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(strings.TrimSpace(version.GetVersion())),
+	))
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence over the name and version of Notary.
+	res, err = resource.Merge(res, resource.Environment())
+	if err != nil {
+		return nil, err
+	}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("Couldn't export traces", "error", err)
+	}))
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	Install(provider)
+	return provider.Shutdown, nil
+}
+
+// Install makes the tracer provider the global one, and propagates the W3C trace context and baggage.
+func Install(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// End records the error, if any, on the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}